@@ -0,0 +1,72 @@
+package command
+
+import (
+	"auth/common/logger"
+	"auth/db"
+	"auth/models"
+	"auth/repository"
+	"auth/service"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	clientName         string
+	clientRedirectURIs []string
+	clientGrantTypes   []string
+	clientScopes       []string
+	clientPublic       bool
+)
+
+func init() {
+	clientCreateCmd.Flags().StringVar(&clientName, "name", "", "Client name shown to users")
+	clientCreateCmd.Flags().StringSliceVar(&clientRedirectURIs, "redirect-uri", nil, "Allowed redirect uri, repeatable")
+	clientCreateCmd.Flags().StringSliceVar(&clientGrantTypes, "grant-type", []string{"authorization_code", "refresh_token"}, "Allowed grant type, repeatable")
+	clientCreateCmd.Flags().StringSliceVar(&clientScopes, "scope", []string{"openid", "profile", "email"}, "Allowed scope, repeatable")
+	clientCreateCmd.Flags().BoolVar(&clientPublic, "public", false, "Public client without secret (mobile apps, SPAs)")
+	clientCreateCmd.MarkFlagRequired("name")
+
+	clientCmd.AddCommand(clientCreateCmd)
+	rootCmd.AddCommand(clientCmd)
+}
+
+var clientCmd = &cobra.Command{
+	Use:   "client",
+	Short: "Manage OAuth clients",
+}
+
+var clientCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Register a new OAuth client",
+	Run: func(cmd *cobra.Command, args []string) {
+		oauthService := newOAuthService()
+
+		client, secret, err := oauthService.RegisterClient(models.OAuthClient{
+			Name:         clientName,
+			RedirectURIs: clientRedirectURIs,
+			GrantTypes:   clientGrantTypes,
+			Scopes:       clientScopes,
+		}, clientPublic)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Println("client_id:    ", client.ClientID)
+		if secret != "" {
+			fmt.Println("client_secret:", secret)
+			fmt.Println("store the secret now, it cannot be shown again")
+		}
+	},
+}
+
+func newOAuthService() service.OAuthServiceInterface {
+	logger := logger.NewLogger(logger.NewRavenClient())
+	db := db.InitDB()
+	clientRepo := repository.NewOAuthClientRepository(db, logger)
+	userRepo := repository.NewUserRepository(db, logger)
+
+	return service.NewOAuthService(clientRepo, userRepo, nil, nil)
+}
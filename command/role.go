@@ -0,0 +1,52 @@
+package command
+
+import (
+	"auth/common/logger"
+	"auth/db"
+	"auth/repository"
+	"auth/service"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	roleUserID int
+	roleName   string
+)
+
+func init() {
+	roleAssignCmd.Flags().IntVar(&roleUserID, "user-id", 0, "Id of the user")
+	roleAssignCmd.Flags().StringVar(&roleName, "role", "", "Name of the role, e.g. admin")
+	roleAssignCmd.MarkFlagRequired("user-id")
+	roleAssignCmd.MarkFlagRequired("role")
+
+	roleCmd.AddCommand(roleAssignCmd)
+	rootCmd.AddCommand(roleCmd)
+}
+
+var roleCmd = &cobra.Command{
+	Use:   "role",
+	Short: "Manage user roles",
+}
+
+// roleAssignCmd exists to bootstrap the first admin, everything else is done
+// through /api/admin.
+var roleAssignCmd = &cobra.Command{
+	Use:   "assign",
+	Short: "Assign a role to a user",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := logger.NewLogger(logger.NewRavenClient())
+		db := db.InitDB()
+		roleService := service.NewRoleService(repository.NewRoleRepository(db, logger), repository.NewUserRepository(db, logger))
+
+		roles, err := roleService.AssignRole(roleUserID, roleName)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Println("roles:", roles)
+	},
+}
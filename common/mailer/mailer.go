@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"auth/config"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Message is a plain text mail.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers mails to users.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// NewMailer returns the mailer selected by MAIL_DRIVER: "smtp" sends through
+// SMTP_HOST, anything else writes the mails to MAIL_OUTBOX_DIR for local
+// development.
+func NewMailer() (Mailer, error) {
+	switch strings.ToLower(config.Config.MailDriver) {
+	case "smtp":
+		if config.Config.SMTPHost == "" {
+			return nil, fmt.Errorf("mailer: SMTP_HOST is not set")
+		}
+		return NewSMTPMailer(config.Config.SMTPHost, config.Config.SMTPPort, config.Config.SMTPUsername, config.Config.SMTPPassword, from()), nil
+	case "", "outbox":
+		return NewOutboxMailer(outboxDir(), from()), nil
+	default:
+		return nil, fmt.Errorf("mailer: unknown MAIL_DRIVER %q", config.Config.MailDriver)
+	}
+}
+
+// render builds the RFC 5322 form of the message.
+func render(from string, message Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + message.To + "\r\n")
+	b.WriteString("Subject: " + message.Subject + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// validate keeps header injection out of the rendered mail.
+func validate(message Message) error {
+	if message.To == "" {
+		return fmt.Errorf("mailer: no recipient")
+	}
+	if strings.ContainsAny(message.To+message.Subject, "\r\n") {
+		return fmt.Errorf("mailer: invalid header value")
+	}
+	return nil
+}
+
+func from() string {
+	if config.Config.MailFrom != "" {
+		return config.Config.MailFrom
+	}
+	return "no-reply@localhost"
+}
+
+func outboxDir() string {
+	if config.Config.MailOutboxDir != "" {
+		return config.Config.MailOutboxDir
+	}
+	return "outbox"
+}
@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"auth/common/logger"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type OutboxMailer struct {
+	dir  string
+	from string
+}
+
+// NewOutboxMailer writes every mail as an .eml file into dir instead of
+// sending it, so links and codes can be picked up during development.
+func NewOutboxMailer(dir string, from string) Mailer {
+	return &OutboxMailer{dir: dir, from: from}
+}
+
+func (m *OutboxMailer) Send(ctx context.Context, message Message) error {
+	if err := validate(message); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := filepath.Join(m.dir, fmt.Sprintf("%d.eml", time.Now().UnixNano()))
+	if err := os.WriteFile(name, render(m.from, message), 0o600); err != nil {
+		return err
+	}
+
+	logger.LogInfo("mail to ", message.To, " written to ", name)
+	return nil
+}
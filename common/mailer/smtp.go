@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"strconv"
+)
+
+type SMTPMailer struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer sends mails through an SMTP relay. Without a username the
+// relay is used unauthenticated.
+func NewSMTPMailer(host string, port int, username string, password string, from string) Mailer {
+	if port <= 0 {
+		port = 587
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{addr: net.JoinHostPort(host, strconv.Itoa(port)), host: host, auth: auth, from: from}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	if err := validate(message); err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{message.To}, render(m.from, message))
+}
@@ -0,0 +1,110 @@
+package password
+
+import (
+	"auth/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2idPrefix    = "$argon2id$"
+	argon2idSaltSize  = 16
+	argon2idKeyLength = 32
+	// argon2idMinKeyLength is the shortest key a stored hash may have. A
+	// shorter one, or none at all, would match far too many passwords.
+	argon2idMinKeyLength = 16
+)
+
+// argon2idHasher writes hashes in the PHC string format,
+// $argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+type argon2idHasher struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func newArgon2idHasher() *argon2idHasher {
+	hasher := &argon2idHasher{memory: 64 * 1024, iterations: 3, parallelism: 2}
+	if config.Config.Argon2Memory > 0 {
+		hasher.memory = uint32(config.Config.Argon2Memory)
+	}
+	if config.Config.Argon2Iterations > 0 {
+		hasher.iterations = uint32(config.Config.Argon2Iterations)
+	}
+	if config.Config.Argon2Parallelism > 0 {
+		hasher.parallelism = uint8(config.Config.Argon2Parallelism)
+	}
+	return hasher
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2idSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("password: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.iterations, h.memory, h.parallelism, argon2idKeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, h.memory, h.iterations, h.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *argon2idHasher) Verify(hash string, password string) (bool, error) {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (h *argon2idHasher) Owns(hash string) bool {
+	return strings.HasPrefix(hash, argon2idPrefix)
+}
+
+func (h *argon2idHasher) Outdated(hash string) bool {
+	params, _, key, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return *params != *h || len(key) != argon2idKeyLength
+}
+
+func parseArgon2id(hash string) (*argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("password: unsupported argon2 version %q", parts[2])
+	}
+
+	params := &argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, nil, nil, fmt.Errorf("password: invalid argon2 parameters: %w", err)
+	}
+	if params.memory == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return nil, nil, nil, fmt.Errorf("password: invalid argon2 parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("password: invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("password: invalid argon2 key: %w", err)
+	}
+	if len(key) < argon2idMinKeyLength {
+		return nil, nil, nil, fmt.Errorf("password: argon2 key of %d bytes is too short", len(key))
+	}
+
+	return params, salt, key, nil
+}
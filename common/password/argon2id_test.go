@@ -0,0 +1,126 @@
+package password
+
+import (
+	"auth/config"
+	"strings"
+	"testing"
+)
+
+// useArgon2id selects argon2id with cheap parameters, the defaults take too
+// long for tests.
+func useArgon2id(t *testing.T, memory int, iterations int) {
+	t.Helper()
+
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+
+	config.Config.PasswordHasher = SchemeArgon2id
+	config.Config.Argon2Memory = memory
+	config.Config.Argon2Iterations = iterations
+	config.Config.Argon2Parallelism = 1
+	config.Config.BcryptCost = 4
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	useArgon2id(t, 1024, 1)
+
+	hash, err := Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected hash format %q", hash)
+	}
+
+	ok, err := Verify(hash, "correct horse battery staple")
+	if err != nil || !ok {
+		t.Fatalf("Verify(right password) = %v, %v", ok, err)
+	}
+	ok, err = Verify(hash, "correct horse battery stapler")
+	if err != nil || ok {
+		t.Fatalf("Verify(wrong password) = %v, %v", ok, err)
+	}
+
+	other, err := Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Fatal("two hashes of the same password share their salt")
+	}
+}
+
+func TestArgon2idVerifiesWithStoredParameters(t *testing.T) {
+	useArgon2id(t, 1024, 1)
+	hash, err := Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hashes stay verifiable after the parameters changed.
+	useArgon2id(t, 2048, 2)
+	ok, err := Verify(hash, "secret")
+	if err != nil || !ok {
+		t.Fatalf("Verify = %v, %v", ok, err)
+	}
+}
+
+func TestArgon2idRejectsMalformedHashes(t *testing.T) {
+	useArgon2id(t, 1024, 1)
+
+	for _, hash := range []string{
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5",
+		// An empty or short key would match every password.
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=0$c2FsdHNhbHRzYWx0c2FsdA$c2FsdHNhbHRzYWx0c2FsdA",
+		"$argon2id$v=19$m=0,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$c2FsdHNhbHRzYWx0c2FsdA",
+		"plain",
+	} {
+		if ok, err := Verify(hash, "secret"); ok || err == nil {
+			t.Errorf("Verify(%q) = %v, %v", hash, ok, err)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	useArgon2id(t, 1024, 1)
+	argon2idHash, err := Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRehash(argon2idHash) {
+		t.Fatal("hash with the current parameters needs rehash")
+	}
+
+	useArgon2id(t, 2048, 1)
+	if !NeedsRehash(argon2idHash) {
+		t.Fatal("hash with less memory does not need rehash")
+	}
+	useArgon2id(t, 1024, 2)
+	if !NeedsRehash(argon2idHash) {
+		t.Fatal("hash with fewer iterations does not need rehash")
+	}
+
+	bcryptHash, err := newBcryptHasher().Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Verify(bcryptHash, "secret"); err != nil || !ok {
+		t.Fatalf("Verify(bcrypt) = %v, %v", ok, err)
+	}
+	if !NeedsRehash(bcryptHash) {
+		t.Fatal("bcrypt hash does not need rehash under argon2id")
+	}
+
+	config.Config.PasswordHasher = SchemeBcrypt
+	if NeedsRehash(bcryptHash) {
+		t.Fatal("bcrypt hash needs rehash under bcrypt")
+	}
+	if !NeedsRehash(argon2idHash) {
+		t.Fatal("argon2id hash does not need rehash under bcrypt")
+	}
+}
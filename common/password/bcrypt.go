@@ -0,0 +1,55 @@
+package password
+
+import (
+	"auth/config"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type bcryptHasher struct {
+	cost int
+}
+
+func newBcryptHasher() *bcryptHasher {
+	hasher := &bcryptHasher{cost: 12}
+	if config.Config.BcryptCost >= bcrypt.MinCost && config.Config.BcryptCost <= bcrypt.MaxCost {
+		hasher.cost = config.Config.BcryptCost
+	}
+	return hasher
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", fmt.Errorf("password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func (h *bcryptHasher) Verify(hash string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("password: %w", err)
+	}
+	return true, nil
+}
+
+func (h *bcryptHasher) Owns(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *bcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
@@ -0,0 +1,171 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sha1PrefixLength is the length of the hash prefix a range is looked up by,
+// as in the Pwned Passwords k-anonymity API.
+const sha1PrefixLength = 5
+
+// BreachedChecker looks passwords up in a local copy of a breached password
+// corpus such as Pwned Passwords, so nothing leaves the host. Only the SHA-1
+// prefix of a password selects the range that is searched.
+//
+// path is either a directory of range files named after the prefix
+// ("21BD1" or "21BD1.txt" holding "SUFFIX:COUNT" lines, the layout of the
+// Pwned Passwords downloader), which are read on demand, a single file of
+// "HASH:COUNT" lines that is loaded into memory, or the http(s) URL of a range
+// API such as a Pwned Passwords mirror, which is asked for URL/PREFIX.
+type BreachedChecker struct {
+	dir      string
+	url      string
+	client   *http.Client
+	ranges   map[string]map[string]int
+	minCount int
+}
+
+// maxRangeSize caps the answer of a range API, real ranges are well below.
+const maxRangeSize = 1 << 20
+
+func NewBreachedChecker(path string, minCount int) (*BreachedChecker, error) {
+	if minCount <= 0 {
+		minCount = 1
+	}
+	checker := &BreachedChecker{minCount: minCount}
+
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		checker.url = strings.TrimSuffix(path, "/")
+		checker.client = &http.Client{Timeout: 5 * time.Second}
+		return checker, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("password: breached passwords: %w", err)
+	}
+	if info.IsDir() {
+		checker.dir = path
+		return checker, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("password: breached passwords: %w", err)
+	}
+	defer file.Close()
+
+	checker.ranges = map[string]map[string]int{}
+	err = parseHashes(file, func(hash string, count int) {
+		if len(hash) != sha1.Size*2 {
+			return
+		}
+		prefix := hash[:sha1PrefixLength]
+		if checker.ranges[prefix] == nil {
+			checker.ranges[prefix] = map[string]int{}
+		}
+		checker.ranges[prefix][hash[sha1PrefixLength:]] = count
+	})
+	if err != nil {
+		return nil, fmt.Errorf("password: breached passwords: %w", err)
+	}
+
+	return checker, nil
+}
+
+// Breached reports whether the password was seen at least minCount times.
+func (c *BreachedChecker) Breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := c.Range(hash[:sha1PrefixLength])
+	if err != nil {
+		return false, err
+	}
+
+	return suffixes[hash[sha1PrefixLength:]] >= c.minCount, nil
+}
+
+// Range returns the hash suffixes and counts known for the prefix.
+func (c *BreachedChecker) Range(prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+	if c.url != "" {
+		return c.fetchRange(prefix)
+	}
+	if c.dir == "" {
+		return c.ranges[prefix], nil
+	}
+
+	for _, name := range []string{prefix, prefix + ".txt"} {
+		file, err := os.Open(filepath.Join(c.dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		suffixes := map[string]int{}
+		err = parseHashes(file, func(suffix string, count int) {
+			suffixes[suffix] = count
+		})
+		return suffixes, err
+	}
+
+	return nil, nil
+}
+
+// fetchRange asks the range API for the prefix. Only the prefix is sent, the
+// API cannot tell which of its passwords was looked up.
+func (c *BreachedChecker) fetchRange(prefix string) (map[string]int, error) {
+	response, err := c.client.Get(c.url + "/" + prefix)
+	if err != nil {
+		return nil, fmt.Errorf("password: breached passwords: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("password: breached passwords: range API answered %s", response.Status)
+	}
+
+	suffixes := map[string]int{}
+	err = parseHashes(io.LimitReader(response.Body, maxRangeSize), func(suffix string, count int) {
+		suffixes[suffix] = count
+	})
+	if err != nil {
+		return nil, fmt.Errorf("password: breached passwords: %w", err)
+	}
+	return suffixes, nil
+}
+
+// parseHashes reads "HASH:COUNT" lines; a missing count counts as one.
+func parseHashes(reader io.Reader, add func(hash string, count int)) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		hash, countText, _ := strings.Cut(line, ":")
+		count := 1
+		if countText != "" {
+			if n, err := strconv.Atoi(countText); err == nil {
+				count = n
+			}
+		}
+		add(strings.ToUpper(hash), count)
+	}
+	return scanner.Err()
+}
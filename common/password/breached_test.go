@@ -0,0 +1,143 @@
+package password
+
+import (
+	"auth/rest_errors"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// rangeAPI serves the breached hashes by prefix like the Pwned Passwords
+// range API and records the paths it was asked for.
+type rangeAPI struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newRangeAPI(t *testing.T, counts map[string]int) *rangeAPI {
+	t.Helper()
+
+	api := &rangeAPI{}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		api.requests = append(api.requests, r.URL.Path)
+		api.mu.Unlock()
+
+		prefix := strings.TrimPrefix(r.URL.Path, "/range/")
+		for password, count := range counts {
+			if hash := sha1Hex(password); hash[:sha1PrefixLength] == prefix {
+				fmt.Fprintf(w, "%s:%d\r\n", hash[sha1PrefixLength:], count)
+			}
+		}
+		// Padding lines of other suffixes, as the real API sends.
+		fmt.Fprint(w, "0000000000000000000000000000000000A:0\r\n")
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+func TestBreachedCheckerAsksRangeAPI(t *testing.T) {
+	api := newRangeAPI(t, map[string]int{"hunter2": 30000, "rarely-seen": 1})
+	checker, err := NewBreachedChecker(api.URL+"/range/", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		password string
+		breached bool
+	}{
+		{password: "hunter2", breached: true},
+		{password: "rarely-seen", breached: false},
+		{password: "never-seen-before", breached: false},
+	} {
+		breached, err := checker.Breached(test.password)
+		if err != nil {
+			t.Fatalf("%s: %v", test.password, err)
+		}
+		if breached != test.breached {
+			t.Errorf("%s: breached = %v, want %v", test.password, breached, test.breached)
+		}
+	}
+
+	// Only the 5 character prefix of each hash leaves the host.
+	for i, password := range []string{"hunter2", "rarely-seen", "never-seen-before"} {
+		if want := "/range/" + sha1Hex(password)[:sha1PrefixLength]; api.requests[i] != want {
+			t.Errorf("request %d = %q, want %q", i, api.requests[i], want)
+		}
+	}
+}
+
+func TestBreachedCheckerRangeAPIErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	checker, err := NewBreachedChecker(server.URL, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checker.Breached("hunter2"); err == nil {
+		t.Fatal("error status taken as a range")
+	}
+
+	// The policy lets the password through when the lookup fails.
+	policy := &Policy{MinLength: 1, MaxLength: 72, AllowPersonalInfo: true, Breached: checker}
+	if err := policy.Validate("hunter2", PersonalInfo{}); err != nil {
+		t.Fatalf("refused on a failed lookup: %v", err)
+	}
+}
+
+func TestBreachedCheckerReadsFiles(t *testing.T) {
+	hash := sha1Hex("hunter2")
+
+	dir := t.TempDir()
+	rangeFile := filepath.Join(dir, hash[:sha1PrefixLength]+".txt")
+	if err := os.WriteFile(rangeFile, []byte(hash[sha1PrefixLength:]+":5\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	single := filepath.Join(t.TempDir(), "hashes.txt")
+	if err := os.WriteFile(single, []byte(strings.ToLower(hash)+":5\nnot-a-hash:9\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, path := range map[string]string{"range directory": dir, "single file": single} {
+		checker, err := NewBreachedChecker(path, 5)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for password, want := range map[string]bool{"hunter2": true, "correct horse": false} {
+			breached, err := checker.Breached(password)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if breached != want {
+				t.Errorf("%s: %s breached = %v, want %v", name, password, breached, want)
+			}
+		}
+
+		policy := &Policy{MinLength: 1, MaxLength: 72, AllowPersonalInfo: true, Breached: checker}
+		if err := policy.Validate("hunter2", PersonalInfo{}); err != rest_errors.ErrPasswordBreached {
+			t.Errorf("%s: got %v, want ErrPasswordBreached", name, err)
+		}
+	}
+
+	if _, err := NewBreachedChecker(filepath.Join(dir, "missing"), 1); err == nil {
+		t.Fatal("missing path accepted")
+	}
+}
@@ -0,0 +1,61 @@
+package password
+
+import (
+	"auth/config"
+	"errors"
+	"strings"
+)
+
+// Names of the supported hashing schemes, used by PASSWORD_HASHER.
+const (
+	SchemeArgon2id = "argon2id"
+	SchemeBcrypt   = "bcrypt"
+)
+
+var ErrUnknownHash = errors.New("password: unknown hash format")
+
+// Hasher is one password hashing scheme. Every hash names its scheme and
+// parameters, so it stays verifiable after the configuration changed.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(hash string, password string) (bool, error)
+	// Owns reports whether the hash was made with this scheme.
+	Owns(hash string) bool
+	// Outdated reports whether the hash was made with other parameters than
+	// the hasher uses now.
+	Outdated(hash string) bool
+}
+
+// CurrentHasher returns the hasher new passwords are hashed with.
+func CurrentHasher() Hasher {
+	if strings.ToLower(config.Config.PasswordHasher) == SchemeBcrypt {
+		return newBcryptHasher()
+	}
+	return newArgon2idHasher()
+}
+
+func hashers() []Hasher {
+	return []Hasher{newArgon2idHasher(), newBcryptHasher()}
+}
+
+// Hash hashes the password with the current hasher.
+func Hash(password string) (string, error) {
+	return CurrentHasher().Hash(password)
+}
+
+// Verify checks the password against a hash of any supported scheme.
+func Verify(hash string, password string) (bool, error) {
+	for _, hasher := range hashers() {
+		if hasher.Owns(hash) {
+			return hasher.Verify(hash, password)
+		}
+	}
+	return false, ErrUnknownHash
+}
+
+// NeedsRehash reports whether the hash should be replaced by one of the
+// current hasher, because the scheme or its parameters changed.
+func NeedsRehash(hash string) bool {
+	current := CurrentHasher()
+	return !current.Owns(hash) || current.Outdated(hash)
+}
@@ -0,0 +1,206 @@
+package password
+
+import (
+	"auth/common/logger"
+	"auth/config"
+	"auth/rest_errors"
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Character classes a policy can require.
+const (
+	ClassUpper   = "upper"
+	ClassLower   = "lower"
+	ClassDigit   = "digit"
+	ClassSpecial = "special"
+)
+
+// minPersonalInfoLength is the shortest part of an email or name that may not
+// appear in a password, shorter ones would reject too many passwords.
+const minPersonalInfoLength = 4
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// DefaultPolicy is the policy built from the config by InitPolicy.
+var DefaultPolicy = &Policy{MinLength: 8, MaxLength: 72, Classes: []string{ClassUpper, ClassLower, ClassDigit, ClassSpecial}}
+
+// Policy decides which passwords users may choose.
+type Policy struct {
+	MinLength         int
+	MaxLength         int
+	Classes           []string
+	Denylist          map[string]bool
+	AllowPersonalInfo bool
+	Breached          *BreachedChecker
+}
+
+// PersonalInfo is what the password must not be built from.
+type PersonalInfo struct {
+	Email    string
+	UserName string
+	Name     string
+}
+
+// InitPolicy builds DefaultPolicy from the PASSWORD_* settings and loads the
+// denylist and breached password files.
+func InitPolicy() error {
+	policy := &Policy{
+		MinLength:         config.Config.PasswordMinLength,
+		MaxLength:         config.Config.PasswordMaxLength,
+		AllowPersonalInfo: config.Config.PasswordAllowPersonalInfo,
+		Denylist:          map[string]bool{},
+	}
+	if policy.MinLength <= 0 {
+		policy.MinLength = 8
+	}
+	if policy.MaxLength <= 0 {
+		policy.MaxLength = 72
+	}
+	if policy.MaxLength < policy.MinLength {
+		return fmt.Errorf("password: PASSWORD_MAX_LENGTH is below PASSWORD_MIN_LENGTH")
+	}
+
+	classes, err := parseClasses(config.Config.PasswordCharacterClasses)
+	if err != nil {
+		return err
+	}
+	policy.Classes = classes
+
+	addDenylist(policy.Denylist, strings.NewReader(commonPasswords))
+	if config.Config.PasswordDenylistFile != "" {
+		file, err := os.Open(config.Config.PasswordDenylistFile)
+		if err != nil {
+			return fmt.Errorf("password: denylist: %w", err)
+		}
+		addDenylist(policy.Denylist, file)
+		file.Close()
+	}
+
+	if config.Config.PasswordBreachedPath != "" {
+		policy.Breached, err = NewBreachedChecker(config.Config.PasswordBreachedPath, config.Config.PasswordBreachedMinCount)
+		if err != nil {
+			return err
+		}
+	}
+
+	DefaultPolicy = policy
+	return nil
+}
+
+// Validate returns the first rule the password breaks.
+func (p *Policy) Validate(password string, info PersonalInfo) error {
+	// The maximum is counted in bytes, bcrypt does not hash more than 72.
+	if len([]rune(password)) < p.MinLength || len(password) > p.MaxLength {
+		return errors.New(rest_errors.PasswordLength(p.MinLength, p.MaxLength))
+	}
+
+	if len(missingClasses(password, p.Classes)) > 0 {
+		return errors.New(rest_errors.PasswordCharacterClasses(p.Classes))
+	}
+
+	if p.Denylist[strings.ToLower(password)] {
+		return rest_errors.ErrPasswordTooCommon
+	}
+
+	if !p.AllowPersonalInfo && containsPersonalInfo(password, info) {
+		return rest_errors.ErrPasswordContainsPersonalInfo
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Breached(password)
+		if err != nil {
+			// The lookup is a hardening measure, a broken file must not keep
+			// users from setting passwords.
+			logger.LogError(err)
+		} else if breached {
+			return rest_errors.ErrPasswordBreached
+		}
+	}
+
+	return nil
+}
+
+func parseClasses(spec string) ([]string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return []string{ClassUpper, ClassLower, ClassDigit, ClassSpecial}, nil
+	}
+	if spec == "none" {
+		return nil, nil
+	}
+
+	classes := []string{}
+	for _, class := range strings.Split(spec, ",") {
+		class = strings.TrimSpace(class)
+		switch class {
+		case ClassUpper, ClassLower, ClassDigit, ClassSpecial:
+			classes = append(classes, class)
+		default:
+			return nil, fmt.Errorf("password: unknown character class %q", class)
+		}
+	}
+	return classes, nil
+}
+
+func missingClasses(password string, classes []string) []string {
+	found := map[string]bool{}
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			found[ClassUpper] = true
+		case unicode.IsLower(r):
+			found[ClassLower] = true
+		case unicode.IsDigit(r):
+			found[ClassDigit] = true
+		case !unicode.IsLetter(r):
+			found[ClassSpecial] = true
+		}
+	}
+
+	missing := []string{}
+	for _, class := range classes {
+		if !found[class] {
+			missing = append(missing, class)
+		}
+	}
+	return missing
+}
+
+// containsPersonalInfo reports whether the password contains the email, its
+// local part, the user name or a part of the name.
+func containsPersonalInfo(password string, info PersonalInfo) bool {
+	password = strings.ToLower(password)
+
+	parts := []string{info.Email, info.UserName}
+	if at := strings.LastIndex(info.Email, "@"); at > 0 {
+		parts = append(parts, info.Email[:at])
+	}
+	parts = append(parts, strings.Fields(info.Name)...)
+
+	for _, part := range parts {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if len([]rune(part)) >= minPersonalInfoLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func addDenylist(denylist map[string]bool, file io.Reader) {
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		denylist[strings.ToLower(line)] = true
+	}
+}
@@ -0,0 +1,112 @@
+package password
+
+import (
+	"auth/common/logger"
+	"auth/rest_errors"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	logger.NewLogger(nil)
+	os.Exit(m.Run())
+}
+
+func TestPolicyValidate(t *testing.T) {
+	policy := &Policy{
+		MinLength: 8,
+		MaxLength: 20,
+		Classes:   []string{ClassUpper, ClassLower, ClassDigit, ClassSpecial},
+		Denylist:  map[string]bool{"passw0rd!a": true},
+	}
+	info := PersonalInfo{Email: "alice.smith@example.com", UserName: "wonderland", Name: "Alice Smith"}
+
+	lengthError := rest_errors.PasswordLength(8, 20)
+	classesError := rest_errors.PasswordCharacterClasses(policy.Classes)
+
+	for _, test := range []struct {
+		name     string
+		password string
+		err      string
+	}{
+		{name: "valid", password: "Tr0ub4dor&3"},
+		{name: "too short", password: "Aa1!aaa", err: lengthError},
+		{name: "shortest", password: "Aa1!aaaa"},
+		{name: "too long", password: "Aa1!aaaaaaaaaaaaaaaaa", err: lengthError},
+		{name: "longest", password: "Aa1!aaaaaaaaaaaaaaaa"},
+		// Runes count towards the minimum, bytes towards the maximum.
+		{name: "multibyte below minimum", password: "Ää1!äää", err: lengthError},
+		{name: "multibyte above maximum", password: "Ää1!ääääääääää", err: lengthError},
+		{name: "multibyte classes", password: "Ää1!ääää"},
+		{name: "no upper", password: "tr0ub4dor&3", err: classesError},
+		{name: "no lower", password: "TR0UB4DOR&3", err: classesError},
+		{name: "no digit", password: "Troubador&x", err: classesError},
+		{name: "no special", password: "Tr0ub4dor33", err: classesError},
+		{name: "denylisted in any case", password: "Passw0rd!A", err: rest_errors.ErrPasswordTooCommon.Error()},
+		{name: "email local part", password: "X1!alice.smith", err: rest_errors.ErrPasswordContainsPersonalInfo.Error()},
+		{name: "user name", password: "X1!WonderLand", err: rest_errors.ErrPasswordContainsPersonalInfo.Error()},
+		{name: "part of the name", password: "X1!smithy99", err: rest_errors.ErrPasswordContainsPersonalInfo.Error()},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.Validate(test.password, info)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("refused: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("got %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestPolicyAllowsShortNameParts(t *testing.T) {
+	policy := &Policy{MinLength: 8, MaxLength: 72}
+	info := PersonalInfo{Email: "al@example.com", Name: "Al Bo"}
+
+	// Parts below minPersonalInfoLength would refuse too many passwords.
+	if err := policy.Validate("al-bo-and-more", info); err != nil {
+		t.Fatalf("refused: %v", err)
+	}
+
+	policy.AllowPersonalInfo = true
+	if err := policy.Validate("al@example.com!", info); err != nil {
+		t.Fatalf("refused with personal info allowed: %v", err)
+	}
+}
+
+func TestParseClasses(t *testing.T) {
+	for _, test := range []struct {
+		spec    string
+		classes []string
+		valid   bool
+	}{
+		{spec: "", classes: []string{ClassUpper, ClassLower, ClassDigit, ClassSpecial}, valid: true},
+		{spec: "none", classes: nil, valid: true},
+		{spec: " lower , digit ", classes: []string{ClassLower, ClassDigit}, valid: true},
+		{spec: "lower,emoji"},
+	} {
+		classes, err := parseClasses(test.spec)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%q: accepted", test.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if len(classes) != len(test.classes) {
+			t.Errorf("%q: got %v, want %v", test.spec, classes, test.classes)
+			continue
+		}
+		for i := range classes {
+			if classes[i] != test.classes[i] {
+				t.Errorf("%q: got %v, want %v", test.spec, classes, test.classes)
+			}
+		}
+	}
+}
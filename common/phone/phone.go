@@ -0,0 +1,63 @@
+// Package phone normalizes phone numbers to E.164.
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidNumber      = errors.New("phone: invalid number")
+	ErrInvalidCountryCode = errors.New("phone: invalid country code")
+	// ErrInvalidSubscriber is returned for a well-formed number that is too
+	// short or too long to be dialled.
+	ErrInvalidSubscriber = errors.New("phone: invalid subscriber number")
+)
+
+// Normalize returns the number in E.164 form, "+" followed by up to 15
+// digits. Spaces, dashes, dots and parentheses are dropped and a leading "00"
+// is read as "+". Numbers without either are taken as national numbers of
+// defaultCountryCode, without their trunk prefix "0"; they are refused when
+// no default is set.
+func Normalize(number string, defaultCountryCode string) (string, error) {
+	number = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')', '\t':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(number))
+
+	switch {
+	case strings.HasPrefix(number, "+"):
+		number = number[1:]
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	default:
+		countryCode := strings.TrimPrefix(strings.TrimSpace(defaultCountryCode), "+")
+		if !digits(countryCode) || countryCode == "" || len(countryCode) > 3 || countryCode[0] == '0' {
+			return "", ErrInvalidCountryCode
+		}
+		number = countryCode + strings.TrimPrefix(number, "0")
+	}
+
+	if !digits(number) || number == "" || number[0] == '0' {
+		return "", ErrInvalidNumber
+	}
+	// The shortest numbers in use have a one digit country code and a six
+	// digit subscriber number.
+	if len(number) < 7 || len(number) > 15 {
+		return "", ErrInvalidSubscriber
+	}
+
+	return "+" + number, nil
+}
+
+func digits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package phone
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	for _, test := range []struct {
+		name               string
+		number             string
+		defaultCountryCode string
+		want               string
+		err                error
+	}{
+		{name: "E.164", number: "+4915123456789", want: "+4915123456789"},
+		{name: "international prefix", number: "0049 151 23456789", want: "+4915123456789"},
+		{name: "separators", number: " +1 (415) 555-0100 ", want: "+14155550100"},
+		{name: "dots and tabs", number: "+44.20\t7946.0018", want: "+442079460018"},
+		{name: "international ignores default", number: "+33612345678", defaultCountryCode: "49", want: "+33612345678"},
+		{name: "national with trunk prefix", number: "0151 23456789", defaultCountryCode: "49", want: "+4915123456789"},
+		{name: "national without trunk prefix", number: "415 555 0100", defaultCountryCode: "1", want: "+14155550100"},
+		{name: "default with plus", number: "0612345678", defaultCountryCode: "+33", want: "+33612345678"},
+		{name: "shortest", number: "+1234567", want: "+1234567"},
+		{name: "longest", number: "+123456789012345", want: "+123456789012345"},
+
+		// A national number means nothing without a country to dial it in.
+		{name: "national without default", number: "0151 23456789", err: ErrInvalidCountryCode},
+		{name: "default with letters", number: "015123456789", defaultCountryCode: "DE", err: ErrInvalidCountryCode},
+		{name: "default too long", number: "015123456789", defaultCountryCode: "4949", err: ErrInvalidCountryCode},
+		{name: "default with leading zero", number: "015123456789", defaultCountryCode: "049", err: ErrInvalidCountryCode},
+
+		{name: "letters", number: "+1 800 FLOWERS", err: ErrInvalidNumber},
+		{name: "country code zero", number: "+049151234567", err: ErrInvalidNumber},
+		{name: "triple zero", number: "000491512345678", err: ErrInvalidNumber},
+		{name: "plus only", number: "+", err: ErrInvalidNumber},
+		{name: "two plus signs", number: "++4915123456789", err: ErrInvalidNumber},
+		{name: "empty", number: "", defaultCountryCode: "49", err: ErrInvalidSubscriber},
+
+		{name: "too short", number: "+123456", err: ErrInvalidSubscriber},
+		{name: "too long", number: "+1234567890123456", err: ErrInvalidSubscriber},
+		{name: "national too long", number: "0151234567890123", defaultCountryCode: "49", err: ErrInvalidSubscriber},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Normalize(test.number, test.defaultCountryCode)
+			if err != test.err {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+			if got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package sms
+
+import (
+	"auth/config"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Message is a text message to a phone number in E.164 form.
+type Message struct {
+	To   string
+	Body string
+}
+
+// SMSSender delivers text messages to users.
+type SMSSender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// NewSMSSender returns the sender selected by SMS_DRIVER: "webhook" posts the
+// messages to SMS_WEBHOOK_URL for a gateway to deliver, "file" appends them
+// to SMS_OUTBOX_FILE and anything else only logs them, the last two for
+// local development.
+func NewSMSSender() (SMSSender, error) {
+	switch strings.ToLower(config.Config.SMSDriver) {
+	case "webhook":
+		if config.Config.SMSWebhookURL == "" {
+			return nil, fmt.Errorf("sms: SMS_WEBHOOK_URL is not set")
+		}
+		return NewWebhookSender(config.Config.SMSWebhookURL), nil
+	case "file":
+		return NewFileSender(outboxFile()), nil
+	case "", "log":
+		return NewLogSender(), nil
+	default:
+		return nil, fmt.Errorf("sms: unknown SMS_DRIVER %q", config.Config.SMSDriver)
+	}
+}
+
+func validate(message Message) error {
+	if !strings.HasPrefix(message.To, "+") {
+		return fmt.Errorf("sms: recipient %q is not in E.164 form", message.To)
+	}
+	return nil
+}
+
+func outboxFile() string {
+	if config.Config.SMSOutboxFile != "" {
+		return config.Config.SMSOutboxFile
+	}
+	return "outbox/sms.log"
+}
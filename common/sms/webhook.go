@@ -0,0 +1,49 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type WebhookSender struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSender posts every message as {"to": ..., "body": ...} to url,
+// where a gateway of choice delivers it.
+func NewWebhookSender(url string) SMSSender {
+	return &WebhookSender{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *WebhookSender) Send(ctx context.Context, message Message) error {
+	if err := validate(message); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{"to": message.To, "body": message.Body})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("sms: webhook answered %s", response.Status)
+	}
+	return nil
+}
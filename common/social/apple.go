@@ -0,0 +1,48 @@
+package social
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const appleIssuer = "https://appleid.apple.com"
+
+// appleClientSecretTTL is the lifetime of the client secrets signed for the
+// token endpoint. Apple accepts up to six months; a fresh one is signed for
+// every exchange.
+const appleClientSecretTTL = 5 * time.Minute
+
+// NewAppleProvider returns Sign in with Apple. clientID is the Services ID,
+// the client secret is a JWT signed with the .p8 key of the team.
+func NewAppleProvider(clientID string, teamID string, keyID string, privateKeyPEM []byte) (Provider, error) {
+	if teamID == "" || keyID == "" {
+		return nil, fmt.Errorf("social: APPLE_TEAM_ID and APPLE_KEY_ID are required")
+	}
+	privateKey, err := jwt.ParseECPrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("social: parse Apple private key: %w", err)
+	}
+
+	provider := newOIDCProvider(Apple, appleIssuer, clientID, "", []string{"openid", "name", "email"})
+	// Apple neither supports PKCE nor sends the name and email scopes to a
+	// redirect uri other than by form post.
+	provider.pkce = false
+	provider.authParams = url.Values{"response_mode": {"form_post"}}
+	provider.clientSecret = func() (string, error) {
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.StandardClaims{
+			Issuer:    teamID,
+			Subject:   clientID,
+			Audience:  appleIssuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(appleClientSecretTTL).Unix(),
+		})
+		token.Header["kid"] = keyID
+		return token.SignedString(privateKey)
+	}
+
+	return provider, nil
+}
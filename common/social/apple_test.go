@@ -0,0 +1,55 @@
+package social
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestAppleClientSecret(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	if _, err := NewAppleProvider("com.example.web", "", "KEYID", p8); err == nil {
+		t.Fatal("provider without team id accepted")
+	}
+
+	provider, err := NewAppleProvider("com.example.web", "TEAMID", "KEYID", p8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apple := provider.(*OIDCProvider)
+	if apple.pkce || apple.authParams.Get("response_mode") != "form_post" {
+		t.Fatalf("pkce = %v, response_mode = %q", apple.pkce, apple.authParams.Get("response_mode"))
+	}
+
+	secret, err := apple.clientSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.StandardClaims{}
+	token, err := jwt.ParseWithClaims(secret, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodES256 || token.Header["kid"] != "KEYID" {
+			t.Fatalf("secret signed with %v, kid %v", token.Header["alg"], token.Header["kid"])
+		}
+		return &privateKey.PublicKey, nil
+	})
+	if err != nil || !token.Valid {
+		t.Fatalf("client secret does not verify: %v", err)
+	}
+	if claims.Issuer != "TEAMID" || claims.Subject != "com.example.web" || claims.Audience != appleIssuer {
+		t.Fatalf("client secret claims = %+v", claims)
+	}
+}
@@ -0,0 +1,98 @@
+package social
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The endpoints of GitHub, variables so tests can point them elsewhere.
+var (
+	gitHubAuthorizeURL = "https://github.com/login/oauth/authorize"
+	gitHubTokenURL     = "https://github.com/login/oauth/access_token"
+	gitHubAPIURL       = "https://api.github.com"
+)
+
+// GitHubProvider does the OAuth 2.0 flow of GitHub, which has no OpenID
+// Connect: the user and the email addresses come from the API.
+type GitHubProvider struct {
+	clientID     string
+	clientSecret string
+}
+
+func NewGitHubProvider(clientID string, clientSecret string) Provider {
+	return &GitHubProvider{clientID: clientID, clientSecret: clientSecret}
+}
+
+func (p *GitHubProvider) Name() string {
+	return GitHub
+}
+
+func (p *GitHubProvider) AuthCodeURL(ctx context.Context, request AuthRequest) (string, error) {
+	return authCodeURL(gitHubAuthorizeURL, url.Values{
+		"client_id":             {p.clientID},
+		"redirect_uri":          {request.RedirectURI},
+		"scope":                 {"read:user user:email"},
+		"state":                 {request.State},
+		"code_challenge":        {request.CodeChallenge},
+		"code_challenge_method": {"S256"},
+		"allow_signup":          {"true"},
+	})
+}
+
+func (p *GitHubProvider) Exchange(ctx context.Context, code string, request AuthRequest) (*Identity, error) {
+	token, err := exchangeCode(ctx, gitHubTokenURL, url.Values{
+		"code":          {code},
+		"redirect_uri":  {request.RedirectURI},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+		"code_verifier": {request.CodeVerifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user := struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}{}
+	if err := getJSON(ctx, gitHubAPIURL+"/user", token.AccessToken, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("social: GitHub returned no user id")
+	}
+
+	identity := &Identity{
+		Provider: GitHub,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Name:     user.Name,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+
+	// The public email of the profile may be unset or unverified, the
+	// primary address is what GitHub mails to.
+	emails := []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}{}
+	if err := getJSON(ctx, gitHubAPIURL+"/user/emails", token.AccessToken, &emails); err != nil {
+		return nil, err
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+			identity.PrivateEmail = strings.HasSuffix(strings.ToLower(email.Email), "@users.noreply.github.com")
+			break
+		}
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,87 @@
+package social
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// mockGitHub serves the token endpoint and the user API of GitHub.
+func mockGitHub(t *testing.T, emails []map[string]interface{}) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "code" || r.PostFormValue("code_verifier") != "verifier" || r.PostFormValue("client_secret") != "secret" {
+			json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "bearer"})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Bad credentials"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 42, "login": "octocat"})
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(emails)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	tokenURL, apiURL := gitHubTokenURL, gitHubAPIURL
+	gitHubTokenURL, gitHubAPIURL = server.URL+"/login/oauth/access_token", server.URL
+	t.Cleanup(func() { gitHubTokenURL, gitHubAPIURL = tokenURL, apiURL })
+}
+
+func TestGitHubExchange(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		emails []map[string]interface{}
+		want   Identity
+	}{
+		{
+			name: "primary verified",
+			emails: []map[string]interface{}{
+				{"email": "old@example.com", "primary": false, "verified": true},
+				{"email": "octo@example.com", "primary": true, "verified": true},
+			},
+			want: Identity{Provider: GitHub, Subject: "42", Name: "octocat", Email: "octo@example.com", EmailVerified: true},
+		},
+		{
+			name:   "primary unverified",
+			emails: []map[string]interface{}{{"email": "octo@example.com", "primary": true, "verified": false}},
+			want:   Identity{Provider: GitHub, Subject: "42", Name: "octocat", Email: "octo@example.com"},
+		},
+		{
+			name:   "noreply",
+			emails: []map[string]interface{}{{"email": "42+octocat@users.noreply.github.com", "primary": true, "verified": true}},
+			want:   Identity{Provider: GitHub, Subject: "42", Name: "octocat", Email: "42+octocat@users.noreply.github.com", EmailVerified: true, PrivateEmail: true},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mockGitHub(t, test.emails)
+
+			identity, err := NewGitHubProvider("client", "secret").Exchange(context.Background(), "code", AuthRequest{CodeVerifier: "verifier"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *identity != test.want {
+				t.Fatalf("identity = %+v, want %+v", *identity, test.want)
+			}
+		})
+	}
+}
+
+func TestGitHubExchangeRefusesBadCode(t *testing.T) {
+	mockGitHub(t, nil)
+
+	if _, err := NewGitHubProvider("client", "secret").Exchange(context.Background(), "stolen", AuthRequest{CodeVerifier: "verifier"}); err == nil {
+		t.Fatal("bad code accepted")
+	}
+}
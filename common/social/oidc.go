@@ -0,0 +1,378 @@
+package social
+
+import (
+	"auth/common/utils"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// jwksRefreshInterval limits how often an unknown kid makes the provider
+// fetch its keys again.
+const jwksRefreshInterval = time.Minute
+
+// idTokenAlgorithms are the signing algorithms accepted for ID tokens. "none"
+// and the HMAC algorithms never are.
+var idTokenAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OIDCProvider does the authorization code flow with any OpenID Connect
+// provider. Endpoints and keys come from the discovery document of the
+// issuer, and the user is taken from the verified ID token.
+type OIDCProvider struct {
+	name     string
+	issuer   string
+	issuers  []string
+	clientID string
+	scopes   []string
+	pkce     bool
+	// clientSecret returns the secret sent to the token endpoint, or "" for
+	// public clients.
+	clientSecret func() (string, error)
+	// authParams are added to every authorization request.
+	authParams url.Values
+
+	mu            sync.Mutex
+	discovery     *discoveryDocument
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCProvider returns a provider for the issuer. Without scopes it asks
+// for "openid email profile".
+func NewOIDCProvider(name string, issuer string, clientID string, clientSecret string, scopes []string) Provider {
+	return newOIDCProvider(name, issuer, clientID, clientSecret, scopes)
+}
+
+func newOIDCProvider(name string, issuer string, clientID string, clientSecret string, scopes []string) *OIDCProvider {
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	provider := &OIDCProvider{
+		name:         name,
+		issuer:       issuer,
+		issuers:      []string{issuer},
+		clientID:     clientID,
+		scopes:       scopes,
+		pkce:         true,
+		clientSecret: func() (string, error) { return clientSecret, nil },
+	}
+	// Google documents both forms of its issuer.
+	if issuer == "https://accounts.google.com" {
+		provider.issuers = append(provider.issuers, "accounts.google.com")
+	}
+
+	return provider
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.name
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, request AuthRequest) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.clientID},
+		"redirect_uri":  {request.RedirectURI},
+		"scope":         {strings.Join(p.scopes, " ")},
+		"state":         {request.State},
+		"nonce":         {request.Nonce},
+	}
+	if p.pkce {
+		params.Set("code_challenge", request.CodeChallenge)
+		params.Set("code_challenge_method", "S256")
+	}
+	for key, values := range p.authParams {
+		params[key] = values
+	}
+
+	return authCodeURL(discovery.AuthorizationEndpoint, params)
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, request AuthRequest) (*Identity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {request.RedirectURI},
+		"client_id":    {p.clientID},
+	}
+	if p.pkce {
+		form.Set("code_verifier", request.CodeVerifier)
+	}
+	secret, err := p.clientSecret()
+	if err != nil {
+		return nil, err
+	}
+	if secret != "" {
+		form.Set("client_secret", secret)
+	}
+
+	token, err := exchangeCode(ctx, discovery.TokenEndpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("social: %s returned no id token", p.name)
+	}
+
+	claims, err := p.verifyIDToken(ctx, token.IDToken, request.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider:      p.name,
+		Subject:       stringClaim(claims["sub"]),
+		Email:         stringClaim(claims["email"]),
+		EmailVerified: boolClaim(claims["email_verified"]),
+		PrivateEmail:  boolClaim(claims["is_private_email"]),
+		Name:          stringClaim(claims["name"]),
+	}
+
+	// Some providers keep the email out of the ID token.
+	if identity.Email == "" && discovery.UserInfoEndpoint != "" {
+		userInfo := map[string]interface{}{}
+		if err := getJSON(ctx, discovery.UserInfoEndpoint, token.AccessToken, &userInfo); err != nil {
+			return nil, err
+		}
+		if stringClaim(userInfo["sub"]) != identity.Subject {
+			return nil, fmt.Errorf("social: userinfo of %s belongs to another subject", p.name)
+		}
+		identity.Email = stringClaim(userInfo["email"])
+		identity.EmailVerified = boolClaim(userInfo["email_verified"])
+		if identity.Name == "" {
+			identity.Name = stringClaim(userInfo["name"])
+		}
+	}
+
+	return identity, nil
+}
+
+// verifyIDToken checks signature, issuer, audience, expiry and nonce of an
+// ID token and returns its claims.
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, raw string, nonce string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		if !contains(idTokenAlgorithms, token.Method.Alg()) {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+	if !contains(p.issuers, stringClaim(claims["iss"])) {
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidIDToken, claims["iss"])
+	}
+	if !claims.VerifyAudience(p.clientID, true) {
+		return nil, fmt.Errorf("%w: audience", ErrInvalidIDToken)
+	}
+	if azp := stringClaim(claims["azp"]); azp != "" && azp != p.clientID {
+		return nil, fmt.Errorf("%w: authorized party %q", ErrInvalidIDToken, azp)
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(stringClaim(claims["nonce"])), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce", ErrInvalidIDToken)
+	}
+	if stringClaim(claims["sub"]) == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+// discover fetches the discovery document once.
+func (p *OIDCProvider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discovery := &discoveryDocument{}
+	if err := getJSON(ctx, p.issuer+"/.well-known/openid-configuration", "", discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("social: discovery document of %s names issuer %q", p.issuer, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, fmt.Errorf("social: discovery document of %s is incomplete", p.issuer)
+	}
+
+	p.discovery = discovery
+	return discovery, nil
+}
+
+// publicKey returns the signing key with the kid, fetching the key set again
+// when the kid is unknown, as after a key rotation of the provider.
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	set := utils.JSONWebKeySet{}
+	if err := getJSON(ctx, discovery.JwksURI, "", &set); err != nil {
+		return nil, err
+	}
+	p.keysFetchedAt = time.Now()
+	p.keys = map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJSONWebKey(jwk)
+		if err != nil {
+			continue
+		}
+		p.keys[jwk.Kid] = key
+	}
+
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// findKey looks the kid up in the cached keys. Tokens without a kid are only
+// accepted from providers with a single key.
+func (p *OIDCProvider) findKey(kid string) crypto.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+func parseJSONWebKey(jwk utils.JSONWebKey) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent out of range")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return key, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+func stringClaim(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+// boolClaim reads a boolean claim. Apple sends them as strings.
+func boolClaim(value interface{}) bool {
+	switch value := value.(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package social
+
+import (
+	"auth/common/social/socialtest"
+	"auth/common/utils"
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func testProvider(issuer *socialtest.Issuer) *OIDCProvider {
+	return newOIDCProvider("test", issuer.URL, socialtest.ClientID, "secret", nil)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := socialtest.NewIssuer(t)
+
+	for _, test := range []struct {
+		name   string
+		change func(claims jwt.MapClaims)
+		valid  bool
+	}{
+		{name: "valid", change: func(claims jwt.MapClaims) {}, valid: true},
+		{name: "several audiences", change: func(claims jwt.MapClaims) {
+			claims["aud"] = []string{socialtest.ClientID, "other-client"}
+			claims["azp"] = socialtest.ClientID
+		}, valid: true},
+		{name: "wrong audience", change: func(claims jwt.MapClaims) { claims["aud"] = "other-client" }},
+		{name: "no audience", change: func(claims jwt.MapClaims) { delete(claims, "aud") }},
+		{name: "wrong authorized party", change: func(claims jwt.MapClaims) {
+			claims["aud"] = []string{socialtest.ClientID, "other-client"}
+			claims["azp"] = "other-client"
+		}},
+		{name: "wrong nonce", change: func(claims jwt.MapClaims) { claims["nonce"] = "other-nonce" }},
+		{name: "no nonce", change: func(claims jwt.MapClaims) { delete(claims, "nonce") }},
+		{name: "expired", change: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{name: "no expiry", change: func(claims jwt.MapClaims) { delete(claims, "exp") }},
+		{name: "wrong issuer", change: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" }},
+		{name: "no subject", change: func(claims jwt.MapClaims) { delete(claims, "sub") }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			claims := issuer.Claims("alice", "nonce")
+			test.change(claims)
+
+			_, err := testProvider(issuer).verifyIDToken(context.Background(), issuer.Sign(t, claims), "nonce")
+			if test.valid && err != nil {
+				t.Fatalf("valid token refused: %v", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("got %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRefusesAlgorithms(t *testing.T) {
+	issuer := socialtest.NewIssuer(t)
+	claims := issuer.Claims("alice", "nonce")
+
+	// The client secret is known to the client, an HMAC token made with it
+	// must not pass as one of the provider.
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmacToken.Header["kid"] = "key-1"
+	signedHMAC, err := hmacToken.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noneToken := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	noneToken.Header["kid"] = "key-1"
+	signedNone, err := noneToken.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, raw := range map[string]string{"HS256": signedHMAC, "none": signedNone} {
+		if _, err := testProvider(issuer).verifyIDToken(context.Background(), raw, "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: got %v, want ErrInvalidIDToken", name, err)
+		}
+	}
+}
+
+func TestUnknownKeyFetchesKeySetAgain(t *testing.T) {
+	issuer := socialtest.NewIssuer(t)
+	provider := testProvider(issuer)
+	ctx := context.Background()
+
+	if _, err := provider.verifyIDToken(ctx, issuer.Sign(t, issuer.Claims("alice", "nonce")), "nonce"); err != nil {
+		t.Fatal(err)
+	}
+	if fetches := issuer.JWKSFetches(); fetches != 1 {
+		t.Fatalf("key set fetched %d times, want 1", fetches)
+	}
+
+	// The provider rotated its key. Right after a fetch the unknown kid is
+	// refused without asking again.
+	issuer.AddKey(t, "key-2")
+	rotated := issuer.Sign(t, issuer.Claims("alice", "nonce"))
+	if _, err := provider.verifyIDToken(ctx, rotated, "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("got %v, want ErrInvalidIDToken", err)
+	}
+	if fetches := issuer.JWKSFetches(); fetches != 1 {
+		t.Fatalf("key set fetched %d times within the refresh interval", fetches)
+	}
+
+	provider.keysFetchedAt = time.Now().Add(-jwksRefreshInterval)
+	if _, err := provider.verifyIDToken(ctx, rotated, "nonce"); err != nil {
+		t.Fatalf("token of the new key refused: %v", err)
+	}
+	if fetches := issuer.JWKSFetches(); fetches != 2 {
+		t.Fatalf("key set fetched %d times, want 2", fetches)
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	issuer := socialtest.NewIssuer(t)
+	provider := testProvider(issuer)
+	ctx := context.Background()
+	request := AuthRequest{RedirectURI: "https://app.example.com/callback", State: "state", Nonce: "nonce", CodeChallenge: "challenge", CodeVerifier: "verifier"}
+
+	link, err := provider.AuthCodeURL(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	for key, want := range map[string]string{
+		"client_id":             socialtest.ClientID,
+		"redirect_uri":          request.RedirectURI,
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        "challenge",
+		"code_challenge_method": "S256",
+		"scope":                 "openid email profile",
+	} {
+		if got := query.Get(key); got != want {
+			t.Errorf("authorization url %s = %q, want %q", key, got, want)
+		}
+	}
+
+	claims := issuer.Claims("alice", "nonce")
+	claims["email"] = "Alice@Example.com"
+	claims["email_verified"] = true
+	claims["name"] = "Alice"
+	issuer.SetIDToken(issuer.Sign(t, claims))
+
+	identity, err := provider.Exchange(ctx, "code", request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Provider: "test", Subject: "alice", Email: "Alice@Example.com", EmailVerified: true, Name: "Alice"}
+	if *identity != want {
+		t.Fatalf("identity = %+v, want %+v", *identity, want)
+	}
+
+	form := issuer.TokenForm()
+	for key, want := range map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          "code",
+		"redirect_uri":  request.RedirectURI,
+		"code_verifier": "verifier",
+		"client_secret": "secret",
+	} {
+		if got := form.Get(key); got != want {
+			t.Errorf("token request %s = %q, want %q", key, got, want)
+		}
+	}
+
+	// A token from another login must not be accepted for this one.
+	if _, err := provider.Exchange(ctx, "code", AuthRequest{RedirectURI: request.RedirectURI, Nonce: "other-nonce"}); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("got %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestOIDCExchangeReadsEmailFromUserInfo(t *testing.T) {
+	issuer := socialtest.NewIssuer(t)
+	provider := testProvider(issuer)
+	issuer.SetIDToken(issuer.Sign(t, issuer.Claims("alice", "nonce")))
+
+	issuer.SetUserInfo(map[string]interface{}{"sub": "alice", "email": "alice@example.com", "email_verified": true, "name": "Alice"})
+	identity, err := provider.Exchange(context.Background(), "code", AuthRequest{Nonce: "nonce"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Email != "alice@example.com" || !identity.EmailVerified || identity.Name != "Alice" {
+		t.Fatalf("identity = %+v", *identity)
+	}
+
+	issuer.SetUserInfo(map[string]interface{}{"sub": "mallory", "email": "mallory@example.com"})
+	if _, err := provider.Exchange(context.Background(), "code", AuthRequest{Nonce: "nonce"}); err == nil {
+		t.Fatal("userinfo of another subject accepted")
+	}
+}
+
+func TestParseJSONWebKeyRefusesBadKeys(t *testing.T) {
+	for name, jwk := range map[string]utils.JSONWebKey{
+		"unknown type":    {Kty: "oct"},
+		"unknown curve":   {Kty: "EC", Crv: "P-192", X: "AA", Y: "AA"},
+		"point off curve": {Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"},
+		"bad base64":      {Kty: "EC", Crv: "P-256", X: "!!", Y: "AQ"},
+		"short ed25519":   {Kty: "OKP", Crv: "Ed25519", X: "AQ"},
+		"x25519":          {Kty: "OKP", Crv: "X25519", X: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"},
+		"huge exponent":   {Kty: "RSA", N: "AQAB", E: "AQAAAAAAAAAA"},
+	} {
+		if _, err := parseJSONWebKey(jwk); err == nil {
+			t.Errorf("%s: key accepted", name)
+		}
+	}
+}
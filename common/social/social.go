@@ -0,0 +1,194 @@
+package social
+
+import (
+	"auth/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Provider names, they are also the :provider of the routes and the value
+// stored with every identity.
+const (
+	Google = "google"
+	GitHub = "github"
+	Apple  = "apple"
+)
+
+var (
+	// ErrInvalidIDToken is returned for ID tokens with a bad signature, issuer,
+	// audience, nonce or expiry.
+	ErrInvalidIDToken = errors.New("social: invalid id token")
+)
+
+// Identity is what a provider tells about the user who logged in. Subject is
+// the stable id of the account at the provider; the email may change.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// PrivateEmail marks relay addresses such as the ones of Sign in with
+	// Apple's "Hide My Email" and GitHub's noreply addresses.
+	PrivateEmail bool
+	Name         string
+}
+
+// AuthRequest carries the values of one authorization request. The same
+// values have to be passed again to Exchange.
+type AuthRequest struct {
+	RedirectURI   string
+	State         string
+	Nonce         string
+	CodeChallenge string
+	CodeVerifier  string
+}
+
+// Provider is an external identity provider doing the OAuth 2.0 authorization
+// code flow.
+type Provider interface {
+	Name() string
+	AuthCodeURL(ctx context.Context, request AuthRequest) (string, error)
+	Exchange(ctx context.Context, code string, request AuthRequest) (*Identity, error)
+}
+
+// NewProviders returns every provider that has a client id configured, keyed
+// by name.
+func NewProviders() (map[string]Provider, error) {
+	providers := map[string]Provider{}
+
+	if config.Config.GoogleClientID != "" {
+		providers[Google] = NewOIDCProvider(Google, "https://accounts.google.com", config.Config.GoogleClientID, config.Config.GoogleClientSecret, nil)
+	}
+	if config.Config.GitHubClientID != "" {
+		providers[GitHub] = NewGitHubProvider(config.Config.GitHubClientID, config.Config.GitHubClientSecret)
+	}
+	if config.Config.AppleClientID != "" {
+		privateKey, err := os.ReadFile(config.Config.ApplePrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("social: read APPLE_PRIVATE_KEY_FILE: %w", err)
+		}
+		provider, err := NewAppleProvider(config.Config.AppleClientID, config.Config.AppleTeamID, config.Config.AppleKeyID, privateKey)
+		if err != nil {
+			return nil, err
+		}
+		providers[Apple] = provider
+	}
+	if config.Config.OIDCClientID != "" {
+		name := oidcProviderName()
+		if _, taken := providers[name]; taken {
+			return nil, fmt.Errorf("social: OIDC_PROVIDER_NAME %q is already used", name)
+		}
+		if config.Config.OIDCIssuer == "" {
+			return nil, errors.New("social: OIDC_ISSUER is not set")
+		}
+		providers[name] = NewOIDCProvider(name, config.Config.OIDCIssuer, config.Config.OIDCClientID, config.Config.OIDCClientSecret, strings.Fields(config.Config.OIDCScopes))
+	}
+
+	return providers, nil
+}
+
+func oidcProviderName() string {
+	if config.Config.OIDCProviderName != "" {
+		return strings.ToLower(config.Config.OIDCProviderName)
+	}
+	return "oidc"
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// tokenResponse is the answer of a token endpoint (RFC 6749 section 5.1).
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode redeems an authorization code at the token endpoint.
+func exchangeCode(ctx context.Context, tokenURL string, form url.Values) (*tokenResponse, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	token := &tokenResponse{}
+	status, err := doJSON(request, token)
+	if err != nil {
+		return nil, err
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("social: token endpoint answered %s: %s", token.Error, token.ErrorDescription)
+	}
+	if status/100 != 2 || token.AccessToken == "" {
+		return nil, fmt.Errorf("social: token endpoint answered %d without a token", status)
+	}
+
+	return token, nil
+}
+
+// getJSON fetches url, with the access token if one is given.
+func getJSON(ctx context.Context, url string, accessToken string, out interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	status, err := doJSON(request, out)
+	if err != nil {
+		return err
+	}
+	if status/100 != 2 {
+		return fmt.Errorf("social: %s answered %d", url, status)
+	}
+	return nil
+}
+
+func doJSON(request *http.Request, out interface{}) (int, error) {
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return response.StatusCode, fmt.Errorf("social: %s answered %d with no JSON", request.URL, response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+func authCodeURL(endpoint string, params url.Values) (string, error) {
+	link, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := link.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	link.RawQuery = query.Encode()
+
+	return link.String(), nil
+}
@@ -0,0 +1,181 @@
+// Package socialtest runs a local OpenID Connect provider for tests of the
+// social logins.
+package socialtest
+
+import (
+	"auth/common/utils"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// ClientID is the client the issuer issues its ID tokens to.
+const ClientID = "test-client"
+
+// Issuer serves discovery, JWKS, token and userinfo endpoints. The token
+// endpoint answers every code with IDToken.
+type Issuer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	keys        []*utils.Key
+	jwksFetches int
+	idToken     string
+	userInfo    map[string]interface{}
+	tokenForm   url.Values
+}
+
+// NewIssuer starts an issuer with one ES256 key, closed when the test ends.
+func NewIssuer(t *testing.T) *Issuer {
+	t.Helper()
+
+	issuer := &Issuer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/token", issuer.token)
+	mux.HandleFunc("/userinfo", issuer.userinfo)
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+
+	issuer.AddKey(t, "key-1")
+	return issuer
+}
+
+// AddKey publishes a new ES256 key, which signs from now on.
+func (i *Issuer) AddKey(t *testing.T, kid string) *utils.Key {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &utils.Key{ID: kid, Method: jwt.SigningMethodES256, PrivateKey: privateKey, PublicKey: &privateKey.PublicKey}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys = append(i.keys, key)
+	return key
+}
+
+// Claims returns valid ID token claims for the subject.
+func (i *Issuer) Claims(subject string, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   i.URL,
+		"aud":   ClientID,
+		"sub":   subject,
+		"nonce": nonce,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+}
+
+// Sign signs the claims with the newest key.
+func (i *Issuer) Sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	i.mu.Lock()
+	key := i.keys[len(i.keys)-1]
+	i.mu.Unlock()
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// SetIDToken sets the ID token the token endpoint answers with.
+func (i *Issuer) SetIDToken(idToken string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.idToken = idToken
+}
+
+// SetUserInfo sets the claims of the userinfo endpoint.
+func (i *Issuer) SetUserInfo(claims map[string]interface{}) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.userInfo = claims
+}
+
+// TokenForm returns the form of the last token request.
+func (i *Issuer) TokenForm() url.Values {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.tokenForm
+}
+
+// JWKSFetches counts the requests for the key set.
+func (i *Issuer) JWKSFetches() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.jwksFetches
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"userinfo_endpoint":      i.URL + "/userinfo",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.jwksFetches++
+	set := utils.JSONWebKeySet{Keys: []utils.JSONWebKey{}}
+	for _, key := range i.keys {
+		set.Keys = append(set.Keys, key.JSONWebKey())
+	}
+	writeJSON(w, http.StatusOK, set)
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("code") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.tokenForm = r.PostForm
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-" + r.PostForm.Get("code"),
+		"token_type":   "Bearer",
+		"id_token":     i.idToken,
+	})
+}
+
+func (i *Issuer) userinfo(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.userInfo == nil || r.Header.Get("Authorization") == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, i.userInfo)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
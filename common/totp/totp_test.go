@@ -0,0 +1,87 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the test vectors of RFC 6238 appendix B,
+// the ASCII string "12345678901234567890".
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// The RFC lists 8 digit codes; the 6 digit codes are their last six digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		want := vector.code[len(vector.code)-Digits:]
+		got, err := Code(rfc6238Secret, time.Unix(vector.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Code at %d = %s, want %s", vector.unix, got, want)
+		}
+	}
+}
+
+func TestValidateRFC6238(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		now := time.Unix(vector.unix, 0)
+		step, ok := Validate(rfc6238Secret, vector.code[len(vector.code)-Digits:], now)
+		if !ok {
+			t.Errorf("Validate at %d refused the RFC code", vector.unix)
+			continue
+		}
+		if want := vector.unix / 30; step != want {
+			t.Errorf("Validate at %d matched step %d, want %d", vector.unix, step, want)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	current := now.Unix() / 30
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code, err := Code(rfc6238Secret, now.Add(time.Duration(offset)*Period))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		step, ok := Validate(rfc6238Secret, code, now)
+		if want := offset >= -skew && offset <= skew; ok != want {
+			t.Errorf("code of step %+d: accepted = %v, want %v", offset, ok, want)
+		}
+		if ok && step != current+offset {
+			t.Errorf("code of step %+d matched step %d, want %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	for _, code := range []string{"", "28708", "2870822", "abcdef"} {
+		if _, ok := Validate(rfc6238Secret, code, now); ok {
+			t.Errorf("Validate accepted %q", code)
+		}
+	}
+	if _, ok := Validate(rfc6238Secret, " 287 082 ", now); !ok {
+		t.Error("Validate refused a code with spaces")
+	}
+	if _, ok := Validate("not base32!", "287082", now); ok {
+		t.Error("Validate accepted an invalid secret")
+	}
+}
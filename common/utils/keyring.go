@@ -0,0 +1,402 @@
+package utils
+
+import (
+	"auth/common/logger"
+	"auth/config"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// ActiveKeyFile is the file inside a key directory holding the kid of the key
+// new tokens are signed with.
+const ActiveKeyFile = "active_kid"
+
+var (
+	AccessTokenKeys  *KeyRing
+	RefreshTokenKeys *KeyRing
+	// ActionTokenKeys signs the single-purpose tokens of mails and login
+	// challenges. Its key is derived from APP_KEY and never published.
+	ActionTokenKeys *KeyRing
+)
+
+// Key is a single entry of a KeyRing. PrivateKey is nil for keys that are only
+// kept around to verify tokens that were signed before a rotation. The
+// signing method follows from the key type: RSA keys sign RS256, P-256 keys
+// ES256 and Ed25519 keys EdDSA.
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+// KeyRing holds every key that is currently accepted for verification plus the
+// one key new tokens are signed with. Keys are read from a directory of
+// "<kid>.pem" files; the legacy base64 key pair from the config is always kept
+// in the ring so tokens issued before the directory was used stay valid.
+type KeyRing struct {
+	mu           sync.RWMutex
+	dir          string
+	legacyKeyID  string
+	signingKeyID string
+	keys         map[string]*Key
+
+	legacyPrivateKey string
+	legacyPublicKey  string
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func NewKeyRing(dir string, legacyPrivateKey string, legacyPublicKey string) (*KeyRing, error) {
+	ring := &KeyRing{dir: dir, legacyPrivateKey: legacyPrivateKey, legacyPublicKey: legacyPublicKey}
+	if err := ring.Load(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// InitKeyRings builds the access, refresh and action token key rings from
+// the config.
+func InitKeyRings() error {
+	if config.Config.AppKey == "" {
+		return errors.New("APP_KEY is not set")
+	}
+	ActionTokenKeys = newSecretKeyRing("action", AppKey("action tokens"))
+
+	var err error
+	AccessTokenKeys, err = NewKeyRing(config.Config.AccessTokenKeysDir, config.Config.AccessTokenPrivateKey, config.Config.AccessTokenPublicKey)
+	if err != nil {
+		return fmt.Errorf("access token keys: %w", err)
+	}
+
+	RefreshTokenKeys, err = NewKeyRing(config.Config.RefreshTokenKeysDir, config.Config.RefreshTokenPrivateKey, config.Config.RefreshTokenPublicKey)
+	if err != nil {
+		return fmt.Errorf("refresh token keys: %w", err)
+	}
+
+	return nil
+}
+
+// AppKey derives the key for one purpose from APP_KEY, so the same secret is
+// never used for two things.
+func AppKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(config.Config.AppKey))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// newSecretKeyRing returns a ring holding a single HMAC key, for tokens only
+// this service reads. It is not reloaded.
+func newSecretKeyRing(kid string, secret []byte) *KeyRing {
+	key := &Key{ID: kid, Method: jwt.SigningMethodHS256, PrivateKey: secret, PublicKey: secret}
+	return &KeyRing{keys: map[string]*Key{kid: key}, legacyKeyID: kid, signingKeyID: kid}
+}
+
+// WatchKeyRings reloads the key rings every interval and whenever the process
+// receives SIGHUP, so keys can be added or retired without a restart.
+func WatchKeyRings(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-hup:
+			logger.LogInfo("SIGHUP received, reloading token keys")
+		}
+
+		for _, ring := range []*KeyRing{AccessTokenKeys, RefreshTokenKeys} {
+			if err := ring.Load(); err != nil {
+				logger.LogError("failed to reload token keys, keeping the previous ones: ", err)
+			}
+		}
+	}
+}
+
+// Load (re)reads all keys. On failure the ring keeps its previous keys.
+func (k *KeyRing) Load() error {
+	keys := map[string]*Key{}
+	legacyKeyID := ""
+	signingKeyID := ""
+
+	if k.legacyPrivateKey != "" || k.legacyPublicKey != "" {
+		key, err := parseLegacyKey(k.legacyPrivateKey, k.legacyPublicKey)
+		if err != nil {
+			return err
+		}
+		keys[key.ID] = key
+		legacyKeyID = key.ID
+		signingKeyID = key.ID
+	}
+
+	if k.dir != "" {
+		files, err := filepath.Glob(filepath.Join(k.dir, "*.pem"))
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+
+			key, err := parsePEMKey(kid, data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			keys[kid] = key
+		}
+
+		active, err := os.ReadFile(filepath.Join(k.dir, ActiveKeyFile))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if activeKeyID := strings.TrimSpace(string(active)); activeKeyID != "" {
+			signingKeyID = activeKeyID
+		}
+	}
+
+	if len(keys) == 0 {
+		return errors.New("no token keys configured")
+	}
+
+	if signingKey, ok := keys[signingKeyID]; !ok || signingKey.PrivateKey == nil {
+		return fmt.Errorf("signing key %q not found or has no private key", signingKeyID)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.legacyKeyID = legacyKeyID
+	k.signingKeyID = signingKeyID
+
+	return nil
+}
+
+// SigningKey returns the key new tokens have to be signed with.
+func (k *KeyRing) SigningKey() *Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[k.signingKeyID]
+}
+
+// VerificationKey returns the key referenced by kid. Tokens without a kid were
+// issued before key rotation existed and are checked against the legacy key.
+func (k *KeyRing) VerificationKey(kid string) (*Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if kid == "" {
+		kid = k.legacyKeyID
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// Algorithms returns the distinct signing algorithms of the ring's keys.
+func (k *KeyRing) Algorithms() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	seen := map[string]bool{}
+	algs := []string{}
+	for _, key := range k.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	sort.Strings(algs)
+
+	return algs
+}
+
+// JWKS returns the public part of every key of the ring.
+func (k *KeyRing) JWKS() JSONWebKeySet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range k.keys {
+		set.Keys = append(set.Keys, key.JSONWebKey())
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
+
+// JSONWebKey returns the public key in JWK form (RFC 7517, RFC 8037).
+func (key *Key) JSONWebKey() JSONWebKey {
+	jwk := JSONWebKey{Use: "sig", Kid: key.ID, Alg: key.Method.Alg()}
+
+	switch publicKey := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = publicKey.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(publicKey.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	}
+
+	return jwk
+}
+
+func parseLegacyKey(privateKey string, publicKey string) (*Key, error) {
+	var key *Key
+
+	for _, encoded := range []string{privateKey, publicKey} {
+		if encoded == "" {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode key: %w", err)
+		}
+		parsed, err := parsePEMKey("", decoded)
+		if err != nil {
+			return nil, fmt.Errorf("parse key: %w", err)
+		}
+
+		if key == nil {
+			key = parsed
+			continue
+		}
+		if parsed.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("public and private key types differ")
+		}
+		key.PublicKey = parsed.PublicKey
+	}
+
+	kid, err := keyThumbprint(key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = kid
+
+	return key, nil
+}
+
+// parsePEMKey reads a PKCS#1, PKCS#8, SEC 1 or PKIX encoded key.
+func parsePEMKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &Key{ID: kid}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key.PrivateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key.PrivateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key.PrivateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key.PublicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key.PublicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if signer, ok := key.PrivateKey.(crypto.Signer); ok {
+		key.PublicKey = signer.Public()
+	}
+
+	key.Method, err = signingMethod(key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// signingMethod pins the algorithm a key is used with.
+func signingMethod(publicKey crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		if publicKey.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported curve %s, only P-256 is allowed", publicKey.Curve.Params().Name)
+		}
+		return jwt.SigningMethodES256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %T", publicKey)
+}
+
+// keyThumbprint derives a stable kid from the public key.
+func keyThumbprint(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
@@ -2,15 +2,25 @@ package utils
 
 import (
 	"auth/common/logger"
-	"encoding/base64"
+	passwordhash "auth/common/password"
+	"auth/config"
+	"auth/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
 )
 
+var errPasswordMismatch = errors.New("password does not match")
+
 func CopyStructToStruct(input interface{}, output interface{}) error {
 	if byteData, err := json.Marshal(input); err == nil {
 		if err := json.Unmarshal(byteData, &output); err != nil {
@@ -23,37 +33,134 @@ func CopyStructToStruct(input interface{}, output interface{}) error {
 	}
 }
 
-func HashPassword(password string) string {
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hashedPassword)
+// GenerateRandomString returns a hex encoded string built from n random bytes.
+func GenerateRandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashPassword hashes the password with the configured hasher.
+func HashPassword(password string) (string, error) {
+	return passwordhash.Hash(password)
 }
 
+// ComparePassword checks the candidate against a hash of any supported
+// scheme.
 func ComparePassword(hashedPassword string, candidatePassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(candidatePassword))
+	ok, err := passwordhash.Verify(hashedPassword, candidatePassword)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errPasswordMismatch
+	}
+	return nil
+}
+
+// PasswordNeedsRehash reports whether the hash was made with an older scheme
+// or other parameters than new hashes are.
+func PasswordNeedsRehash(hashedPassword string) bool {
+	return passwordhash.NeedsRehash(hashedPassword)
+}
+
+// clientSecretPrefix marks client secret hashes made by HashClientSecret.
+const clientSecretPrefix = "hmac-sha256$"
+
+// HashClientSecret hashes a generated client secret with a key derived from
+// APP_KEY. The secrets are long and random, so a keyed SHA-256 is as good as
+// a password hash and keeps every token request cheap. User passwords go
+// through HashPassword.
+func HashClientSecret(secret string) string {
+	mac := hmac.New(sha256.New, AppKey("client secrets"))
+	mac.Write([]byte(secret))
+	return clientSecretPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// CompareClientSecret checks the candidate in constant time.
+func CompareClientSecret(hashedSecret string, candidateSecret string) error {
+	if subtle.ConstantTimeCompare([]byte(HashClientSecret(candidateSecret)), []byte(hashedSecret)) != 1 {
+		return errPasswordMismatch
+	}
+	return nil
 }
 
-func CreateToken(ttl time.Duration, payload interface{}, privateKey string) (string, error) {
-	decodedPrivateKey, err := base64.StdEncoding.DecodeString(privateKey)
+// CreateToken signs the claims with the signing key of the ring and records
+// the key id in the "kid" header. Issuer, audience, token id and the time
+// based claims are always set by the function. The random token id keeps two
+// tokens issued in the same second apart, refresh token rotation relies on it.
+func CreateToken(ttl time.Duration, claims models.Claims, keys *KeyRing) (string, error) {
+	audience := models.Audience(nil)
+	if config.Config.TokenAudience != "" {
+		audience = models.Audience{config.Config.TokenAudience}
+	}
+	return createToken(ttl, claims, keys, audience)
+}
+
+// CreateActionToken signs a token that lets its holder do the single thing
+// named by claims.Purpose. Action tokens are signed with ActionTokenKeys,
+// whose key is not published, and are meant for an audience of their own so
+// they can never pass as access tokens.
+func CreateActionToken(ttl time.Duration, claims models.Claims) (string, error) {
+	if claims.Purpose == "" {
+		return "", fmt.Errorf("create: action token without purpose")
+	}
+	return createToken(ttl, claims, ActionTokenKeys, models.Audience{actionTokenAudience()})
+}
+
+func createToken(ttl time.Duration, claims models.Claims, keys *KeyRing, audience models.Audience) (string, error) {
+	key := keys.SigningKey()
+	if key == nil {
+		return "", fmt.Errorf("create: no signing key")
+	}
+
+	tokenID, err := GenerateRandomString(16)
 	if err != nil {
-		logger.LogError(err)
-		return "", fmt.Errorf("could not decode key: %w", err)
+		return "", fmt.Errorf("create: %w", err)
+	}
+
+	now := time.Now().UTC()
+
+	claims.Issuer = issuer()
+	claims.Audience = audience
+	claims.ID = tokenID
+	claims.ExpiresAt = now.Add(ttl).Unix()
+	claims.IssuedAt = now.Unix()
+	claims.NotBefore = now.Unix()
+
+	return signToken(key, &claims)
+}
+
+// CreateTokenWithClaims signs arbitrary claims, it is used for tokens that are
+// not ours to validate such as ID tokens. The token id and the time based
+// claims are always set by the function.
+func CreateTokenWithClaims(ttl time.Duration, claims jwt.MapClaims, keys *KeyRing) (string, error) {
+	key := keys.SigningKey()
+	if key == nil {
+		return "", fmt.Errorf("create: no signing key")
 	}
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(decodedPrivateKey)
 
+	tokenID, err := GenerateRandomString(16)
 	if err != nil {
-		logger.LogError(err)
-		return "", fmt.Errorf("create: parse key: %w", err)
+		return "", fmt.Errorf("create: %w", err)
 	}
 
 	now := time.Now().UTC()
 
-	claims := make(jwt.MapClaims)
-	claims["sub"] = payload
+	claims["jti"] = tokenID
 	claims["exp"] = now.Add(ttl).Unix()
 	claims["iat"] = now.Unix()
 	claims["nbf"] = now.Unix()
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	return signToken(key, claims)
+}
+
+func signToken(key *Key, claims jwt.Claims) (string, error) {
+	jwtToken := jwt.NewWithClaims(key.Method, claims)
+	jwtToken.Header["kid"] = key.ID
+	token, err := jwtToken.SignedString(key.PrivateKey)
 
 	if err != nil {
 		logger.LogError(err)
@@ -63,26 +170,55 @@ func CreateToken(ttl time.Duration, payload interface{}, privateKey string) (str
 	return token, nil
 }
 
-func ValidateToken(token string, publicKey string) (interface{}, error) {
-
-	decodedPublicKey, err := base64.StdEncoding.DecodeString(publicKey)
+// ValidateToken verifies a token against the key ring and checks that it was
+// issued by us for the configured audience. Action tokens are refused.
+func ValidateToken(token string, keys *KeyRing) (*models.Claims, error) {
+	claims, err := parseToken(token, keys)
 	if err != nil {
-		return nil, fmt.Errorf("could not decode: %w", err)
+		return nil, err
+	}
+
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("validate: unexpected %s token", claims.Purpose)
+	}
+	if config.Config.TokenAudience != "" && !claims.Audience.Contains(config.Config.TokenAudience) {
+		return nil, fmt.Errorf("validate: token is not meant for %q", config.Config.TokenAudience)
 	}
 
-	key, err := jwt.ParseRSAPublicKeyFromPEM(decodedPublicKey)
+	return claims, nil
+}
 
+// ValidateActionToken verifies a token made by CreateActionToken for purpose.
+func ValidateActionToken(token string, purpose string) (*models.Claims, error) {
+	claims, err := parseToken(token, ActionTokenKeys)
 	if err != nil {
-		logger.LogError(err)
-		return "", fmt.Errorf("validate: parse key: %w", err)
+		return nil, err
+	}
+
+	if purpose == "" || claims.Purpose != purpose {
+		return nil, fmt.Errorf("validate: token is not meant for %q", purpose)
+	}
+	if !claims.Audience.Contains(actionTokenAudience()) {
+		return nil, fmt.Errorf("validate: token is not an action token")
 	}
 
-	parsedToken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
-			logger.LogError(err)
+	return claims, nil
+}
+
+func parseToken(token string, keys *KeyRing) (*models.Claims, error) {
+	claims := &models.Claims{}
+	parsedToken, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := keys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// The algorithm is taken from the key, never from the token header.
+		if t.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected method: %s", t.Header["alg"])
 		}
-		return key, nil
+		return key.PublicKey, nil
 	})
 
 	if err != nil {
@@ -90,10 +226,20 @@ func ValidateToken(token string, publicKey string) (interface{}, error) {
 		return nil, fmt.Errorf("validate: %w", err)
 	}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-	if !ok || !parsedToken.Valid {
+	if !parsedToken.Valid {
 		return nil, fmt.Errorf("validate: invalid token")
 	}
+	if claims.Issuer != issuer() {
+		return nil, fmt.Errorf("validate: unexpected issuer %q", claims.Issuer)
+	}
+
+	return claims, nil
+}
+
+func issuer() string {
+	return strings.TrimSuffix(config.Config.Issuer, "/")
+}
 
-	return claims["sub"], nil
+func actionTokenAudience() string {
+	return issuer() + "/actions"
 }
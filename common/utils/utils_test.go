@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"auth/common/logger"
+	"auth/config"
+	"auth/models"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestMain(m *testing.M) {
+	logger.NewLogger(nil)
+	os.Exit(m.Run())
+}
+
+func testKeyRing(t *testing.T) *KeyRing {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := &Key{ID: "test", Method: jwt.SigningMethodES256, PrivateKey: privateKey, PublicKey: &privateKey.PublicKey}
+	return &KeyRing{keys: map[string]*Key{key.ID: key}, signingKeyID: key.ID}
+}
+
+func TestCreateTokenIsUniqueWithinASecond(t *testing.T) {
+	keys := testKeyRing(t)
+	claims := models.Claims{Subject: "1", SessionID: "session"}
+
+	first, err := CreateToken(time.Hour, claims, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := CreateToken(time.Hour, claims, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first == second {
+		t.Fatal("two tokens with the same claims issued in the same second are identical")
+	}
+
+	parsed, err := ValidateToken(first, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.ID == "" {
+		t.Fatal("token has no jti")
+	}
+}
+
+func TestActionTokensAreNoAccessTokens(t *testing.T) {
+	config.Config.AppKey = "test"
+	ActionTokenKeys = newSecretKeyRing("action", AppKey("action tokens"))
+	keys := testKeyRing(t)
+
+	actionToken, err := CreateActionToken(time.Hour, models.Claims{Subject: "1", Purpose: "magic_link"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateActionToken(actionToken, "magic_link"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateActionToken(actionToken, "email_verification"); err == nil {
+		t.Fatal("action token accepted for another purpose")
+	}
+	if _, err := ValidateToken(actionToken, ActionTokenKeys); err == nil {
+		t.Fatal("action token accepted as access token")
+	}
+
+	// A token with a purpose signed by an access token key must not pass
+	// either way.
+	forged, err := CreateToken(time.Hour, models.Claims{Subject: "1", Purpose: "magic_link"}, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(forged, keys); err == nil {
+		t.Fatal("token with a purpose accepted as access token")
+	}
+	if _, err := ValidateActionToken(forged, "magic_link"); err == nil {
+		t.Fatal("access token key accepted for an action token")
+	}
+}
+
+func TestClientSecret(t *testing.T) {
+	config.Config.AppKey = "test"
+
+	hash := HashClientSecret("secret")
+	if err := CompareClientSecret(hash, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompareClientSecret(hash, "other"); err == nil {
+		t.Fatal("wrong secret accepted")
+	}
+	if err := CompareClientSecret("", "secret"); err == nil {
+		t.Fatal("secret accepted against an empty hash")
+	}
+
+	config.Config.AppKey = "another"
+	if err := CompareClientSecret(hash, "secret"); err == nil {
+		t.Fatal("secret accepted under another APP_KEY")
+	}
+}
@@ -0,0 +1,156 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// maxCBORDepth bounds the nesting of decoded items, authenticator data never
+// comes close to it.
+const maxCBORDepth = 16
+
+var errCBORTruncated = errors.New("webauthn: truncated CBOR")
+
+// decodeCBOR decodes the first CBOR item of data, as far as WebAuthn needs
+// it: integers, byte and text strings, arrays, maps with integer or text keys,
+// tags and simple values. It returns the item and the number of bytes read.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, int, error) {
+	if depth > maxCBORDepth {
+		return nil, 0, errors.New("webauthn: CBOR nested too deeply")
+	}
+	if len(data) == 0 {
+		return nil, 0, errCBORTruncated
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	if major == 7 {
+		return decodeCBORSimple(data, info)
+	}
+
+	argument, offset, err := cborArgument(data, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0:
+		if argument > 1<<63-1 {
+			return nil, 0, errors.New("webauthn: CBOR integer overflow")
+		}
+		return int64(argument), offset, nil
+	case 1:
+		if argument > 1<<63-1 {
+			return nil, 0, errors.New("webauthn: CBOR integer overflow")
+		}
+		return -1 - int64(argument), offset, nil
+	case 2, 3:
+		if argument > uint64(len(data)-offset) {
+			return nil, 0, errCBORTruncated
+		}
+		end := offset + int(argument)
+		if major == 2 {
+			return append([]byte{}, data[offset:end]...), end, nil
+		}
+		return string(data[offset:end]), end, nil
+	case 4:
+		if argument > uint64(len(data)) {
+			return nil, 0, errCBORTruncated
+		}
+		items := make([]interface{}, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			item, n, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			offset += n
+		}
+		return items, offset, nil
+	case 5:
+		if argument > uint64(len(data)) {
+			return nil, 0, errCBORTruncated
+		}
+		items := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			key, n, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += n
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, fmt.Errorf("webauthn: unsupported CBOR map key %T", key)
+			}
+
+			value, n, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += n
+			items[key] = value
+		}
+		return items, offset, nil
+	case 6:
+		item, n, err := decodeCBORItem(data[offset:], depth+1)
+		return item, offset + n, err
+	}
+
+	return nil, 0, fmt.Errorf("webauthn: unsupported CBOR major type %d", major)
+}
+
+// cborArgument reads the argument that follows the initial byte.
+func cborArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24:
+		if len(data) < 2 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(data[1]), 2, nil
+	case info == 25:
+		if len(data) < 3 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(data[1:3])), 3, nil
+	case info == 26:
+		if len(data) < 5 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(data[1:5])), 5, nil
+	case info == 27:
+		if len(data) < 9 {
+			return 0, 0, errCBORTruncated
+		}
+		return binary.BigEndian.Uint64(data[1:9]), 9, nil
+	}
+	return 0, 0, errors.New("webauthn: indefinite length CBOR is not supported")
+}
+
+// decodeCBORSimple handles false, true, null and undefined and skips floats,
+// which WebAuthn does not use.
+func decodeCBORSimple(data []byte, info byte) (interface{}, int, error) {
+	switch info {
+	case 20:
+		return false, 1, nil
+	case 21:
+		return true, 1, nil
+	case 22, 23:
+		return nil, 1, nil
+	case 25, 26, 27:
+		size := 1 + (1 << (info - 24))
+		if len(data) < size {
+			return nil, 0, errCBORTruncated
+		}
+		return nil, size, nil
+	}
+	return nil, 0, fmt.Errorf("webauthn: unsupported CBOR simple value %d", info)
+}
@@ -0,0 +1,80 @@
+package webauthn
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// {1: -7, "k": [h'0102', true, null]}
+	data := []byte{0xa2, 0x01, 0x26, 0x61, 'k', 0x83, 0x42, 0x01, 0x02, 0xf5, 0xf6}
+
+	item, n, err := decodeCBOR(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data) {
+		t.Fatalf("read %d bytes, want %d", n, len(data))
+	}
+
+	items := item.(map[interface{}]interface{})
+	if items[int64(1)] != int64(-7) {
+		t.Errorf("key 1 = %v, want -7", items[int64(1)])
+	}
+	list := items["k"].([]interface{})
+	if !bytes.Equal(list[0].([]byte), []byte{1, 2}) || list[1] != true || list[2] != nil {
+		t.Errorf("key k = %v", list)
+	}
+}
+
+func TestDecodeCBORTruncated(t *testing.T) {
+	for _, data := range [][]byte{
+		{},
+		{0x18},             // uint8 without its byte
+		{0x19, 0x01},       // uint16 with one byte
+		{0x1b, 0, 0, 0, 0}, // uint64 with four bytes
+		{0x42, 0x01},       // two byte string with one byte
+		{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, // byte string longer than anything
+		{0x82, 0x01},                   // array missing an item
+		{0x9a, 0xff, 0xff, 0xff, 0xff}, // array longer than the data
+		{0xa1, 0x01},                   // map missing a value
+		{0xfb, 0x00, 0x00},             // float64 with two bytes
+	} {
+		if _, _, err := decodeCBOR(data); !errors.Is(err, errCBORTruncated) {
+			t.Errorf("decodeCBOR(% x) = %v, want %v", data, err, errCBORTruncated)
+		}
+	}
+}
+
+func TestDecodeCBORDepthLimit(t *testing.T) {
+	nested := func(depth int) []byte {
+		data := bytes.Repeat([]byte{0x81}, depth)
+		return append(data, 0x00)
+	}
+
+	if _, _, err := decodeCBOR(nested(maxCBORDepth)); err != nil {
+		t.Errorf("%d nested arrays: %v", maxCBORDepth, err)
+	}
+	if _, _, err := decodeCBOR(nested(maxCBORDepth + 1)); err == nil {
+		t.Errorf("%d nested arrays were decoded", maxCBORDepth+1)
+	}
+	if _, _, err := decodeCBOR(bytes.Repeat([]byte{0xc1}, 1000)); err == nil {
+		t.Error("1000 nested tags were decoded")
+	}
+}
+
+func TestDecodeCBORUnsupported(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x9f, 0x01, 0xff},                // indefinite length array
+		{0x5f, 0x41, 0x00, 0xff},          // indefinite length byte string
+		{0xa1, 0x41, 0x00, 0x01},          // map with a byte string key
+		{0xa1, 0xf5, 0x01},                // map with a boolean key
+		{0x1b, 0x80, 0, 0, 0, 0, 0, 0, 0}, // integer beyond int64
+		{0xf0},                            // unassigned simple value
+	} {
+		if _, _, err := decodeCBOR(data); err == nil {
+			t.Errorf("decodeCBOR(% x) succeeded", data)
+		}
+	}
+}
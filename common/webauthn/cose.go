@@ -0,0 +1,121 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// COSE algorithms the relying party accepts, in order of preference.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// SupportedAlgorithms are offered in pubKeyCredParams.
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters, see RFC 8152 section 7 and 13.
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// PublicKey is a credential public key parsed from its COSE encoding.
+type PublicKey struct {
+	Algorithm int
+	key       interface{}
+}
+
+// ParsePublicKey parses a COSE_Key as stored with a credential.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	item, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	return publicKeyFromCOSE(item)
+}
+
+func publicKeyFromCOSE(item interface{}) (*PublicKey, error) {
+	params, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("webauthn: public key is not a COSE key")
+	}
+
+	kty, _ := params[int64(coseKty)].(int64)
+	alg, _ := params[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		y, _ := params[int64(coseY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("webauthn: invalid P-256 public key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("webauthn: P-256 public key is not on the curve")
+		}
+		return &PublicKey{Algorithm: AlgES256, key: key}, nil
+
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("webauthn: invalid Ed25519 public key")
+		}
+		return &PublicKey{Algorithm: AlgEdDSA, key: ed25519.PublicKey(x)}, nil
+
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := params[int64(coseN)].([]byte)
+		e, _ := params[int64(coseE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("webauthn: invalid RSA public key")
+		}
+		// crypto/rsa needs an odd exponent of at least 3 that fits an int32.
+		exponent := new(big.Int).SetBytes(e)
+		if exponent.Cmp(big.NewInt(3)) < 0 || exponent.Bit(0) == 0 || exponent.Cmp(big.NewInt(math.MaxInt32)) > 0 {
+			return nil, errors.New("webauthn: invalid RSA public exponent")
+		}
+		return &PublicKey{Algorithm: AlgRS256, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}, nil
+	}
+
+	return nil, fmt.Errorf("webauthn: unsupported public key type %d with algorithm %d", kty, alg)
+}
+
+// Verify checks a signature made by the credential over data.
+func (k *PublicKey) Verify(data []byte, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
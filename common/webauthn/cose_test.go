@@ -0,0 +1,113 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+// coseKey encodes a COSE_Key map with integer labels; values are int or
+// []byte.
+func coseKey(params ...interface{}) []byte {
+	data := cborHead(5, len(params)/2)
+	for _, param := range params {
+		switch value := param.(type) {
+		case int:
+			if value >= 0 {
+				data = append(data, cborHead(0, value)...)
+			} else {
+				data = append(data, cborHead(1, -1-value)...)
+			}
+		case []byte:
+			data = append(append(data, cborHead(2, len(value))...), value...)
+		}
+	}
+	return data
+}
+
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	}
+	return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := ecKey.X.FillBytes(make([]byte, 32)), ecKey.Y.FillBytes(make([]byte, 32))
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modulus := append([]byte{0xc0}, bytes.Repeat([]byte{0x5a}, 255)...)
+
+	tests := []struct {
+		name string
+		key  []byte
+		alg  int
+	}{
+		{"ES256", coseKey(coseKty, coseKtyEC2, coseAlg, AlgES256, coseCrv, coseCrvP256, coseX, x, coseY, y), AlgES256},
+		{"EdDSA", coseKey(coseKty, coseKtyOKP, coseAlg, AlgEdDSA, coseCrv, coseCrvEd25519, coseX, []byte(edKey)), AlgEdDSA},
+		{"RS256", coseKey(coseKty, coseKtyRSA, coseAlg, AlgRS256, coseN, modulus, coseE, []byte{0x01, 0x00, 0x01}), AlgRS256},
+		{"RS256 e=3", coseKey(coseKty, coseKtyRSA, coseAlg, AlgRS256, coseN, modulus, coseE, []byte{0x03}), AlgRS256},
+	}
+	for _, test := range tests {
+		key, err := ParsePublicKey(test.key)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if key.Algorithm != test.alg {
+			t.Errorf("%s: algorithm %d, want %d", test.name, key.Algorithm, test.alg)
+		}
+	}
+}
+
+func TestParsePublicKeyRejects(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := ecKey.X.FillBytes(make([]byte, 32)), ecKey.Y.FillBytes(make([]byte, 32))
+	offCurve := append([]byte{}, y...)
+	offCurve[31] ^= 0x01
+	modulus := append([]byte{0xc0}, bytes.Repeat([]byte{0x5a}, 255)...)
+	rsaKey := func(exponent []byte) []byte {
+		return coseKey(coseKty, coseKtyRSA, coseAlg, AlgRS256, coseN, modulus, coseE, exponent)
+	}
+
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{"not a map", []byte{0x80}},
+		{"truncated", coseKey(coseKty, coseKtyEC2, coseAlg, AlgES256, coseCrv, coseCrvP256, coseX, x, coseY, y)[:40]},
+		{"symmetric key", coseKey(coseKty, 4, coseAlg, 5, -1, bytes.Repeat([]byte{1}, 32))},
+		{"EC2 key with RS256", coseKey(coseKty, coseKtyEC2, coseAlg, AlgRS256, coseCrv, coseCrvP256, coseX, x, coseY, y)},
+		{"ES384", coseKey(coseKty, coseKtyEC2, coseAlg, -35, coseCrv, 2, coseX, x, coseY, y)},
+		{"P-384 curve", coseKey(coseKty, coseKtyEC2, coseAlg, AlgES256, coseCrv, 2, coseX, x, coseY, y)},
+		{"short coordinate", coseKey(coseKty, coseKtyEC2, coseAlg, AlgES256, coseCrv, coseCrvP256, coseX, x[1:], coseY, y)},
+		{"point off the curve", coseKey(coseKty, coseKtyEC2, coseAlg, AlgES256, coseCrv, coseCrvP256, coseX, x, coseY, offCurve)},
+		{"X25519 curve", coseKey(coseKty, coseKtyOKP, coseAlg, AlgEdDSA, coseCrv, 4, coseX, bytes.Repeat([]byte{1}, 32))},
+		{"short RSA modulus", coseKey(coseKty, coseKtyRSA, coseAlg, AlgRS256, coseN, modulus[:128], coseE, []byte{0x01, 0x00, 0x01})},
+		{"RSA exponent 1", rsaKey([]byte{0x01})},
+		{"even RSA exponent", rsaKey([]byte{0x01, 0x00, 0x00})},
+		{"RSA exponent overflowing int32", rsaKey([]byte{0x80, 0x00, 0x00, 0x01})},
+		{"RSA exponent of five bytes", rsaKey([]byte{0x01, 0x00, 0x00, 0x00, 0x01})},
+		{"empty RSA exponent", rsaKey([]byte{})},
+	}
+	for _, test := range tests {
+		if _, err := ParsePublicKey(test.key); err == nil {
+			t.Errorf("%s: parsed", test.name)
+		}
+	}
+}
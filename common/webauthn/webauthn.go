@@ -0,0 +1,244 @@
+// Package webauthn verifies WebAuthn registration and assertion ceremonies
+// for a single relying party. Attestation statements are not verified, the
+// relying party asks for "none" attestation and trusts the credential key
+// the authenticator returns.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Authenticator data flags.
+const (
+	FlagUserPresent  = 0x01
+	FlagUserVerified = 0x04
+	FlagAttestedData = 0x40
+	FlagExtensions   = 0x80
+)
+
+// ChallengeSize is the number of random bytes in a challenge.
+const ChallengeSize = 32
+
+var (
+	ErrInvalidClientData = errors.New("webauthn: invalid client data")
+	ErrChallengeMismatch = errors.New("webauthn: challenge does not match")
+	ErrOriginMismatch    = errors.New("webauthn: origin is not allowed")
+	ErrRPIDMismatch      = errors.New("webauthn: relying party id does not match")
+	ErrUserNotPresent    = errors.New("webauthn: user was not present")
+	ErrUserNotVerified   = errors.New("webauthn: user was not verified")
+	ErrInvalidSignature  = errors.New("webauthn: invalid signature")
+	ErrSignCount         = errors.New("webauthn: sign count did not increase, the authenticator may be cloned")
+	ErrInvalidAuthData   = errors.New("webauthn: invalid authenticator data")
+)
+
+// RelyingParty is the site credentials are scoped to. ID is the domain,
+// Origins are the exact origins ceremonies may run on.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// Credential is what a registration ceremony yields and what has to be
+// stored to verify later assertions.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+// AuthenticatorData is the parsed authData of a ceremony.
+type AuthenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// NewChallenge returns fresh random challenge bytes.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// Encode encodes binary values the way the WebAuthn JSON serialization does,
+// as unpadded base64url.
+func Encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode reverses Encode. Padded input is accepted as well.
+func Decode(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create()
+// against the challenge it was issued with and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, clientDataJSON []byte, attestationObject []byte, requireUserVerification bool) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	item, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, err
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("webauthn: invalid attestation object")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("webauthn: attestation object has no authenticator data")
+	}
+
+	authData, err := ParseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUserVerification); err != nil {
+		return nil, err
+	}
+	if authData.Flags&FlagAttestedData == 0 || len(authData.CredentialID) == 0 {
+		return nil, errors.New("webauthn: no attested credential data")
+	}
+	if _, err := ParsePublicKey(authData.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        authData.CredentialID,
+		PublicKey: authData.PublicKey,
+		SignCount: authData.SignCount,
+	}, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get() for a
+// stored credential and returns the new sign count to store. A sign count
+// that does not increase is rejected unless the authenticator does not keep
+// one at all.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, credential Credential, clientDataJSON []byte, authenticatorData []byte, signature []byte, requireUserVerification bool) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := ParseAuthenticatorData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUserVerification); err != nil {
+		return 0, err
+	}
+
+	publicKey, err := ParsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), clientDataHash[:]...)
+	if !publicKey.Verify(signed, signature) {
+		return 0, ErrInvalidSignature
+	}
+
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		return 0, ErrSignCount
+	}
+
+	return authData.SignCount, nil
+}
+
+// ParseAuthenticatorData parses authData including the attested credential
+// data when present.
+func ParseAuthenticatorData(data []byte) (*AuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrInvalidAuthData
+	}
+
+	authData := &AuthenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.Flags&FlagAttestedData == 0 {
+		return authData, nil
+	}
+
+	// AAGUID (16 bytes), credential id length (2 bytes), credential id and
+	// the COSE encoded public key.
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, ErrInvalidAuthData
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || len(rest) < idLength {
+		return nil, ErrInvalidAuthData
+	}
+	authData.CredentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	_, keyLength, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, ErrInvalidAuthData
+	}
+	authData.PublicKey = rest[:keyLength]
+	if len(rest) > keyLength && authData.Flags&FlagExtensions == 0 {
+		return nil, ErrInvalidAuthData
+	}
+
+	return authData, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	data := clientData{}
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return ErrInvalidClientData
+	}
+	if data.Type != ceremony {
+		return ErrInvalidClientData
+	}
+
+	received, err := Decode(data.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return ErrOriginMismatch
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData *AuthenticatorData, requireUserVerification bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return ErrRPIDMismatch
+	}
+	if authData.Flags&FlagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if requireUserVerification && authData.Flags&FlagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
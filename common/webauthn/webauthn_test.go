@@ -0,0 +1,191 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+var testRP = &RelyingParty{ID: "example.com", Name: "Example", Origins: []string{"https://example.com"}}
+
+var (
+	registrationChallenge = []byte("registration-challenge-32-bytes!")
+	assertionChallenge    = []byte("assertion-challenge-of-32-bytes!")
+)
+
+// ceremonyVector is a registration with "none" attestation followed by an
+// assertion, recorded from a software authenticator for example.com. The
+// assertion of each vector reports the sign count signCount.
+type ceremonyVector struct {
+	name                   string
+	attestationObject      string
+	registrationClientData string
+	authenticatorData      string
+	assertionClientData    string
+	signature              string
+	signCount              uint32
+}
+
+var ceremonyVectors = []ceremonyVector{
+	{
+		name:                   "ES256",
+		attestationObject:      "a363666d74646e6f6e656761747453746d74a06861757468446174615894a379a6f6eeafb9a55e378c118034e2751e682fab9f2d30ab13d2125586ce1947450000000000000000000000000000000000000000001063726564656e7469616c2d4553323536a5010203262001215820ddef49448e53d24d7c7233528d8c2df677cf0e0d5fe8d6d4eefe930db91404cd2258205cc23bf69e0d7f25d78828760175c0278bf06e30088a9cadd547e3e498362564",
+		registrationClientData: `{"type":"webauthn.create","challenge":"cmVnaXN0cmF0aW9uLWNoYWxsZW5nZS0zMi1ieXRlcyE","origin":"https://example.com","crossOrigin":false}`,
+		authenticatorData:      "a379a6f6eeafb9a55e378c118034e2751e682fab9f2d30ab13d2125586ce19470500000001",
+		assertionClientData:    `{"type":"webauthn.get","challenge":"YXNzZXJ0aW9uLWNoYWxsZW5nZS1vZi0zMi1ieXRlcyE","origin":"https://example.com","crossOrigin":false}`,
+		signature:              "3046022100e887793e999af95876f565d33457760e021f7e2662ed5b19d6c9f93e706162c1022100c9f7aab738c1047e79e84b08b0eefec19c07e280c1a44f849f3e7adaf55aafcf",
+		signCount:              1,
+	},
+	{
+		name:                   "EdDSA",
+		attestationObject:      "a363666d74646e6f6e656761747453746d74a06861757468446174615871a379a6f6eeafb9a55e378c118034e2751e682fab9f2d30ab13d2125586ce1947450000000000000000000000000000000000000000001063726564656e7469616c2d4564445341a401010327200621582078c6547a38bebd04dee86b8ac3148e503e81f2a0037b65b5e86081d8ac300933",
+		registrationClientData: `{"type":"webauthn.create","challenge":"cmVnaXN0cmF0aW9uLWNoYWxsZW5nZS0zMi1ieXRlcyE","origin":"https://example.com","crossOrigin":false}`,
+		authenticatorData:      "a379a6f6eeafb9a55e378c118034e2751e682fab9f2d30ab13d2125586ce19470500000002",
+		assertionClientData:    `{"type":"webauthn.get","challenge":"YXNzZXJ0aW9uLWNoYWxsZW5nZS1vZi0zMi1ieXRlcyE","origin":"https://example.com","crossOrigin":false}`,
+		signature:              "f0dee27f8647bf43e68e1757f93392f1b73f5edf44645ecb6d137c15d81591c52549ed0fcc69948ecfdd585d4c18b6d9155ecf571037f9648d90bcb9f2c8dd02",
+		signCount:              2,
+	},
+	{
+		name:                   "RS256",
+		attestationObject:      "a363666d74646e6f6e656761747453746d74a0686175746844617461590157a379a6f6eeafb9a55e378c118034e2751e682fab9f2d30ab13d2125586ce1947450000000000000000000000000000000000000000001063726564656e7469616c2d5253323536a401030339010020590100d131186bd0efacca1c498ea8d6b229017bf5990d9a1c2aa2faf0e7390d845005fa3cdc9458de300f846aa80f3d86102d55a97cf0acc1dd1647ade769537de347ad8a5293f1d4d4336be9f2dca5fcaae5cbd92f4f7d68f636a4fe0af3353d08117b6c122a0adf7da204226c3a113981ba490a67a406c398e56ff94e85b7d613361e5206121efaf48cc75343914e6b57654aafe9eb8418b4f431fb05ba5b35ea2042f96cd7fb213cb8df64637cfe9490892c236941d32ea1698d2532052d457fa77dffa590ca4d7a1cd387bd2d58690fc145b9620f5f98a1cc5ddc3589d6b9d2fe0f8211e60d77d58dea25a00f52231859201e0ea0ac0c8b2ff55e9f0554ca3ad12143010001",
+		registrationClientData: `{"type":"webauthn.create","challenge":"cmVnaXN0cmF0aW9uLWNoYWxsZW5nZS0zMi1ieXRlcyE","origin":"https://example.com","crossOrigin":false}`,
+		authenticatorData:      "a379a6f6eeafb9a55e378c118034e2751e682fab9f2d30ab13d2125586ce19470500000003",
+		assertionClientData:    `{"type":"webauthn.get","challenge":"YXNzZXJ0aW9uLWNoYWxsZW5nZS1vZi0zMi1ieXRlcyE","origin":"https://example.com","crossOrigin":false}`,
+		signature:              "0eacbe4bba4f5f86aa78bd9f9c557f5fad0e492d650e5cdb62d8d9a3eae64387880a271911b2d8bf7caf3d2e245165ef0e8baf092880dcc86dc49bbc98bb074492432542524cbe8d7badce1654cbe129ed6f5257b5d33a52f6dc80a13b3672b11999a00cfbb0eed65135a033732242dd121bc4704099352349f678563ac48c964d2730d9b9fbb90c71f5b50144fa6666b8e72957bc798885f74c7f670461b7e526d5dde33be37a17d7df861121620114948d5a286bdea4098a8df5a28e29697a4ea4878d18b8c9e33812c14e384954887a88f8b3697483f94bc78ec82f99b4cc1c9224d57dd331b99d4060f413a990733c17fd1d4f183606d5011f9835b7d01f",
+		signCount:              3,
+	},
+}
+
+func mustHex(t *testing.T, value string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func register(t *testing.T, vector ceremonyVector) *Credential {
+	t.Helper()
+	credential, err := testRP.VerifyRegistration(registrationChallenge, []byte(vector.registrationClientData), mustHex(t, vector.attestationObject), true)
+	if err != nil {
+		t.Fatalf("%s: VerifyRegistration: %v", vector.name, err)
+	}
+	return credential
+}
+
+func TestCeremonyVectors(t *testing.T) {
+	algorithms := map[string]int{"ES256": AlgES256, "EdDSA": AlgEdDSA, "RS256": AlgRS256}
+
+	for _, vector := range ceremonyVectors {
+		credential := register(t, vector)
+		if want := []byte("credential-" + vector.name); !bytes.Equal(credential.ID, want) {
+			t.Errorf("%s: credential id %q, want %q", vector.name, credential.ID, want)
+		}
+		if credential.SignCount != 0 {
+			t.Errorf("%s: sign count %d, want 0", vector.name, credential.SignCount)
+		}
+
+		publicKey, err := ParsePublicKey(credential.PublicKey)
+		if err != nil {
+			t.Fatalf("%s: ParsePublicKey: %v", vector.name, err)
+		}
+		if publicKey.Algorithm != algorithms[vector.name] {
+			t.Errorf("%s: algorithm %d, want %d", vector.name, publicKey.Algorithm, algorithms[vector.name])
+		}
+
+		signCount, err := testRP.VerifyAssertion(assertionChallenge, *credential, []byte(vector.assertionClientData),
+			mustHex(t, vector.authenticatorData), mustHex(t, vector.signature), true)
+		if err != nil {
+			t.Fatalf("%s: VerifyAssertion: %v", vector.name, err)
+		}
+		if signCount != vector.signCount {
+			t.Errorf("%s: sign count %d, want %d", vector.name, signCount, vector.signCount)
+		}
+	}
+}
+
+func TestAssertionErrors(t *testing.T) {
+	for _, vector := range ceremonyVectors {
+		credential := register(t, vector)
+		authData := mustHex(t, vector.authenticatorData)
+		signature := mustHex(t, vector.signature)
+		clientData := []byte(vector.assertionClientData)
+
+		tampered := append([]byte{}, signature...)
+		tampered[len(tampered)/2] ^= 0x01
+		tamperedAuthData := append([]byte{}, authData...)
+		tamperedAuthData[len(tamperedAuthData)-1]++
+
+		replayed := *credential
+		replayed.SignCount = vector.signCount
+		ahead := *credential
+		ahead.SignCount = vector.signCount + 1
+
+		otherRP := *testRP
+		otherRP.ID = "example.org"
+		otherOrigin := *testRP
+		otherOrigin.Origins = []string{"https://example.org"}
+
+		tests := []struct {
+			name       string
+			rp         *RelyingParty
+			challenge  []byte
+			credential Credential
+			clientData []byte
+			authData   []byte
+			signature  []byte
+			want       error
+		}{
+			{"tampered signature", testRP, assertionChallenge, *credential, clientData, authData, tampered, ErrInvalidSignature},
+			{"tampered sign count", testRP, assertionChallenge, *credential, clientData, tamperedAuthData, signature, ErrInvalidSignature},
+			{"same sign count", testRP, assertionChallenge, replayed, clientData, authData, signature, ErrSignCount},
+			{"sign count going backwards", testRP, assertionChallenge, ahead, clientData, authData, signature, ErrSignCount},
+			{"wrong challenge", testRP, registrationChallenge, *credential, clientData, authData, signature, ErrChallengeMismatch},
+			{"wrong origin", &otherOrigin, assertionChallenge, *credential, clientData, authData, signature, ErrOriginMismatch},
+			{"wrong rpIdHash", &otherRP, assertionChallenge, *credential, clientData, authData, signature, ErrRPIDMismatch},
+			{"registration client data", testRP, assertionChallenge, *credential, []byte(vector.registrationClientData), authData, signature, ErrInvalidClientData},
+			{"short authenticator data", testRP, assertionChallenge, *credential, clientData, authData[:36], signature, ErrInvalidAuthData},
+		}
+		for _, test := range tests {
+			_, err := test.rp.VerifyAssertion(test.challenge, test.credential, test.clientData, test.authData, test.signature, true)
+			if !errors.Is(err, test.want) {
+				t.Errorf("%s, %s: got %v, want %v", vector.name, test.name, err, test.want)
+			}
+		}
+	}
+}
+
+func TestRegistrationErrors(t *testing.T) {
+	vector := ceremonyVectors[0]
+	attestation := mustHex(t, vector.attestationObject)
+	clientData := []byte(vector.registrationClientData)
+
+	otherRP := *testRP
+	otherRP.ID = "example.org"
+	otherOrigin := *testRP
+	otherOrigin.Origins = []string{"https://example.org"}
+
+	tests := []struct {
+		name        string
+		rp          *RelyingParty
+		challenge   []byte
+		clientData  []byte
+		attestation []byte
+		want        error
+	}{
+		{"wrong challenge", testRP, assertionChallenge, clientData, attestation, ErrChallengeMismatch},
+		{"wrong origin", &otherOrigin, registrationChallenge, clientData, attestation, ErrOriginMismatch},
+		{"wrong rpIdHash", &otherRP, registrationChallenge, clientData, attestation, ErrRPIDMismatch},
+		{"assertion client data", testRP, registrationChallenge, []byte(vector.assertionClientData), attestation, ErrInvalidClientData},
+		{"client data no JSON", testRP, registrationChallenge, []byte("{"), attestation, ErrInvalidClientData},
+		{"truncated attestation", testRP, registrationChallenge, clientData, attestation[:len(attestation)-10], errCBORTruncated},
+	}
+	for _, test := range tests {
+		_, err := test.rp.VerifyRegistration(test.challenge, test.clientData, test.attestation, true)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
@@ -14,6 +14,8 @@ type Conf struct {
 
 	Origin string `mapstructure:"ORIGIN"`
 
+	AppKey string `mapstructure:"APP_KEY"`
+
 	AccessTokenPrivateKey  string        `mapstructure:"ACCESS_TOKEN_PRIVATE_KEY"`
 	AccessTokenPublicKey   string        `mapstructure:"ACCESS_TOKEN_PUBLIC_KEY"`
 	RefreshTokenPrivateKey string        `mapstructure:"REFRESH_TOKEN_PRIVATE_KEY"`
@@ -22,7 +24,99 @@ type Conf struct {
 	RefreshTokenExpiresIn  time.Duration `mapstructure:"REFRESH_TOKEN_EXPIRED_IN"`
 	AccessTokenMaxAge      int           `mapstructure:"ACCESS_TOKEN_MAXAGE"`
 	RefreshTokenMaxAge     int           `mapstructure:"REFRESH_TOKEN_MAXAGE"`
-	QueueService           string        `mapstructure:"QUEUE_SERVICE"`
-	RedisHost              string        `mapstructure:"REDIS_HOST"`
-	RedisDb                int           `mapstructure:"REDIS_PORT"`
+	AccessTokenKeysDir     string        `mapstructure:"ACCESS_TOKEN_KEYS_DIR"`
+	RefreshTokenKeysDir    string        `mapstructure:"REFRESH_TOKEN_KEYS_DIR"`
+	TokenKeysReloadEvery   time.Duration `mapstructure:"TOKEN_KEYS_RELOAD_INTERVAL"`
+
+	Issuer                     string        `mapstructure:"ISSUER"`
+	TokenAudience              string        `mapstructure:"TOKEN_AUDIENCE"`
+	OAuthLoginURL              string        `mapstructure:"OAUTH_LOGIN_URL"`
+	AuthorizationCodeExpiresIn time.Duration `mapstructure:"AUTHORIZATION_CODE_EXPIRED_IN"`
+	IDTokenExpiresIn           time.Duration `mapstructure:"ID_TOKEN_EXPIRED_IN"`
+	ClientTokenExpiresIn       time.Duration `mapstructure:"CLIENT_TOKEN_EXPIRED_IN"`
+
+	LoginMaxAttempts     int           `mapstructure:"LOGIN_MAX_ATTEMPTS"`
+	LoginLockoutDuration time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	LoginIPMaxAttempts   int           `mapstructure:"LOGIN_IP_MAX_ATTEMPTS"`
+	LoginFailureWindow   time.Duration `mapstructure:"LOGIN_FAILURE_WINDOW"`
+
+	TrustedProxies string `mapstructure:"TRUSTED_PROXIES"`
+
+	RateLimitAuth          string `mapstructure:"RATE_LIMIT_AUTH"`
+	RateLimitRegister      string `mapstructure:"RATE_LIMIT_REGISTER"`
+	RateLimitUser          string `mapstructure:"RATE_LIMIT_USER"`
+	RateLimitFriendRequest string `mapstructure:"RATE_LIMIT_FRIEND_REQUEST"`
+	RateLimitOAuth         string `mapstructure:"RATE_LIMIT_OAUTH"`
+	RateLimitAdmin         string `mapstructure:"RATE_LIMIT_ADMIN"`
+
+	MailDriver    string `mapstructure:"MAIL_DRIVER"`
+	MailFrom      string `mapstructure:"MAIL_FROM"`
+	MailOutboxDir string `mapstructure:"MAIL_OUTBOX_DIR"`
+	SMTPHost      string `mapstructure:"SMTP_HOST"`
+	SMTPPort      int    `mapstructure:"SMTP_PORT"`
+	SMTPUsername  string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword  string `mapstructure:"SMTP_PASSWORD"`
+
+	EmailVerificationRequired  bool          `mapstructure:"EMAIL_VERIFICATION_REQUIRED"`
+	EmailVerificationExpiresIn time.Duration `mapstructure:"EMAIL_VERIFICATION_EXPIRED_IN"`
+	EmailVerificationURL       string        `mapstructure:"EMAIL_VERIFICATION_URL"`
+
+	MagicLinkExpiresIn time.Duration `mapstructure:"MAGIC_LINK_EXPIRED_IN"`
+	MagicLinkURL       string        `mapstructure:"MAGIC_LINK_URL"`
+
+	AccountUnlockExpiresIn time.Duration `mapstructure:"ACCOUNT_UNLOCK_EXPIRED_IN"`
+	AccountUnlockURL       string        `mapstructure:"ACCOUNT_UNLOCK_URL"`
+
+	SMSDriver               string        `mapstructure:"SMS_DRIVER"`
+	SMSOutboxFile           string        `mapstructure:"SMS_OUTBOX_FILE"`
+	SMSWebhookURL           string        `mapstructure:"SMS_WEBHOOK_URL"`
+	PhoneDefaultCountryCode string        `mapstructure:"PHONE_DEFAULT_COUNTRY_CODE"`
+	PhoneOTPExpiresIn       time.Duration `mapstructure:"PHONE_OTP_EXPIRED_IN"`
+
+	SocialCallbackURL   string `mapstructure:"SOCIAL_CALLBACK_URL"`
+	SocialLinkURL       string `mapstructure:"SOCIAL_LINK_URL"`
+	GoogleClientID      string `mapstructure:"GOOGLE_CLIENT_ID"`
+	GoogleClientSecret  string `mapstructure:"GOOGLE_CLIENT_SECRET"`
+	GitHubClientID      string `mapstructure:"GITHUB_CLIENT_ID"`
+	GitHubClientSecret  string `mapstructure:"GITHUB_CLIENT_SECRET"`
+	AppleClientID       string `mapstructure:"APPLE_CLIENT_ID"`
+	AppleTeamID         string `mapstructure:"APPLE_TEAM_ID"`
+	AppleKeyID          string `mapstructure:"APPLE_KEY_ID"`
+	ApplePrivateKeyFile string `mapstructure:"APPLE_PRIVATE_KEY_FILE"`
+	OIDCProviderName    string `mapstructure:"OIDC_PROVIDER_NAME"`
+	OIDCIssuer          string `mapstructure:"OIDC_ISSUER"`
+	OIDCClientID        string `mapstructure:"OIDC_CLIENT_ID"`
+	OIDCClientSecret    string `mapstructure:"OIDC_CLIENT_SECRET"`
+	OIDCScopes          string `mapstructure:"OIDC_SCOPES"`
+
+	PasswordResetOTPExpiresIn time.Duration `mapstructure:"PASSWORD_RESET_OTP_EXPIRED_IN"`
+	PasswordHistorySize       int           `mapstructure:"PASSWORD_HISTORY_SIZE"`
+
+	PasswordMinLength         int    `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength         int    `mapstructure:"PASSWORD_MAX_LENGTH"`
+	PasswordCharacterClasses  string `mapstructure:"PASSWORD_CHARACTER_CLASSES"`
+	PasswordDenylistFile      string `mapstructure:"PASSWORD_DENYLIST_FILE"`
+	PasswordAllowPersonalInfo bool   `mapstructure:"PASSWORD_ALLOW_PERSONAL_INFO"`
+	PasswordBreachedPath      string `mapstructure:"PASSWORD_BREACHED_PATH"`
+	PasswordBreachedMinCount  int    `mapstructure:"PASSWORD_BREACHED_MIN_COUNT"`
+
+	PasswordHasher    string `mapstructure:"PASSWORD_HASHER"`
+	Argon2Memory      int    `mapstructure:"ARGON2_MEMORY"`
+	Argon2Iterations  int    `mapstructure:"ARGON2_ITERATIONS"`
+	Argon2Parallelism int    `mapstructure:"ARGON2_PARALLELISM"`
+	BcryptCost        int    `mapstructure:"BCRYPT_COST"`
+
+	MFAIssuer             string        `mapstructure:"MFA_ISSUER"`
+	MFAChallengeExpiresIn time.Duration `mapstructure:"MFA_CHALLENGE_EXPIRED_IN"`
+
+	WebAuthnRPID    string `mapstructure:"WEBAUTHN_RP_ID"`
+	WebAuthnRPName  string `mapstructure:"WEBAUTHN_RP_NAME"`
+	WebAuthnOrigins string `mapstructure:"WEBAUTHN_ORIGINS"`
+
+	AttachmentClientID     string `mapstructure:"ATTACHMENT_CLIENT_ID"`
+	AttachmentClientSecret string `mapstructure:"ATTACHMENT_CLIENT_SECRET"`
+	AttachmentClientScope  string `mapstructure:"ATTACHMENT_CLIENT_SCOPE"`
+	QueueService           string `mapstructure:"QUEUE_SERVICE"`
+	RedisHost              string `mapstructure:"REDIS_HOST"`
+	RedisDb                int    `mapstructure:"REDIS_PORT"`
 }
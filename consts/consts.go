@@ -1,2 +1,80 @@
 package consts
 
+// Redis key prefixes.
+const (
+	AccessTokenKey       = "access_token:"
+	RefreshTokenKey      = "refresh_token:"
+	RefreshTokenUsedKey  = "refresh_token_used:"
+	TokenFamilyKey       = "token_family:"
+	UserSessionsKey      = "user_sessions:"
+	TokenGenerationKey   = "token_generation:"
+	AuthorizationCodeKey = "authorization_code:"
+	DisabledUserKey      = "disabled_user:"
+	LoginFailuresKey     = "login_failures:"
+	LoginBackoffKey      = "login_backoff:"
+	LoginLockKey         = "login_lock:"
+	RateLimitKey         = "rate_limit:"
+	ActionTokenKey       = "action_token:"
+	VerificationMailKey  = "verification_mail:"
+	PasswordResetOTPKey  = "password_reset_otp:"
+	PasswordResetTryKey  = "password_reset_tries:"
+	PasswordResetMailKey = "password_reset_mail:"
+	PasswordResetSentKey = "password_reset_sent:"
+	TOTPEnrollmentKey    = "totp_enrollment:"
+	TOTPUsedStepKey      = "totp_used_step:"
+	MFAAttemptsKey       = "mfa_attempts:"
+	WebAuthnRegisterKey  = "webauthn_register:"
+	WebAuthnAssertionKey = "webauthn_assertion:"
+	WebAuthnLogInKey     = "webauthn_login:"
+	MagicLinkMailKey     = "magic_link_mail:"
+	PhoneOTPKey          = "phone_otp:"
+	PhoneOTPTryKey       = "phone_otp_tries:"
+	PhoneOTPSMSKey       = "phone_otp_sms:"
+	PhoneOTPSentKey      = "phone_otp_sent:"
+	SocialLogInKey       = "social_login:"
+	UnlockMailKey        = "unlock_mail:"
+)
+
+// OAuth2 grant types.
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// OAuth2 token type hints.
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// OpenID Connect scopes.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+)
+
+// API scopes checked by middlewares.RequireScopes. Sessions started with the
+// first-party login get all of them.
+const (
+	ScopeUserRead     = "user:read"
+	ScopeUserWrite    = "user:write"
+	ScopeFriendsRead  = "friends:read"
+	ScopeFriendsWrite = "friends:write"
+	ScopeSessions     = "sessions"
+)
+
+var APIScopes = []string{ScopeUserRead, ScopeUserWrite, ScopeFriendsRead, ScopeFriendsWrite, ScopeSessions}
+
+// Built-in roles and the permissions checked by middlewares.RequirePermission.
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+
+	PermissionRolesManage     = "roles:manage"
+	PermissionUsersRead       = "users:read"
+	PermissionUsersManage     = "users:manage"
+	PermissionContentModerate = "content:moderate"
+)
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"auth/rest_errors"
+	"auth/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController struct {
+	service service.AdminServiceInterface
+}
+
+func NewAdminController(service service.AdminServiceInterface) *AdminController {
+	return &AdminController{service: service}
+}
+
+func (c *AdminController) ListUsers(ginContext *gin.Context) {
+	filter := models.AdminUserFilter{}
+	if err := ginContext.ShouldBindQuery(&filter); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := c.service.ListUsers(filter)
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, resp)
+}
+
+func (c *AdminController) ViewUser(ginContext *gin.Context) {
+	userID, ok := userIDParam(ginContext)
+	if !ok {
+		return
+	}
+
+	user, err := c.service.ViewUser(userID)
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func (c *AdminController) DisableUser(ginContext *gin.Context) {
+	adminID := int(ginContext.GetInt64("user_id"))
+	c.userAction(ginContext, "user disabled", func(userID int) error {
+		return c.service.DisableUser(adminID, userID)
+	})
+}
+
+func (c *AdminController) EnableUser(ginContext *gin.Context) {
+	c.userAction(ginContext, "user enabled", c.service.EnableUser)
+}
+
+func (c *AdminController) UnlockUser(ginContext *gin.Context) {
+	c.userAction(ginContext, "user unlocked", c.service.UnlockUser)
+}
+
+func (c *AdminController) ForceLogOut(ginContext *gin.Context) {
+	c.userAction(ginContext, "user logged out from all devices", c.service.ForceLogOut)
+}
+
+func (c *AdminController) ForcePasswordReset(ginContext *gin.Context) {
+	c.userAction(ginContext, "user has to reset the password", c.service.ForcePasswordReset)
+}
+
+func (c *AdminController) userAction(ginContext *gin.Context, msg string, action func(userID int) error) {
+	userID, ok := userIDParam(ginContext)
+	if !ok {
+		return
+	}
+
+	if err := action(userID); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"msg": msg})
+}
+
+func userIDParam(ginContext *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(ginContext.Params.ByName("id"))
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": rest_errors.ErrParsingRequestParams.Error()})
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,21 @@
+package controller
+
+import (
+	"auth/rest_errors"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// abortWithError answers with the http code registered for err and tells the
+// client when to come back for errors that can be retried.
+func abortWithError(ginContext *gin.Context, err error) {
+	retryErr := &rest_errors.RetryError{}
+	if errors.As(err, &retryErr) {
+		ginContext.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryErr.RetryAfter.Seconds()))))
+	}
+
+	ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"auth/rest_errors"
+	"auth/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IdentityController struct {
+	service service.IdentityServiceInterface
+}
+
+func NewIdentityController(service service.IdentityServiceInterface) *IdentityController {
+	return &IdentityController{service: service}
+}
+
+func (c *IdentityController) List(ginContext *gin.Context) {
+	resp, err := c.service.LoginMethods(int(ginContext.GetInt64("user_id")))
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, resp)
+}
+
+// Link answers a provider with the authorization url to send the browser to,
+// and a state and code from the redirect back with the linked identity.
+func (c *IdentityController) Link(ginContext *gin.Context) {
+	request := models.IdentityLinkRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.UserID = int(ginContext.GetInt64("user_id"))
+
+	if request.Code == "" {
+		link, err := c.service.BeginLink(request.UserID, request.Provider)
+		if err != nil {
+			logger.LogError(err)
+			abortWithError(ginContext, err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, gin.H{"authorization_url": link})
+		return
+	}
+
+	identity, created, err := c.service.Link(request)
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	if !created {
+		ginContext.JSON(http.StatusOK, gin.H{"identity": identity})
+		return
+	}
+	ginContext.JSON(http.StatusCreated, gin.H{"identity": identity})
+}
+
+func (c *IdentityController) Unlink(ginContext *gin.Context) {
+	id, err := strconv.Atoi(ginContext.Params.ByName("id"))
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": rest_errors.ErrParsingRequestParams.Error()})
+		return
+	}
+
+	if err := c.service.Unlink(int(ginContext.GetInt64("user_id")), id); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"message": "identity unlinked"})
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"auth/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MFAController struct {
+	service service.MFAServiceInterface
+}
+
+func NewMFAController(service service.MFAServiceInterface) *MFAController {
+	return &MFAController{service: service}
+}
+
+func (c *MFAController) Status(ginContext *gin.Context) {
+	resp, err := c.service.Status(int(ginContext.GetInt64("user_id")))
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, resp)
+}
+
+func (c *MFAController) EnrollTOTP(ginContext *gin.Context) {
+	resp, err := c.service.EnrollTOTP(int(ginContext.GetInt64("user_id")))
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusCreated, resp)
+}
+
+func (c *MFAController) ConfirmTOTP(ginContext *gin.Context) {
+	request := models.TOTPConfirmRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := c.service.ConfirmTOTP(int(ginContext.GetInt64("user_id")), request.Code)
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, resp)
+}
+
+func (c *MFAController) DisableTOTP(ginContext *gin.Context) {
+	request, ok := bindReauth(ginContext)
+	if !ok {
+		return
+	}
+
+	if err := c.service.DisableTOTP(request); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+func (c *MFAController) RegenerateRecoveryCodes(ginContext *gin.Context) {
+	request, ok := bindReauth(ginContext)
+	if !ok {
+		return
+	}
+
+	resp, err := c.service.RegenerateRecoveryCodes(request)
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, resp)
+}
+
+// BeginWebAuthnChallenge returns the options for answering an MFA challenge
+// with a passkey.
+func (c *MFAController) BeginWebAuthnChallenge(ginContext *gin.Context) {
+	request := models.WebAuthnChallengeRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request.IP = ginContext.ClientIP()
+
+	resp, err := c.service.BeginWebAuthnChallenge(request)
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"publicKey": resp})
+}
+
+func bindReauth(ginContext *gin.Context) (models.MFAReauthRequest, bool) {
+	request := models.MFAReauthRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return request, false
+	}
+	request.UserID = int(ginContext.GetInt64("user_id"))
+	request.IP = ginContext.ClientIP()
+	return request, true
+}
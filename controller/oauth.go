@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"auth/common/logger"
+	"auth/config"
+	"auth/middlewares"
+	"auth/models"
+	"auth/rest_errors"
+	"auth/service"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionCookie     = "access_token"
+	sessionCookiePath = "/oauth"
+)
+
+type OAuthController struct {
+	service     service.OAuthServiceInterface
+	userService service.UserServiceInterface
+}
+
+func NewOAuthController(service service.OAuthServiceInterface, userService service.UserServiceInterface) *OAuthController {
+	return &OAuthController{service: service, userService: userService}
+}
+
+// Authorize implements the authorization endpoint of the code flow. Users
+// without a session are sent to the configured login page and come back here
+// afterwards. Browsers send the session in the access_token cookie set at
+// login, other callers may use a bearer token.
+func (c *OAuthController) Authorize(ginContext *gin.Context) {
+	request := models.AuthorizeRequest{}
+	if err := ginContext.ShouldBind(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, rest_errors.InvalidRequest(err.Error()))
+		return
+	}
+
+	client, err := c.service.FindAuthorizeClient(&request)
+	if err != nil {
+		logger.LogError(err)
+		c.abortWithOAuthError(ginContext, err)
+		return
+	}
+
+	// Only a first-party login session may authorize clients, tokens issued to
+	// other clients must not be turned into codes for yet another one.
+	tokenData, err := c.userService.Authenticate(middlewares.GetAccessToken(ginContext))
+	if err == nil && tokenData.ClientID != "" {
+		err = rest_errors.ErrOAuthLoginRequired
+	}
+	if err != nil {
+		if request.Prompt == "none" || config.Config.OAuthLoginURL == "" {
+			redirectWithError(ginContext, request, rest_errors.ErrOAuthLoginRequired)
+			return
+		}
+
+		returnTo := strings.TrimSuffix(config.Config.Issuer, "/") + ginContext.Request.URL.RequestURI()
+		ginContext.Redirect(http.StatusFound, config.Config.OAuthLoginURL+"?return_to="+url.QueryEscape(returnTo))
+		return
+	}
+
+	code, err := c.service.Authorize(tokenData.UserID, tokenData.Scope, client, request)
+	if err != nil {
+		logger.LogError(err)
+		redirectWithError(ginContext, request, err)
+		return
+	}
+
+	redirectTo, _ := url.Parse(request.RedirectURI)
+	query := redirectTo.Query()
+	query.Set("code", code)
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+	redirectTo.RawQuery = query.Encode()
+
+	ginContext.Redirect(http.StatusFound, redirectTo.String())
+}
+
+func (c *OAuthController) Token(ginContext *gin.Context) {
+	request := models.TokenRequest{}
+	if err := ginContext.ShouldBind(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, rest_errors.InvalidRequest(err.Error()))
+		return
+	}
+
+	request.ClientID, request.ClientSecret = clientCredentials(ginContext, request.ClientID, request.ClientSecret)
+	request.UserAgent = ginContext.Request.UserAgent()
+	request.IP = ginContext.ClientIP()
+
+	resp, err := c.service.Token(request)
+	ginContext.Header("Cache-Control", "no-store")
+	ginContext.Header("Pragma", "no-cache")
+	if err != nil {
+		logger.LogError(err)
+		c.abortWithOAuthError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, resp)
+}
+
+func (c *OAuthController) Introspect(ginContext *gin.Context) {
+	request := models.IntrospectionRequest{}
+	if err := ginContext.ShouldBind(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, rest_errors.InvalidRequest(err.Error()))
+		return
+	}
+
+	request.ClientID, request.ClientSecret = clientCredentials(ginContext, request.ClientID, request.ClientSecret)
+
+	resp, err := c.service.Introspect(request)
+	ginContext.Header("Cache-Control", "no-store")
+	ginContext.Header("Pragma", "no-cache")
+	if err != nil {
+		logger.LogError(err)
+		c.abortWithOAuthError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, resp)
+}
+
+func (c *OAuthController) Revoke(ginContext *gin.Context) {
+	request := models.RevocationRequest{}
+	if err := ginContext.ShouldBind(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, rest_errors.InvalidRequest(err.Error()))
+		return
+	}
+
+	request.ClientID, request.ClientSecret = clientCredentials(ginContext, request.ClientID, request.ClientSecret)
+
+	if err := c.service.Revoke(request); err != nil {
+		logger.LogError(err)
+		c.abortWithOAuthError(ginContext, err)
+		return
+	}
+
+	ginContext.Status(http.StatusOK)
+}
+
+func (c *OAuthController) UserInfo(ginContext *gin.Context) {
+	userID := int(ginContext.GetInt64("user_id"))
+
+	info, err := c.service.UserInfo(userID)
+	if err != nil {
+		logger.LogError(err)
+		c.abortWithOAuthError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, info)
+}
+
+func (c *OAuthController) abortWithOAuthError(ginContext *gin.Context, err error) {
+	oauthError := &rest_errors.OAuthError{}
+	if errors.As(err, &oauthError) {
+		if oauthError.HttpCode == http.StatusUnauthorized {
+			ginContext.Header("WWW-Authenticate", "Basic")
+		}
+		ginContext.AbortWithStatusJSON(oauthError.HttpCode, oauthError)
+		return
+	}
+
+	ginContext.AbortWithStatusJSON(http.StatusInternalServerError, rest_errors.NewOAuthError("server_error", "", http.StatusInternalServerError))
+}
+
+// setSessionCookie lets the browser that logged in reach /oauth/authorize with
+// its session: a redirect to the authorization endpoint cannot carry a bearer
+// token. The cookie is limited to /oauth so the API keeps using bearer tokens.
+func setSessionCookie(ginContext *gin.Context, resp *models.JWTTokenResponse) {
+	if resp == nil || resp.Token == "" {
+		return
+	}
+
+	ginContext.SetSameSite(http.SameSiteLaxMode)
+	ginContext.SetCookie(sessionCookie, resp.Token, config.Config.AccessTokenMaxAge*60, sessionCookiePath, "", secureCookies(), true)
+}
+
+func clearSessionCookie(ginContext *gin.Context) {
+	ginContext.SetSameSite(http.SameSiteLaxMode)
+	ginContext.SetCookie(sessionCookie, "", -1, sessionCookiePath, "", secureCookies(), true)
+}
+
+func secureCookies() bool {
+	return strings.HasPrefix(config.Config.Issuer, "https://")
+}
+
+// clientCredentials prefers HTTP Basic client authentication over the
+// credentials posted in the form.
+func clientCredentials(ginContext *gin.Context, clientID string, clientSecret string) (string, string) {
+	if id, secret, ok := ginContext.Request.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(id)
+		clientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	return clientID, clientSecret
+}
+
+// redirectWithError reports an authorization error back to the client as
+// described in RFC 6749 section 4.1.2.1.
+func redirectWithError(ginContext *gin.Context, request models.AuthorizeRequest, err error) {
+	oauthError := &rest_errors.OAuthError{}
+	if !errors.As(err, &oauthError) {
+		oauthError = rest_errors.NewOAuthError("server_error", "", http.StatusInternalServerError)
+	}
+
+	redirectTo, _ := url.Parse(request.RedirectURI)
+	query := redirectTo.Query()
+	query.Set("error", oauthError.Code)
+	if oauthError.Description != "" {
+		query.Set("error_description", oauthError.Description)
+	}
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+	redirectTo.RawQuery = query.Encode()
+
+	ginContext.Redirect(http.StatusFound, redirectTo.String())
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"auth/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordController struct {
+	service service.PasswordResetServiceInterface
+}
+
+func NewPasswordController(service service.PasswordResetServiceInterface) *PasswordController {
+	return &PasswordController{service: service}
+}
+
+func (c *PasswordController) ForgotPassword(ginContext *gin.Context) {
+	request := models.ForgotPasswordRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.service.ForgotPassword(request.Email); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusAccepted, gin.H{"message": "if the address belongs to an account a code is on its way"})
+}
+
+func (c *PasswordController) ResendOTP(ginContext *gin.Context) {
+	request := models.ForgotPasswordRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.service.ResendOTP(request.Email); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusAccepted, gin.H{"message": "if a reset is pending a new code is on its way"})
+}
+
+func (c *PasswordController) ResetPassword(ginContext *gin.Context) {
+	request := models.ResetPasswordRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.service.ResetPassword(request); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"message": "password has been reset, please log in again"})
+}
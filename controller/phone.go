@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"auth/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PhoneController struct {
+	service service.PhoneServiceInterface
+}
+
+func NewPhoneController(service service.PhoneServiceInterface) *PhoneController {
+	return &PhoneController{service: service}
+}
+
+func (c *PhoneController) StartVerification(ginContext *gin.Context) {
+	request := models.PhoneRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.UserID = int(ginContext.GetInt64("user_id"))
+	request.IP = ginContext.ClientIP()
+
+	if err := c.service.StartVerification(request); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusAccepted, gin.H{"message": "a verification code is on its way"})
+}
+
+func (c *PhoneController) ConfirmVerification(ginContext *gin.Context) {
+	request := models.PhoneVerifyRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.UserID = int(ginContext.GetInt64("user_id"))
+
+	if err := c.service.ConfirmVerification(request); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"message": "phone number verified"})
+}
+
+func (c *PhoneController) SendLogInCode(ginContext *gin.Context) {
+	request := models.PhoneRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.IP = ginContext.ClientIP()
+
+	if err := c.service.SendLogInCode(request); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusAccepted, gin.H{"message": "if the number belongs to an account a code is on its way"})
+}
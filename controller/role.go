@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"auth/rest_errors"
+	"auth/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleController struct {
+	service service.RoleServiceInterface
+}
+
+func NewRoleController(service service.RoleServiceInterface) *RoleController {
+	return &RoleController{service: service}
+}
+
+func (c *RoleController) ListRoles(ginContext *gin.Context) {
+	roles, err := c.service.ListRoles()
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (c *RoleController) CreateRole(ginContext *gin.Context) {
+	var role models.Role
+	if err := ginContext.ShouldBindJSON(&role); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := c.service.CreateRole(role)
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusCreated, gin.H{"role": resp})
+}
+
+func (c *RoleController) ListPermissions(ginContext *gin.Context) {
+	permissions, err := c.service.ListPermissions()
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"permissions": permissions})
+}
+
+func (c *RoleController) CreatePermission(ginContext *gin.Context) {
+	var permission models.Permission
+	if err := ginContext.ShouldBindJSON(&permission); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := c.service.CreatePermission(permission)
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusCreated, gin.H{"permission": resp})
+}
+
+func (c *RoleController) AddRolePermission(ginContext *gin.Context) {
+	var request models.RolePermissionRequest
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := c.service.AddRolePermission(ginContext.Params.ByName("name"), request.Permission)
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusCreated, gin.H{"role": role})
+}
+
+func (c *RoleController) RemoveRolePermission(ginContext *gin.Context) {
+	role, err := c.service.RemoveRolePermission(ginContext.Params.ByName("name"), ginContext.Params.ByName("permission"))
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"role": role})
+}
+
+func (c *RoleController) UserRoles(ginContext *gin.Context) {
+	userID, ok := userIDParam(ginContext)
+	if !ok {
+		return
+	}
+
+	roles, err := c.service.UserRoles(userID)
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (c *RoleController) AssignRole(ginContext *gin.Context) {
+	userID, ok := userIDParam(ginContext)
+	if !ok {
+		return
+	}
+
+	var request models.RoleAssignmentRequest
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	roles, err := c.service.AssignRole(userID, request.Role)
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusCreated, gin.H{"roles": roles})
+}
+
+func (c *RoleController) UnassignRole(ginContext *gin.Context) {
+	userID, ok := userIDParam(ginContext)
+	if !ok {
+		return
+	}
+
+	roles, err := c.service.UnassignRole(userID, ginContext.Params.ByName("role"))
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"roles": roles})
+}
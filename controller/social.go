@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"auth/common/logger"
+	"auth/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SocialController struct {
+	service service.SocialLogInInterface
+}
+
+func NewSocialController(service service.SocialLogInInterface) *SocialController {
+	return &SocialController{service: service}
+}
+
+func (c *SocialController) Providers(ginContext *gin.Context) {
+	ginContext.JSON(http.StatusOK, gin.H{"providers": c.service.Providers()})
+}
+
+// Begin sends the browser to the provider. The provider redirects back to
+// the callback, which answers like /api/auth/login.
+func (c *SocialController) Begin(ginContext *gin.Context) {
+	link, err := c.service.AuthCodeURL(ginContext.Param("provider"), ginContext.Query("device_name"))
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.Redirect(http.StatusFound, link)
+}
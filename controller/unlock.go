@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"auth/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UnlockController struct {
+	service service.AccountUnlockInterface
+}
+
+func NewUnlockController(service service.AccountUnlockInterface) *UnlockController {
+	return &UnlockController{service: service}
+}
+
+func (c *UnlockController) SendUnlockLink(ginContext *gin.Context) {
+	request := models.UnlockRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.service.Send(request.Email); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusAccepted, gin.H{"message": "if the account is locked an unlock link is on its way"})
+}
+
+func (c *UnlockController) Unlock(ginContext *gin.Context) {
+	request := models.ConfirmUnlockRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.service.Unlock(request.Token); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"message": "account unlocked"})
+}
@@ -4,7 +4,9 @@ import (
 	"auth/common/logger"
 	"auth/errors"
 	"auth/models"
+	"auth/rest_errors"
 	"auth/service"
+	"html/template"
 	"net/http"
 	"strconv"
 	"strings"
@@ -49,19 +51,54 @@ func (c *UserController) LogIn(ginContext *gin.Context) {
 		return
 	}
 	logger.LogInfo(signInInfo)
+	signInInfo.UserAgent = ginContext.Request.UserAgent()
+	signInInfo.IP = ginContext.ClientIP()
 
 	resp, err := c.service.LogIn(*signInInfo)
 
 	if err != nil {
 		logger.LogError(err)
-		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithError(ginContext, err)
 		return
 	}
 
+	if resp.MFARequired {
+		ginContext.JSON(http.StatusOK, gin.H{"user": resp})
+		return
+	}
+	setSessionCookie(ginContext, resp)
 	ginContext.JSON(http.StatusCreated, gin.H{"user": resp})
 
 }
 
+func (c *UserController) RefreshToken(ginContext *gin.Context) {
+	request := models.RefreshTokenRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil && ginContext.Request.ContentLength > 0 {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.RefreshToken == "" {
+		cookie, err := ginContext.Cookie("refresh_token")
+		if err != nil {
+			ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "refresh token is required"})
+			return
+		}
+		request.RefreshToken = cookie
+	}
+
+	resp, err := c.service.RefreshToken(request.RefreshToken)
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	setSessionCookie(ginContext, resp)
+	ginContext.JSON(http.StatusCreated, gin.H{"user": resp})
+}
+
 func (c *UserController) UpdateProfile(ginContext *gin.Context) {
 	var user models.User
 	if err := ginContext.Bind(&user); err != nil {
@@ -83,6 +120,25 @@ func (c *UserController) UpdateProfile(ginContext *gin.Context) {
 
 }
 
+func (c *UserController) ChangePassword(ginContext *gin.Context) {
+	request := models.ChangePasswordRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.UserID = int(ginContext.GetInt64("user_id"))
+	request.IP = ginContext.ClientIP()
+
+	if err := c.service.ChangePassword(request); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"message": "password has been changed, please log in again"})
+}
+
 func (c *UserController) ViewProfile(ginContext *gin.Context) {
 
 	userIDString := ginContext.Params.ByName("id")
@@ -143,10 +199,53 @@ func (c *UserController) LogOut(ginContext *gin.Context) {
 		return
 	}
 
+	clearSessionCookie(ginContext)
 	ginContext.JSON(http.StatusCreated, gin.H{"msg": "successfully log out"})
 
 }
 
+func (c *UserController) LogOutAll(ginContext *gin.Context) {
+	userID := int(ginContext.GetInt64("user_id"))
+
+	err := c.service.LogOutAll(userID)
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	clearSessionCookie(ginContext)
+	ginContext.JSON(http.StatusCreated, gin.H{"msg": "successfully logged out from all devices"})
+}
+
+func (c *UserController) ListSessions(ginContext *gin.Context) {
+	userID := int(ginContext.GetInt64("user_id"))
+	sessionID := ginContext.GetString("session_id")
+
+	sessions, err := c.service.ListSessions(userID, sessionID)
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (c *UserController) RevokeSession(ginContext *gin.Context) {
+	userID := int(ginContext.GetInt64("user_id"))
+	sessionID := ginContext.Params.ByName("id")
+
+	err := c.service.RevokeSession(userID, sessionID)
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(rest_errors.StatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"msg": "session revoked"})
+}
+
 func (r *UserController) RequestSent(ginContext *gin.Context) {
 	userID := int(ginContext.GetInt64("user_id"))
 	requestedIDString := ginContext.Params.ByName("id")
@@ -224,3 +323,227 @@ func (r *UserController) ViewFriends(ginContext *gin.Context) {
 
 	ginContext.JSON(http.StatusCreated, resp)
 }
+
+func (c *UserController) VerifyEmail(ginContext *gin.Context) {
+	request := models.VerifyEmailRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.service.VerifyEmail(request.Token); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"message": "email verified"})
+}
+
+func (c *UserController) ResendVerificationEmail(ginContext *gin.Context) {
+	request := models.ResendVerificationRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.service.ResendVerificationEmail(request.Email); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusAccepted, gin.H{"message": "if the address belongs to an unverified account a new link is on its way"})
+}
+
+func (c *UserController) VerifyMFA(ginContext *gin.Context) {
+	request := models.MFAVerifyRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.IP = ginContext.ClientIP()
+
+	resp, err := c.service.VerifyMFA(request)
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	setSessionCookie(ginContext, resp)
+	ginContext.JSON(http.StatusCreated, gin.H{"user": resp})
+}
+
+func (c *UserController) BeginWebAuthnLogIn(ginContext *gin.Context) {
+	request := models.WebAuthnLogInBeginRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil && ginContext.Request.ContentLength > 0 {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := c.service.BeginWebAuthnLogIn(request.Email)
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, resp)
+}
+
+func (c *UserController) WebAuthnLogIn(ginContext *gin.Context) {
+	request := models.WebAuthnLogInRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.UserAgent = ginContext.Request.UserAgent()
+	request.IP = ginContext.ClientIP()
+
+	resp, err := c.service.WebAuthnLogIn(request)
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	setSessionCookie(ginContext, resp)
+	ginContext.JSON(http.StatusCreated, gin.H{"user": resp})
+}
+
+func (c *UserController) SendMagicLink(ginContext *gin.Context) {
+	request := models.MagicLinkRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.IP = ginContext.ClientIP()
+
+	if err := c.service.SendMagicLink(request); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusAccepted, gin.H{"message": "if the address belongs to an account a login link is on its way"})
+}
+
+// magicLinkPage asks for a click before the token of a login link is used
+// up, so mail scanners that fetch the link do not burn it.
+var magicLinkPage = template.Must(template.New("magic-link").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Sign in</title></head>
+<body>
+<form method="post">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// ConfirmMagicLink is where the mailed link points. It only shows a form that
+// posts the token to MagicLinkLogIn.
+func (c *UserController) ConfirmMagicLink(ginContext *gin.Context) {
+	request := models.MagicLinkLogInRequest{}
+	if err := ginContext.ShouldBindQuery(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ginContext.Header("Cache-Control", "no-store")
+	ginContext.Header("Referrer-Policy", "no-referrer")
+	ginContext.Header("Content-Type", "text/html; charset=utf-8")
+	ginContext.Status(http.StatusOK)
+	if err := magicLinkPage.Execute(ginContext.Writer, request.Token); err != nil {
+		logger.LogError(err)
+	}
+}
+
+// MagicLinkLogIn takes the token as JSON or, from the confirmation page, as
+// a form and uses it up.
+func (c *UserController) MagicLinkLogIn(ginContext *gin.Context) {
+	request := models.MagicLinkLogInRequest{}
+	if err := ginContext.ShouldBind(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.UserAgent = ginContext.Request.UserAgent()
+	request.IP = ginContext.ClientIP()
+
+	resp, err := c.service.MagicLinkLogIn(request)
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	if resp.MFARequired {
+		ginContext.JSON(http.StatusOK, gin.H{"user": resp})
+		return
+	}
+	setSessionCookie(ginContext, resp)
+	ginContext.JSON(http.StatusCreated, gin.H{"user": resp})
+}
+
+func (c *UserController) PhoneLogIn(ginContext *gin.Context) {
+	request := models.PhoneLogInRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.UserAgent = ginContext.Request.UserAgent()
+	request.IP = ginContext.ClientIP()
+
+	resp, err := c.service.PhoneLogIn(request)
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	if resp.MFARequired {
+		ginContext.JSON(http.StatusOK, gin.H{"user": resp})
+		return
+	}
+	setSessionCookie(ginContext, resp)
+	ginContext.JSON(http.StatusCreated, gin.H{"user": resp})
+}
+
+// SocialLogIn is the callback of a provider. Apple posts the code as a form,
+// the others redirect with it in the query string.
+func (c *UserController) SocialLogIn(ginContext *gin.Context) {
+	request := models.SocialLogInRequest{}
+	if err := ginContext.ShouldBind(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.Provider = ginContext.Param("provider")
+	request.UserAgent = ginContext.Request.UserAgent()
+	request.IP = ginContext.ClientIP()
+
+	resp, err := c.service.SocialLogIn(request)
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	if resp.MFARequired {
+		ginContext.JSON(http.StatusOK, gin.H{"user": resp})
+		return
+	}
+	setSessionCookie(ginContext, resp)
+	ginContext.JSON(http.StatusCreated, gin.H{"user": resp})
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"auth/rest_errors"
+	"auth/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebAuthnController struct {
+	service service.WebAuthnServiceInterface
+	mfa     service.MFAServiceInterface
+}
+
+func NewWebAuthnController(service service.WebAuthnServiceInterface, mfa service.MFAServiceInterface) *WebAuthnController {
+	return &WebAuthnController{service: service, mfa: mfa}
+}
+
+func (c *WebAuthnController) BeginRegistration(ginContext *gin.Context) {
+	resp, err := c.service.BeginRegistration(int(ginContext.GetInt64("user_id")))
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"publicKey": resp})
+}
+
+func (c *WebAuthnController) FinishRegistration(ginContext *gin.Context) {
+	request := models.WebAuthnRegistrationRequest{}
+	if err := ginContext.ShouldBindJSON(&request); err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.UserID = int(ginContext.GetInt64("user_id"))
+
+	resp, err := c.service.FinishRegistration(request)
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusCreated, resp)
+}
+
+func (c *WebAuthnController) Credentials(ginContext *gin.Context) {
+	resp, err := c.service.Credentials(int(ginContext.GetInt64("user_id")))
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"credentials": resp})
+}
+
+// BeginAssertion returns the options for proving presence with a passkey
+// before changing the second factor.
+func (c *WebAuthnController) BeginAssertion(ginContext *gin.Context) {
+	resp, err := c.service.BeginAssertion(int(ginContext.GetInt64("user_id")), ginContext.ClientIP())
+	if err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"publicKey": resp})
+}
+
+func (c *WebAuthnController) RemoveCredential(ginContext *gin.Context) {
+	id, err := strconv.Atoi(ginContext.Params.ByName("id"))
+	if err != nil {
+		logger.LogError(err)
+		ginContext.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": rest_errors.ErrParsingRequestParams.Error()})
+		return
+	}
+
+	request, ok := bindReauth(ginContext)
+	if !ok {
+		return
+	}
+
+	if err := c.mfa.RemoveWebAuthnCredential(request, id); err != nil {
+		logger.LogError(err)
+		abortWithError(ginContext, err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, gin.H{"message": "passkey removed"})
+}
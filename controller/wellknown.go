@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"auth/common/utils"
+	"auth/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WellKnownController struct {
+	oauthService service.OAuthServiceInterface
+}
+
+func NewWellKnownController(oauthService service.OAuthServiceInterface) *WellKnownController {
+	return &WellKnownController{oauthService: oauthService}
+}
+
+// JWKS publishes the public keys access tokens can be verified with.
+func (c *WellKnownController) JWKS(ginContext *gin.Context) {
+	ginContext.Header("Cache-Control", "public, max-age=300")
+	ginContext.JSON(http.StatusOK, utils.AccessTokenKeys.JWKS())
+}
+
+func (c *WellKnownController) OpenIDConfiguration(ginContext *gin.Context) {
+	ginContext.Header("Cache-Control", "public, max-age=3600")
+	ginContext.JSON(http.StatusOK, c.oauthService.Discovery())
+}
@@ -60,6 +60,33 @@ func InitDB() *sql.DB {
 		log.Fatal(err)
 	}
 
+	_, err = db.Exec(`
+		ALTER TABLE sm_users
+			ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP,
+			ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS phone_verified BOOLEAN NOT NULL DEFAULT FALSE;
+		CREATE UNIQUE INDEX IF NOT EXISTS sm_users_verified_phone_idx ON sm_users (phone) WHERE phone_verified;
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Emails are stored in lower case and unique regardless of case. Addresses
+	// registered before are lowered unless that clashes with another account,
+	// such clashes have to be merged by hand for the index to be created.
+	_, err = db.Exec(`
+		UPDATE sm_users SET email = lower(email)
+		WHERE email <> lower(email)
+			AND NOT EXISTS (SELECT 1 FROM sm_users other WHERE other.id <> sm_users.id AND lower(other.email) = lower(sm_users.email));
+		CREATE UNIQUE INDEX IF NOT EXISTS sm_users_email_lower_idx ON sm_users (lower(email));
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS websites (
 			id SERIAL PRIMARY KEY,
@@ -92,6 +119,173 @@ func InitDB() *sql.DB {
 		)
 	`)
 
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS oauth_clients (
+			id SERIAL PRIMARY KEY,
+			client_id TEXT UNIQUE NOT NULL,
+			client_secret TEXT,
+			name TEXT,
+			redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+			grant_types TEXT[] NOT NULL DEFAULT '{}',
+			scopes TEXT[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS roles (
+			id SERIAL PRIMARY KEY,
+			name TEXT UNIQUE NOT NULL,
+			description TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS permissions (
+			id SERIAL PRIMARY KEY,
+			name TEXT UNIQUE NOT NULL,
+			description TEXT
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS role_permissions (
+			role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+			permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+			PRIMARY KEY (role_id, permission_id)
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_roles (
+			user_id INTEGER NOT NULL REFERENCES sm_users(id) ON DELETE CASCADE,
+			role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+			PRIMARY KEY (user_id, role_id)
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS password_history (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES sm_users(id) ON DELETE CASCADE,
+			password TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS password_history_user_id_idx ON password_history (user_id, id DESC);
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_mfa (
+			user_id INTEGER PRIMARY KEY REFERENCES sm_users(id) ON DELETE CASCADE,
+			totp_secret TEXT NOT NULL,
+			enabled_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+		CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES sm_users(id) ON DELETE CASCADE,
+			code_hash TEXT NOT NULL,
+			used_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS mfa_recovery_codes_user_id_idx ON mfa_recovery_codes (user_id);
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS webauthn_credentials (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES sm_users(id) ON DELETE CASCADE,
+			credential_id TEXT UNIQUE NOT NULL,
+			public_key BYTEA NOT NULL,
+			sign_count BIGINT NOT NULL DEFAULT 0,
+			transports TEXT[] NOT NULL DEFAULT '{}',
+			name TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			last_used_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_identities (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES sm_users(id) ON DELETE CASCADE,
+			provider TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			email TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			last_used_at TIMESTAMP,
+			UNIQUE (provider, subject)
+		);
+		CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Built-in roles and permissions. admin always holds every permission;
+	// moderator only gets its defaults while it has none, so admins can change
+	// them later on.
+	_, err = db.Exec(`
+		INSERT INTO roles (name, description) VALUES
+			('admin', 'Full access to the admin console'),
+			('moderator', 'Reviews users and reported content')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO permissions (name, description) VALUES
+			('roles:manage', 'Create roles and permissions and assign them'),
+			('users:read', 'View any user account'),
+			('users:manage', 'Disable, unlock and log out user accounts'),
+			('content:moderate', 'Handle reported content')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'admin'
+		ON CONFLICT DO NOTHING;
+
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT r.id, p.id FROM roles r, permissions p
+		WHERE r.name = 'moderator' AND p.name IN ('users:read', 'content:moderate')
+			AND NOT EXISTS (SELECT 1 FROM role_permissions rp WHERE rp.role_id = r.id)
+		ON CONFLICT DO NOTHING;
+	`)
+
 	if err != nil {
 		log.Fatal(err)
 	}
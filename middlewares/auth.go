@@ -1,58 +1,61 @@
 package middlewares
 
 import (
-	"auth/common/logger"
-	"auth/common/utils"
-	"auth/config"
-	"auth/redis"
-	"auth/repository"
-	"context"
-	"fmt"
+	"auth/models"
+	"auth/service"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func Auth() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		var accessToken string
-		cookie, err := ctx.Cookie("access_token")
+// ClaimsKey is the gin context key holding the *models.Claims of the
+// authenticated request.
+const ClaimsKey = "claims"
 
-		authorizationHeader := ctx.Request.Header.Get("Authorization")
-		fields := strings.Fields(authorizationHeader)
+// GetAccessToken reads the bearer token of the request, falling back to the
+// access_token cookie.
+func GetAccessToken(ctx *gin.Context) string {
+	var accessToken string
+	cookie, err := ctx.Cookie("access_token")
 
-		if len(fields) != 0 && fields[0] == "Bearer" {
-			accessToken = fields[1]
-		} else if err == nil {
-			accessToken = cookie
-		}
+	authorizationHeader := ctx.Request.Header.Get("Authorization")
+	fields := strings.Fields(authorizationHeader)
+
+	if len(fields) > 1 && fields[0] == "Bearer" {
+		accessToken = fields[1]
+	} else if err == nil {
+		accessToken = cookie
+	}
 
+	return accessToken
+}
+
+func Auth(userService service.UserServiceInterface) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		accessToken := GetAccessToken(ctx)
 		if accessToken == "" {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "You are not logged in"})
 			return
 		}
 
-		sub, err := utils.ValidateToken(accessToken, config.Config.AccessTokenPublicKey)
+		tokenData, err := userService.Authenticate(accessToken)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": err.Error()})
 			return
 		}
 
-		raventClient := logger.NewRavenClient()
-		logger := logger.NewLogger(raventClient)
-		redisConn := redis.NewRedisDb()
-		redisRepo := repository.NewRedisRepository(redisConn, logger)
-		data, err := redisRepo.Get(context.Background(), "access_token:"+accessToken)
-		if err != nil {
-			fmt.Println(err)
-		}
-		if data == "" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "unauthorized user"})
-			return
-		}
-
-		ctx.Set("user_id", int64(sub.(float64)))
+		ctx.Set("user_id", int64(tokenData.UserID))
+		ctx.Set("session_id", tokenData.SessionID)
+		ctx.Set(ClaimsKey, tokenData.Claims)
 		ctx.Next()
 	}
 }
+
+// GetClaims returns the claims of the access token the request was
+// authenticated with, or nil outside of Auth.
+func GetClaims(ctx *gin.Context) *models.Claims {
+	value, _ := ctx.Get(ClaimsKey)
+	claims, _ := value.(*models.Claims)
+	return claims
+}
@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"auth/models"
+	"auth/service"
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type claimsContextKey struct{}
+
+// ScopeInterceptor authenticates unary gRPC calls with the bearer token of
+// the "authorization" metadata and checks the scopes methodScopes lists for
+// the called method (full method name, e.g. "/user.UserService/ViewFriends").
+// Methods not listed only need a valid token. Client-credentials tokens are
+// accepted, gRPC callers are usually other services.
+func ScopeInterceptor(userService service.UserServiceInterface, methodScopes map[string][]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var accessToken string
+		for _, value := range md.Get("authorization") {
+			if fields := strings.Fields(value); len(fields) == 2 && strings.EqualFold(fields[0], "Bearer") {
+				accessToken = fields[1]
+			}
+		}
+		if accessToken == "" {
+			return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+		}
+
+		tokenData, err := userService.ValidateAccessToken(accessToken)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		if missing := tokenData.Claims.MissingScopes(methodScopes[info.FullMethod]...); len(missing) > 0 {
+			return nil, status.Errorf(codes.PermissionDenied, "missing scopes: %s", strings.Join(missing, " "))
+		}
+
+		return handler(context.WithValue(ctx, claimsContextKey{}, tokenData.Claims), req)
+	}
+}
+
+// ClaimsFromContext returns the claims ScopeInterceptor stored for the call.
+func ClaimsFromContext(ctx context.Context) *models.Claims {
+	claims, _ := ctx.Value(claimsContextKey{}).(*models.Claims)
+	return claims
+}
@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"auth/consts"
+	"auth/models"
+	"auth/rest_errors"
+	"auth/service"
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tokenService knows a fixed set of access tokens.
+type tokenService struct {
+	service.UserServiceInterface
+	tokens map[string]*models.Claims
+}
+
+func (s *tokenService) ValidateAccessToken(accessToken string) (*models.AccessTokenData, error) {
+	claims, ok := s.tokens[accessToken]
+	if !ok {
+		return nil, rest_errors.ErrTokenRevoked
+	}
+	return &models.AccessTokenData{Scope: claims.Scope, ClientID: claims.ClientID, Claims: claims}, nil
+}
+
+func TestScopeInterceptor(t *testing.T) {
+	interceptor := ScopeInterceptor(&tokenService{tokens: map[string]*models.Claims{
+		"reader":  {Scope: consts.ScopeFriendsRead + " " + consts.ScopeUserRead, ClientID: "reader-service"},
+		"no-read": {Scope: consts.ScopeUserRead, ClientID: "other-service"},
+	}}, map[string][]string{
+		"/user.UserService/ViewFriends": {consts.ScopeFriendsRead},
+	})
+
+	for _, test := range []struct {
+		name          string
+		authorization []string
+		method        string
+		code          codes.Code
+	}{
+		{name: "granted", authorization: []string{"Bearer reader"}, method: "/user.UserService/ViewFriends", code: codes.OK},
+		{name: "scheme in lower case", authorization: []string{"bearer reader"}, method: "/user.UserService/ViewFriends", code: codes.OK},
+		{name: "unlisted method", authorization: []string{"Bearer no-read"}, method: "/user.UserService/Other", code: codes.OK},
+		{name: "missing scope", authorization: []string{"Bearer no-read"}, method: "/user.UserService/ViewFriends", code: codes.PermissionDenied},
+		{name: "unknown token", authorization: []string{"Bearer forged"}, method: "/user.UserService/ViewFriends", code: codes.Unauthenticated},
+		{name: "basic auth", authorization: []string{"Basic cmVhZGVyOg=="}, method: "/user.UserService/ViewFriends", code: codes.Unauthenticated},
+		{name: "no metadata", method: "/user.UserService/Other", code: codes.Unauthenticated},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.authorization != nil {
+				ctx = metadata.NewIncomingContext(ctx, metadata.MD{"authorization": test.authorization})
+			}
+
+			var handled *models.Claims
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				handled = ClaimsFromContext(ctx)
+				return "response", nil
+			}
+
+			resp, err := interceptor(ctx, "request", &grpc.UnaryServerInfo{FullMethod: test.method}, handler)
+			if code := status.Code(err); code != test.code {
+				t.Fatalf("code = %v, want %v (%v)", code, test.code, err)
+			}
+			if test.code != codes.OK {
+				if handled != nil || resp != nil {
+					t.Fatal("handler ran for a refused call")
+				}
+				return
+			}
+			if resp != "response" || handled == nil {
+				t.Fatalf("handler did not get the claims, resp = %v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"auth/common/logger"
+	"auth/rest_errors"
+	"auth/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission rejects requests unless the roles of the access token
+// grant every given permission. It has to run after Auth. Roles are only
+// honoured on first-party tokens, a third-party client never acts with the
+// user's admin rights.
+func RequirePermission(roleService service.RoleServiceInterface, permissions ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims := GetClaims(ctx)
+		if claims == nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "You are not logged in"})
+			return
+		}
+
+		allowed := false
+		if claims.ClientID == "" {
+			var err error
+			allowed, err = roleService.HasPermissions(claims.Roles, permissions...)
+			if err != nil {
+				logger.LogError(err)
+				ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"status": "fail", "message": err.Error()})
+				return
+			}
+		}
+
+		if !allowed {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": rest_errors.ErrMissingPermission.Error()})
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,114 @@
+package middlewares
+
+import (
+	"auth/common/logger"
+	"auth/consts"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKeyFunc returns who a request is counted against.
+type RateLimitKeyFunc func(ctx *gin.Context) string
+
+// RateLimitPolicy allows Limit requests per sliding Window for every key. The
+// name keeps the counters of different policies apart.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    RateLimitKeyFunc
+}
+
+// NewRateLimitPolicy builds a policy from a "<requests>/<window>" spec such as
+// "30/1m". An empty spec gives a policy that does not limit anything.
+func NewRateLimitPolicy(name string, spec string, key RateLimitKeyFunc) (RateLimitPolicy, error) {
+	policy := RateLimitPolicy{Name: name, Key: key}
+	if spec == "" {
+		return policy, nil
+	}
+
+	parts := strings.SplitN(spec, "/", 2)
+	if len(parts) != 2 {
+		return policy, fmt.Errorf("invalid rate limit %q for %s, expected <requests>/<window>", spec, name)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit <= 0 {
+		return policy, fmt.Errorf("invalid request count in rate limit %q for %s", spec, name)
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || window < time.Second {
+		return policy, fmt.Errorf("invalid window in rate limit %q for %s", spec, name)
+	}
+
+	policy.Limit = limit
+	policy.Window = window
+	return policy, nil
+}
+
+// KeyByIP counts requests per client IP.
+func KeyByIP(ctx *gin.Context) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// KeyByUser counts requests per signed-in user, falling back to the IP before
+// Auth ran.
+func KeyByUser(ctx *gin.Context) string {
+	if userID, ok := ctx.Get("user_id"); ok {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	return KeyByIP(ctx)
+}
+
+// KeyByClient counts requests per OAuth client once Auth verified the access
+// token of the client. Before that the client_id is only a claim of the
+// caller, who could rotate it for fresh buckets or drain the limit of
+// another client, so those requests are counted per IP.
+func KeyByClient(ctx *gin.Context) string {
+	if claims := GetClaims(ctx); claims != nil && claims.ClientID != "" {
+		return "client:" + claims.ClientID
+	}
+	return KeyByIP(ctx)
+}
+
+// RateLimit enforces the policy with a sliding window kept in redis and sets
+// the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers. Over
+// the limit it answers 429 with Retry-After. If redis is unavailable requests
+// are let through rather than failing the whole API.
+func RateLimit(redisRepo repository.RedisRepositoryInterface, policy RateLimitPolicy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if policy.Limit <= 0 {
+			ctx.Next()
+			return
+		}
+
+		key := consts.RateLimitKey + policy.Name + ":" + policy.Key(ctx)
+		result, err := redisRepo.SlidingWindowHit(context.Background(), key, policy.Limit, policy.Window)
+		if err != nil {
+			logger.LogError("rate limit ", policy.Name, ": ", err)
+			ctx.Next()
+			return
+		}
+
+		reset := int(math.Ceil(result.Reset.Seconds()))
+		ctx.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		ctx.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		ctx.Header("RateLimit-Reset", strconv.Itoa(reset))
+		ctx.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Window.Seconds())))
+
+		if !result.Allowed {
+			ctx.Header("Retry-After", strconv.Itoa(reset))
+			ctx.AbortWithStatusJSON(rest_errors.StatusCode(rest_errors.ErrRateLimited), gin.H{"error": rest_errors.ErrRateLimited.Error()})
+			return
+		}
+
+		ctx.Next()
+	}
+}
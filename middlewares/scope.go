@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"auth/rest_errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScopes rejects requests whose access token lacks any of the given
+// scopes. It has to run after Auth.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims := GetClaims(ctx)
+		if claims == nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "You are not logged in"})
+			return
+		}
+
+		if missing := claims.MissingScopes(scopes...); len(missing) > 0 {
+			ctx.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": rest_errors.ErrInsufficientScope.Error(), "missing_scopes": missing})
+			return
+		}
+
+		ctx.Next()
+	}
+}
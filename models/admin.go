@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// AdminUser is a user account as operators see it.
+type AdminUser struct {
+	ID                    int        `json:"id"`
+	Email                 string     `json:"email"`
+	Name                  string     `json:"name"`
+	UserName              string     `json:"user_name"`
+	Phone                 string     `json:"phone"`
+	Disabled              bool       `json:"disabled"`
+	LockedUntil           *time.Time `json:"locked_until"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	EmailVerified         bool       `json:"email_verified"`
+	PhoneVerified         bool       `json:"phone_verified"`
+	CreatedAt             time.Time  `json:"created_at"`
+	Roles                 []string   `json:"roles,omitempty"`
+}
+
+// AdminUserFilter are the query parameters of the admin user list. Email and
+// UserName match partially, the created dates are inclusive days.
+type AdminUserFilter struct {
+	Email       string    `form:"email"`
+	UserName    string    `form:"user_name"`
+	CreatedFrom time.Time `form:"created_from" time_format:"2006-01-02"`
+	CreatedTo   time.Time `form:"created_to" time_format:"2006-01-02"`
+	Page        int       `form:"page"`
+	PageSize    int       `form:"page_size"`
+}
+
+type AdminUserList struct {
+	Users    []*AdminUser `json:"users"`
+	Total    int          `json:"total"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Claims are the claims of the access and refresh tokens issued by the
+// service. Subject is the user id, or the client id for client-credentials
+// tokens. Purpose is only set on single-use action tokens such as the one of
+// a verification mail.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	IssuedAt  int64    `json:"iat"`
+	NotBefore int64    `json:"nbf"`
+	ID        string   `json:"jti"`
+	ClientID  string   `json:"client_id,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Purpose   string   `json:"purpose,omitempty"`
+}
+
+// Valid checks the time based claims, it is called by the jwt package while
+// parsing.
+func (c *Claims) Valid() error {
+	return jwt.StandardClaims{ExpiresAt: c.ExpiresAt, IssuedAt: c.IssuedAt, NotBefore: c.NotBefore}.Valid()
+}
+
+// MissingScopes returns the scopes out of want the token was not granted.
+func (c *Claims) MissingScopes(want ...string) []string {
+	granted := strings.Fields(c.Scope)
+	missing := []string{}
+	for _, scope := range want {
+		found := false
+		for _, g := range granted {
+			if g == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// Audience is the "aud" claim, which may be a single string or a list.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a Audience) Contains(audience string) bool {
+	for _, value := range a {
+		if value == audience {
+			return true
+		}
+	}
+	return false
+}
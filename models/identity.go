@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Identity is an account at an external login provider that belongs to a
+// user. Subject is the id of the account at the provider.
+type Identity struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Provider   string     `json:"provider"`
+	Subject    string     `json:"-"`
+	Email      string     `json:"email"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// SocialLogInRequest is the redirect back from a provider. Apple posts it as
+// a form, the others send it as query parameters.
+type SocialLogInRequest struct {
+	Provider         string `form:"-"`
+	Code             string `form:"code"`
+	State            string `form:"state"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+	UserAgent        string `form:"-"`
+	IP               string `form:"-"`
+}
+
+// SocialLogInState is kept in redis between the redirect to the provider and
+// the callback.
+type SocialLogInState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	RedirectURI  string `json:"redirect_uri"`
+	DeviceName   string `json:"device_name"`
+	// UserID is set when a logged-in user links the identity instead.
+	UserID int `json:"user_id,omitempty"`
+}
+
+// IdentityLinkRequest either starts linking an identity at Provider, or
+// finishes it with the State and Code the provider redirected with.
+type IdentityLinkRequest struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Code     string `json:"code"`
+	UserID   int    `json:"-"`
+}
+
+// LoginMethods lists every way a user can log in.
+type LoginMethods struct {
+	Password   bool        `json:"password"`
+	Phone      string      `json:"phone,omitempty"`
+	Passkeys   int         `json:"passkeys"`
+	Identities []*Identity `json:"identities"`
+}
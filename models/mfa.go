@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Second factors listed in the mfa_methods of a login that needs one.
+const (
+	MFAMethodTOTP         = "totp"
+	MFAMethodWebAuthn     = "webauthn"
+	MFAMethodRecoveryCode = "recovery_code"
+)
+
+// TOTP is the authenticator app a user confirmed as second factor.
+type TOTP struct {
+	UserID    int       `json:"-"`
+	Secret    string    `json:"-"`
+	EnabledAt time.Time `json:"enabled_at"`
+}
+
+type MFAStatus struct {
+	TOTPEnabled         bool       `json:"totp_enabled"`
+	TOTPEnabledAt       *time.Time `json:"totp_enabled_at,omitempty"`
+	WebAuthnCredentials int        `json:"webauthn_credentials"`
+	RecoveryCodesLeft   int        `json:"recovery_codes_left"`
+}
+
+// TOTPEnrollment is shown once while setting up an authenticator app. URI is
+// the otpauth:// payload of the QR code.
+type TOTPEnrollment struct {
+	Secret    string `json:"secret"`
+	URI       string `json:"otpauth_uri"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+type TOTPConfirmRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RecoveryCodes are shown once; only their hashes are stored.
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// MFAVerifyRequest completes a login that returned an MFA challenge, with
+// a TOTP code, a passkey assertion or a recovery code.
+type MFAVerifyRequest struct {
+	MFAToken     string             `json:"mfa_token" binding:"required"`
+	Code         string             `json:"code"`
+	WebAuthn     *WebAuthnAssertion `json:"webauthn"`
+	RecoveryCode string             `json:"recovery_code"`
+	IP           string             `json:"-"`
+}
+
+// MFAReauthRequest proves the user is present before changing the second
+// factor: the password plus a TOTP code, a passkey assertion or a recovery
+// code. Users without a password only send the second factor.
+type MFAReauthRequest struct {
+	Password     string             `json:"password"`
+	Code         string             `json:"code"`
+	WebAuthn     *WebAuthnAssertion `json:"webauthn"`
+	RecoveryCode string             `json:"recovery_code"`
+	UserID       int                `json:"-"`
+	IP           string             `json:"-"`
+}
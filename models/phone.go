@@ -0,0 +1,23 @@
+package models
+
+// PhoneRequest asks for a code sent by SMS to the number.
+type PhoneRequest struct {
+	Phone  string `json:"phone" binding:"required"`
+	UserID int    `json:"-"`
+	IP     string `json:"-"`
+}
+
+// PhoneVerifyRequest confirms the number of a PhoneRequest with its code.
+type PhoneVerifyRequest struct {
+	Code   string `json:"code" binding:"required"`
+	UserID int    `json:"-"`
+}
+
+// PhoneLogInRequest signs in with a verified number and the code sent to it.
+type PhoneLogInRequest struct {
+	Phone      string `json:"phone" binding:"required"`
+	Code       string `json:"code" binding:"required"`
+	DeviceName string `json:"device_name"`
+	UserAgent  string `json:"-"`
+	IP         string `json:"-"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RateLimitResult describes the state of a rate limit after a request. Reset
+// is the time until the window has room again.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Role struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Permission struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type RoleAssignmentRequest struct {
+	Role string `json:"role"`
+}
+
+type RolePermissionRequest struct {
+	Permission string `json:"permission"`
+}
+
+func (r *Role) Validate() error {
+	return v.ValidateStruct(r,
+		v.Field(&r.Name, v.Required, v.Length(1, 50)),
+	)
+}
+
+func (p *Permission) Validate() error {
+	return v.ValidateStruct(p,
+		v.Field(&p.Name, v.Required, v.Length(1, 100)),
+	)
+}
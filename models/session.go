@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session is a single signed-in device. The session ID is also the ID of the
+// token family its access and refresh tokens belong to.
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	ClientID   string    `json:"client_id,omitempty"`
+	Scope      string    `json:"scope,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
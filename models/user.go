@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"time"
 
 	v "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
@@ -24,11 +25,22 @@ type User struct {
 	Gender         string   `json:"gender"`
 	ProfilePicName string   `json:"profile_pic_name"`
 	ProfilePicPath string   `json:"profile_pic_path"`
+
+	Disabled              bool       `json:"-"`
+	LockedUntil           *time.Time `json:"-"`
+	PasswordResetRequired bool       `json:"-"`
+	EmailVerified         bool       `json:"-"`
+	PhoneVerified         bool       `json:"-"`
 }
 
 type SignInData struct {
-	Email    string `json:"email"`
-	Password string `json:"password,omitempty"`
+	Email      string `json:"email"`
+	Password   string `json:"password,omitempty"`
+	DeviceName string `json:"device_name"`
+	UserAgent  string `json:"-"`
+	IP         string `json:"-"`
+	ClientID   string `json:"-"`
+	Scope      string `json:"-"`
 }
 
 type JWTTokenResponse struct {
@@ -36,6 +48,94 @@ type JWTTokenResponse struct {
 	Token     string `json:"access_token"`
 	Refresh   string `json:"refresh_token"`
 	Email     string `json:"email,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+
+	// Set instead of the tokens when the user still has to pass a second
+	// factor, see POST /api/auth/mfa/verify.
+	MFARequired bool     `json:"mfa_required,omitempty"`
+	MFAToken    string   `json:"mfa_token,omitempty"`
+	MFAMethods  []string `json:"mfa_methods,omitempty"`
+}
+
+// VerifyEmailRequest carries the token of a verification mail.
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResendVerificationRequest asks for a new verification mail.
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// MagicLinkRequest asks for a login link by mail.
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required"`
+	IP    string `json:"-"`
+}
+
+// MagicLinkLogInRequest exchanges the token of a login link for tokens. The
+// confirmation page posts it as a form.
+type MagicLinkLogInRequest struct {
+	Token      string `json:"token" form:"token" binding:"required"`
+	DeviceName string `json:"device_name" form:"device_name"`
+	UserAgent  string `json:"-" form:"-"`
+	IP         string `json:"-" form:"-"`
+}
+
+// UnlockRequest asks for an unlock link for a locked account.
+type UnlockRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// ConfirmUnlockRequest carries the token of an unlock link.
+type ConfirmUnlockRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ForgotPasswordRequest asks for a password reset OTP.
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// ResetPasswordRequest sets a new password with a mailed OTP.
+type ResetPasswordRequest struct {
+	Email    string `json:"email" binding:"required"`
+	OTP      string `json:"otp" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ChangePasswordRequest replaces the password of the signed-in user.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+	UserID          int    `json:"-"`
+	IP              string `json:"-"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// AccessTokenData is the value stored in redis for every issued access token.
+// Tokens of the client-credentials grant have no user and no session. Claims
+// is only set on validated tokens and never stored.
+type AccessTokenData struct {
+	UserID     int     `json:"user_id"`
+	SessionID  string  `json:"session_id"`
+	Generation int64   `json:"generation"`
+	ClientID   string  `json:"client_id,omitempty"`
+	Scope      string  `json:"scope,omitempty"`
+	Claims     *Claims `json:"-"`
+}
+
+// RefreshTokenData is the value stored in redis for every issued refresh token.
+type RefreshTokenData struct {
+	UserID     int     `json:"user_id"`
+	SessionID  string  `json:"session_id"`
+	Generation int64   `json:"generation"`
+	ClientID   string  `json:"client_id,omitempty"`
+	Scope      string  `json:"scope,omitempty"`
+	Claims     *Claims `json:"-"`
 }
 
 func (u *User) Validate() error {
@@ -0,0 +1,130 @@
+package models
+
+import "time"
+
+// WebAuthnCredential is a passkey or security key registered by a user.
+type WebAuthnCredential struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"-"`
+	CredentialID string     `json:"credential_id"`
+	PublicKey    []byte     `json:"-"`
+	SignCount    uint32     `json:"-"`
+	Transports   []string   `json:"transports"`
+	Name         string     `json:"name"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+}
+
+// WebAuthnCreationOptions is the publicKey argument of
+// navigator.credentials.create(). Binary values are base64url encoded.
+type WebAuthnCreationOptions struct {
+	Challenge              string                         `json:"challenge"`
+	RP                     WebAuthnRelyingParty           `json:"rp"`
+	User                   WebAuthnUser                   `json:"user"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+// WebAuthnRequestOptions is the publicKey argument of
+// navigator.credentials.get().
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	Timeout          int64                          `json:"timeout"`
+	RPID             string                         `json:"rpId"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+type WebAuthnRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type WebAuthnUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type WebAuthnCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// WebAuthnAttestation is the JSON serialization of the credential returned by
+// navigator.credentials.create().
+type WebAuthnAttestation struct {
+	ID       string `json:"id" binding:"required"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+		AttestationObject string   `json:"attestationObject" binding:"required"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// WebAuthnAssertion is the JSON serialization of the credential returned by
+// navigator.credentials.get().
+type WebAuthnAssertion struct {
+	ID       string `json:"id" binding:"required"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+		AuthenticatorData string `json:"authenticatorData" binding:"required"`
+		Signature         string `json:"signature" binding:"required"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type WebAuthnRegistrationRequest struct {
+	Name       string              `json:"name"`
+	Credential WebAuthnAttestation `json:"credential" binding:"required"`
+	UserID     int                 `json:"-"`
+}
+
+// WebAuthnRegistration is the stored credential, plus recovery codes when it
+// is the first second factor of the user.
+type WebAuthnRegistration struct {
+	Credential    *WebAuthnCredential `json:"credential"`
+	RecoveryCodes []string            `json:"recovery_codes,omitempty"`
+}
+
+// WebAuthnLogInBeginRequest starts a passwordless login. Without an email the
+// browser offers the passkeys it holds for the site.
+type WebAuthnLogInBeginRequest struct {
+	Email string `json:"email"`
+}
+
+type WebAuthnLogInOptions struct {
+	SessionID string                 `json:"session_id"`
+	PublicKey WebAuthnRequestOptions `json:"publicKey"`
+}
+
+type WebAuthnLogInRequest struct {
+	SessionID  string            `json:"session_id" binding:"required"`
+	Credential WebAuthnAssertion `json:"credential" binding:"required"`
+	DeviceName string            `json:"device_name"`
+	UserAgent  string            `json:"-"`
+	IP         string            `json:"-"`
+}
+
+// WebAuthnChallengeRequest asks for assertion options to answer an MFA
+// challenge with a passkey.
+type WebAuthnChallengeRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	IP       string `json:"-"`
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"database/sql"
+)
+
+type IdentityRepositoryInterface interface {
+	Create(identity *models.Identity) (int, error)
+	CreateWithUser(user models.User, identity *models.Identity) (int, error)
+	FindByProviderSubject(provider string, subject string) (*models.Identity, error)
+	ListByUser(userID int) ([]*models.Identity, error)
+	UpdateLastUsed(id int, email string) error
+	Delete(userID int, id int) (bool, error)
+}
+
+type IdentityRepository struct {
+	Db     *sql.DB
+	logger logger.LoggerInterface
+}
+
+func NewIdentityRepository(Db *sql.DB, logger logger.LoggerInterface) IdentityRepositoryInterface {
+	return &IdentityRepository{Db: Db, logger: logger}
+}
+
+const identityColumns = "id, user_id, provider, subject, COALESCE(email, ''), created_at, last_used_at"
+
+func (r *IdentityRepository) Create(identity *models.Identity) (int, error) {
+	return insertIdentity(r.Db, identity)
+}
+
+// CreateWithUser registers a user without a password together with the
+// identity the user signed up with, so there is no account that cannot be
+// logged in to. It returns the id of the user.
+func (r *IdentityRepository) CreateWithUser(user models.User, identity *models.Identity) (int, error) {
+	tx, err := r.Db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID := 0
+	err = tx.QueryRow("INSERT INTO sm_users (name, email, password, email_verified) VALUES ($1, $2, '', $3) RETURNING id",
+		user.Name, user.Email, user.EmailVerified).Scan(&userID)
+	if err != nil {
+		logger.LogError(err.Error())
+		return 0, err
+	}
+
+	identity.UserID = userID
+	if _, err := insertIdentity(tx, identity); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// FindByProviderSubject returns the identity of the provider account, or nil.
+func (r *IdentityRepository) FindByProviderSubject(provider string, subject string) (*models.Identity, error) {
+	row := r.Db.QueryRow("SELECT "+identityColumns+" FROM user_identities WHERE provider = $1 AND subject = $2", provider, subject)
+	identity, err := scanIdentity(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+func (r *IdentityRepository) ListByUser(userID int) ([]*models.Identity, error) {
+	rows, err := r.Db.Query("SELECT "+identityColumns+" FROM user_identities WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*models.Identity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			logger.LogError(err.Error())
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// UpdateLastUsed records a login with the identity and the email the
+// provider reported for it.
+func (r *IdentityRepository) UpdateLastUsed(id int, email string) error {
+	_, err := r.Db.Exec("UPDATE user_identities SET last_used_at = NOW(), email = $2 WHERE id = $1", id, email)
+	if err != nil {
+		logger.LogError(err.Error())
+	}
+	return err
+}
+
+// Delete removes an identity of the user, unless it is the last way the user
+// can log in (ErrLastLoginMethod).
+func (r *IdentityRepository) Delete(userID int, id int) (bool, error) {
+	return removeLoginMethod(r.Db, userID, func(tx *sql.Tx) (bool, error) {
+		result, err := tx.Exec("DELETE FROM user_identities WHERE id = $1 AND user_id = $2", id, userID)
+		if err != nil {
+			logger.LogError(err.Error())
+			return false, err
+		}
+
+		rows, err := result.RowsAffected()
+		return rows > 0, err
+	})
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func insertIdentity(db queryRower, identity *models.Identity) (int, error) {
+	err := db.QueryRow(`
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email).Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		logger.LogError(err.Error())
+		return 0, err
+	}
+
+	return identity.ID, nil
+}
+
+type identityScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIdentity(row identityScanner) (*models.Identity, error) {
+	identity := &models.Identity{}
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email,
+		&identity.CreatedAt, &identity.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
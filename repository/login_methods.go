@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"auth/common/logger"
+	"database/sql"
+	"errors"
+)
+
+// ErrLastLoginMethod is returned by changes that would leave a user without a
+// way to log in. Nothing was changed then.
+var ErrLastLoginMethod = errors.New("repository: last login method")
+
+// removeLoginMethod runs remove in a transaction that holds the row of the
+// user, so concurrent removals for one user run one after the other and the
+// second sees what the first left. The change is rolled back when the user
+// has no password, verified phone, passkey or provider identity afterwards.
+func removeLoginMethod(db *sql.DB, userID int, remove func(tx *sql.Tx) (bool, error)) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT id FROM sm_users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		logger.LogError(err.Error())
+		return false, err
+	}
+
+	changed, err := remove(tx)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	canLogIn := false
+	err = tx.QueryRow(`
+		SELECT COALESCE(password, '') <> ''
+			OR phone_verified
+			OR EXISTS (SELECT 1 FROM webauthn_credentials WHERE user_id = $1)
+			OR EXISTS (SELECT 1 FROM user_identities WHERE user_id = $1)
+		FROM sm_users WHERE id = $1`, userID).Scan(&canLogIn)
+	if err != nil {
+		logger.LogError(err.Error())
+		return false, err
+	}
+	if !canLogIn {
+		return false, ErrLastLoginMethod
+	}
+
+	return true, tx.Commit()
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"database/sql"
+)
+
+type MFARepositoryInterface interface {
+	FindTOTP(userID int) (*models.TOTP, error)
+	EnableTOTP(userID int, secret string, recoveryCodeHashes []string) error
+	DisableTOTP(userID int, keepRecoveryCodes bool) error
+	ReplaceRecoveryCodes(userID int, recoveryCodeHashes []string) error
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	CountRecoveryCodes(userID int) (int, error)
+}
+
+type MFARepository struct {
+	Db     *sql.DB
+	logger logger.LoggerInterface
+}
+
+func NewMFARepository(Db *sql.DB, logger logger.LoggerInterface) MFARepositoryInterface {
+	return &MFARepository{Db: Db, logger: logger}
+}
+
+// FindTOTP returns the confirmed TOTP of the user, or nil.
+func (r *MFARepository) FindTOTP(userID int) (*models.TOTP, error) {
+	totp := &models.TOTP{UserID: userID}
+	err := r.Db.QueryRow("SELECT totp_secret, enabled_at FROM user_mfa WHERE user_id = $1", userID).Scan(&totp.Secret, &totp.EnabledAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+
+	return totp, nil
+}
+
+// EnableTOTP stores the confirmed secret together with a fresh set of
+// recovery codes.
+func (r *MFARepository) EnableTOTP(userID int, secret string, recoveryCodeHashes []string) error {
+	tx, err := r.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO user_mfa (user_id, totp_secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET totp_secret = EXCLUDED.totp_secret, enabled_at = NOW()`, userID, secret)
+	if err != nil {
+		logger.LogError(err.Error())
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP removes the secret and, unless another second factor still
+// needs them, the recovery codes.
+func (r *MFARepository) DisableTOTP(userID int, keepRecoveryCodes bool) error {
+	tx, err := r.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = $1", userID); err != nil {
+		logger.LogError(err.Error())
+		return err
+	}
+	if keepRecoveryCodes {
+		return tx.Commit()
+	}
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		logger.LogError(err.Error())
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *MFARepository) ReplaceRecoveryCodes(userID int, recoveryCodeHashes []string) error {
+	tx, err := r.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused code as used and reports whether there was
+// one.
+func (r *MFARepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	result, err := r.Db.Exec("UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL", userID, codeHash)
+	if err != nil {
+		logger.LogError(err.Error())
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes.
+func (r *MFARepository) CountRecoveryCodes(userID int) (int, error) {
+	count := 0
+	err := r.Db.QueryRow("SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, recoveryCodeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		logger.LogError(err.Error())
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec("INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash); err != nil {
+			logger.LogError(err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
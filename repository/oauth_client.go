@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type OAuthClientRepositoryInterface interface {
+	Create(client models.OAuthClient) (int, error)
+	FindByClientID(clientID string) (*models.OAuthClient, error)
+}
+
+type OAuthClientRepository struct {
+	Db     *sql.DB
+	logger logger.LoggerInterface
+}
+
+func NewOAuthClientRepository(Db *sql.DB, logger logger.LoggerInterface) OAuthClientRepositoryInterface {
+	return &OAuthClientRepository{Db: Db, logger: logger}
+}
+
+func (r *OAuthClientRepository) Create(client models.OAuthClient) (int, error) {
+	var lastInsertedID int
+	query := `
+		INSERT INTO oauth_clients (client_id, client_secret, name, redirect_uris, grant_types, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	err := r.Db.QueryRow(query, client.ClientID, client.ClientSecret, client.Name,
+		pq.Array(client.RedirectURIs), pq.Array(client.GrantTypes), pq.Array(client.Scopes)).Scan(&lastInsertedID)
+	if err != nil {
+		return 0, err
+	}
+
+	return lastInsertedID, nil
+}
+
+func (r *OAuthClientRepository) FindByClientID(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := r.Db.QueryRow(`
+		SELECT id, client_id, COALESCE(client_secret,''), COALESCE(name,''), redirect_uris, grant_types, scopes, created_at
+		FROM oauth_clients
+		WHERE client_id = $1`, clientID).Scan(&client.ID, &client.ClientID, &client.ClientSecret, &client.Name,
+		pq.Array(&client.RedirectURIs), pq.Array(&client.GrantTypes), pq.Array(&client.Scopes), &client.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+
+	return &client, nil
+}
@@ -2,7 +2,11 @@ package repository
 
 import (
 	"auth/common/logger"
+	"auth/models"
 	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -18,6 +22,10 @@ type RedisRepositoryInterface interface {
 	Exists(ctx context.Context, key string, field string) bool
 	SetValue(ctx context.Context, key string, value string, expiration time.Duration) error
 	Get(ctx context.Context, key string) (string, error)
+	SetNX(ctx context.Context, key string, value string, expiration time.Duration) (bool, error)
+	Incr(ctx context.Context, key string) (int64, error)
+	GetAndDelete(ctx context.Context, key string) (string, error)
+	SlidingWindowHit(ctx context.Context, key string, limit int, window time.Duration) (*models.RateLimitResult, error)
 }
 
 type RedisRepository struct {
@@ -48,6 +56,88 @@ func (r RedisRepository) SetValue(ctx context.Context, key string, value string,
 	return nil
 }
 
+func (r RedisRepository) SetNX(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
+	ok, err := r.RedisClient.SetNX(key, value, expiration).Result()
+	if err != nil {
+		logger.LogError(err)
+		return false, err
+	}
+	return ok, nil
+}
+
+func (r RedisRepository) Incr(ctx context.Context, key string) (int64, error) {
+	value, err := r.RedisClient.Incr(key).Result()
+	if err != nil {
+		logger.LogError(err)
+		return 0, err
+	}
+	return value, nil
+}
+
+// GetAndDelete atomically reads and removes a key, so the value can be
+// consumed only once.
+func (r RedisRepository) GetAndDelete(ctx context.Context, key string) (string, error) {
+	pipe := r.RedisClient.TxPipeline()
+	get := pipe.Get(key)
+	pipe.Del(key)
+	_, err := pipe.Exec()
+	if err != nil {
+		return "", err
+	}
+	return get.Val(), nil
+}
+
+// slidingWindowScript keeps the timestamps of the hits of the last window in a
+// sorted set. It records the hit only if the limit is not reached yet and
+// returns {allowed, remaining, milliseconds until the oldest hit drops out}.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	count = count + 1
+	allowed = 1
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+local reset = 0
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - count, reset}
+`)
+
+// SlidingWindowHit counts a hit against a sliding window rate limit.
+func (r RedisRepository) SlidingWindowHit(ctx context.Context, key string, limit int, window time.Duration) (*models.RateLimitResult, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	member := strconv.FormatInt(now, 10) + "-" + strconv.FormatInt(rand.Int63(), 36)
+
+	values, err := slidingWindowScript.Run(r.RedisClient, []string{key}, now, window.Milliseconds(), limit, member).Result()
+	if err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+
+	result, ok := values.([]interface{})
+	if !ok || len(result) != 3 {
+		return nil, fmt.Errorf("unexpected rate limit script result %v", values)
+	}
+	allowed, _ := result[0].(int64)
+	remaining, _ := result[1].(int64)
+	reset, _ := result[2].(int64)
+
+	return &models.RateLimitResult{
+		Allowed:   allowed == 1,
+		Limit:     limit,
+		Remaining: int(remaining),
+		Reset:     time.Duration(reset) * time.Millisecond,
+	}, nil
+}
+
 func (r RedisRepository) Set(ctx context.Context, key string, value map[string]interface{}) error {
 	logger.LogInfo("set to redis ", key)
 	err := r.RedisClient.HMSet(key, value).Err()
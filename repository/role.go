@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type RoleRepositoryInterface interface {
+	CreateRole(role models.Role) (int, error)
+	FindRoleByName(name string) (*models.Role, error)
+	ListRoles() ([]*models.Role, error)
+	CreatePermission(permission models.Permission) (int, error)
+	FindPermissionByName(name string) (*models.Permission, error)
+	ListPermissions() ([]*models.Permission, error)
+	AddRolePermission(roleID int, permissionID int) error
+	RemoveRolePermission(roleID int, permissionID int) error
+	AssignRole(userID int, roleID int) error
+	UnassignRole(userID int, roleID int) error
+	UserRoles(userID int) ([]string, error)
+	RolePermissions(roles []string) ([]string, error)
+}
+
+type RoleRepository struct {
+	Db     *sql.DB
+	logger logger.LoggerInterface
+}
+
+func NewRoleRepository(Db *sql.DB, logger logger.LoggerInterface) RoleRepositoryInterface {
+	return &RoleRepository{Db: Db, logger: logger}
+}
+
+func (r *RoleRepository) CreateRole(role models.Role) (int, error) {
+	var lastInsertedID int
+	err := r.Db.QueryRow("INSERT INTO roles (name, description) VALUES ($1, $2) RETURNING id", role.Name, role.Description).Scan(&lastInsertedID)
+	if err != nil {
+		return 0, err
+	}
+
+	return lastInsertedID, nil
+}
+
+func (r *RoleRepository) FindRoleByName(name string) (*models.Role, error) {
+	var role models.Role
+	err := r.Db.QueryRow(`
+		SELECT r.id, r.name, COALESCE(r.description,''), r.created_at,
+			COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		WHERE r.name = $1
+		GROUP BY r.id`, name).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, pq.Array(&role.Permissions))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (r *RoleRepository) ListRoles() ([]*models.Role, error) {
+	rows, err := r.Db.Query(`
+		SELECT r.id, r.name, COALESCE(r.description,''), r.created_at,
+			COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		GROUP BY r.id
+		ORDER BY r.name`)
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*models.Role{}
+	for rows.Next() {
+		role := &models.Role{}
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, pq.Array(&role.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (r *RoleRepository) CreatePermission(permission models.Permission) (int, error) {
+	var lastInsertedID int
+	err := r.Db.QueryRow("INSERT INTO permissions (name, description) VALUES ($1, $2) RETURNING id", permission.Name, permission.Description).Scan(&lastInsertedID)
+	if err != nil {
+		return 0, err
+	}
+
+	return lastInsertedID, nil
+}
+
+func (r *RoleRepository) FindPermissionByName(name string) (*models.Permission, error) {
+	var permission models.Permission
+	err := r.Db.QueryRow("SELECT id, name, COALESCE(description,'') FROM permissions WHERE name = $1", name).Scan(&permission.ID, &permission.Name, &permission.Description)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+
+	return &permission, nil
+}
+
+func (r *RoleRepository) ListPermissions() ([]*models.Permission, error) {
+	rows, err := r.Db.Query("SELECT id, name, COALESCE(description,'') FROM permissions ORDER BY name")
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*models.Permission{}
+	for rows.Next() {
+		permission := &models.Permission{}
+		if err := rows.Scan(&permission.ID, &permission.Name, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+func (r *RoleRepository) AddRolePermission(roleID int, permissionID int) error {
+	_, err := r.Db.Exec("INSERT INTO role_permissions (role_id, permission_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", roleID, permissionID)
+	return err
+}
+
+func (r *RoleRepository) RemoveRolePermission(roleID int, permissionID int) error {
+	_, err := r.Db.Exec("DELETE FROM role_permissions WHERE role_id = $1 AND permission_id = $2", roleID, permissionID)
+	return err
+}
+
+func (r *RoleRepository) AssignRole(userID int, roleID int) error {
+	_, err := r.Db.Exec("INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, roleID)
+	return err
+}
+
+func (r *RoleRepository) UnassignRole(userID int, roleID int) error {
+	_, err := r.Db.Exec("DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2", userID, roleID)
+	return err
+}
+
+func (r *RoleRepository) UserRoles(userID int) ([]string, error) {
+	rows, err := r.Db.Query(`
+		SELECT r.name
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = $1
+		ORDER BY r.name`, userID)
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// RolePermissions returns the distinct permissions granted by the roles.
+func (r *RoleRepository) RolePermissions(roles []string) ([]string, error) {
+	rows, err := r.Db.Query(`
+		SELECT DISTINCT p.name
+		FROM roles r
+		JOIN role_permissions rp ON rp.role_id = r.id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE r.name = ANY($1)`, pq.Array(roles))
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
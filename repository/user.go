@@ -5,6 +5,9 @@ import (
 	"auth/models"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -22,6 +25,17 @@ type UserRepositoryInterface interface {
 	ViewFriends(userID int) ([]*models.User, error)
 	IsAlreadyRequestSent(userID int, requestedID int) error
 	IsAlreadyRequestAccepter(userID int, requestedID int) error
+	ListUsers(filter models.AdminUserFilter) ([]*models.AdminUser, int, error)
+	FindAdminUser(userID int) (*models.AdminUser, error)
+	SetDisabled(userID int, disabled bool) error
+	SetLockedUntil(userID int, lockedUntil *time.Time) error
+	SetPasswordResetRequired(userID int, required bool) error
+	SetEmailVerified(userID int, verified bool) error
+	SetPhoneVerified(userID int, phone string) (bool, error)
+	FindByVerifiedPhone(phone string) (*models.User, error)
+	UpdatePassword(userID int, password string) error
+	PasswordHistory(userID int, limit int) ([]string, error)
+	ReplacePasswordHash(userID int, oldHash string, newHash string) error
 }
 
 type UserRepository struct {
@@ -54,9 +68,11 @@ func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
 	logger.LogInfo(email)
 	var user models.User
 	err := r.Db.QueryRow(`
-		SELECT id, email, password, name, COALESCE(user_name,''), COALESCE(phone,''), COALESCE(bio,''), COALESCE(gender,'')
+		SELECT id, email, password, name, COALESCE(user_name,''), COALESCE(phone,''), COALESCE(bio,''), COALESCE(gender,''),
+			disabled, locked_until, password_reset_required, email_verified, phone_verified
 		FROM sm_users
-		WHERE email = $1`, email).Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.UserName, &user.Phone, &user.Bio, &user.Gender)
+		WHERE lower(email) = lower($1)`, email).Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.UserName, &user.Phone, &user.Bio, &user.Gender,
+		&user.Disabled, &user.LockedUntil, &user.PasswordResetRequired, &user.EmailVerified, &user.PhoneVerified)
 	if err != nil {
 		logger.LogError(err.Error())
 		if err.Error() == "sql: no rows in result set" {
@@ -69,12 +85,15 @@ func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
+// UpdateProfile saves the profile. A changed phone loses its verification,
+// which is refused with ErrLastLoginMethod when the user could log in with
+// nothing else.
 func (r *UserRepository) UpdateProfile(user *models.User) error {
-	_, err := r.Db.Exec("UPDATE sm_users SET name = $1, email = $2, password = $3, user_name = $4, phone = $5, bio = $6, gender = $7 WHERE id = $8", user.Name, user.Email, user.Password, user.UserName, user.Phone, user.Bio, user.Gender, user.ID)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := removeLoginMethod(r.Db, user.ID, func(tx *sql.Tx) (bool, error) {
+		_, err := tx.Exec("UPDATE sm_users SET name = $1, email = $2, email_verified = email_verified AND email = $2, user_name = $3, phone = $4, phone_verified = phone_verified AND phone IS NOT DISTINCT FROM $4, bio = $5, gender = $6 WHERE id = $7", user.Name, user.Email, user.UserName, user.Phone, user.Bio, user.Gender, user.ID)
+		return err == nil, err
+	})
+	return err
 }
 
 func (r *UserRepository) UpdateWebsites(urls []string, userID int) error {
@@ -90,9 +109,11 @@ func (r *UserRepository) UpdateWebsites(urls []string, userID int) error {
 func (r *UserRepository) FindByID(userID int) (*models.User, error) {
 	var user models.User
 	err := r.Db.QueryRow(`
-		SELECT id, email, password, name, COALESCE(user_name,''), COALESCE(phone,''), COALESCE(bio,''), COALESCE(gender,'')
+		SELECT id, email, password, name, COALESCE(user_name,''), COALESCE(phone,''), COALESCE(bio,''), COALESCE(gender,''),
+			disabled, locked_until, password_reset_required, email_verified, phone_verified
 		FROM sm_users
-		WHERE id = $1`, userID).Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.UserName, &user.Phone, &user.Bio, &user.Gender)
+		WHERE id = $1`, userID).Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.UserName, &user.Phone, &user.Bio, &user.Gender,
+		&user.Disabled, &user.LockedUntil, &user.PasswordResetRequired, &user.EmailVerified, &user.PhoneVerified)
 	if err != nil && err.Error() == "sql: no rows in result set" {
 		return nil, errors.New("user not found")
 	}
@@ -264,3 +285,190 @@ func (r *UserRepository) IsAlreadyRequestAccepter(userID int, requestedID int) e
 
 	return errors.New("exists")
 }
+
+// ListUsers returns one page of users matching the filter and the number of
+// all matching users.
+func (r *UserRepository) ListUsers(filter models.AdminUserFilter) ([]*models.AdminUser, int, error) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if filter.Email != "" {
+		args = append(args, "%"+filter.Email+"%")
+		conditions = append(conditions, fmt.Sprintf("email ILIKE $%d", len(args)))
+	}
+	if filter.UserName != "" {
+		args = append(args, "%"+filter.UserName+"%")
+		conditions = append(conditions, fmt.Sprintf("user_name ILIKE $%d", len(args)))
+	}
+	if !filter.CreatedFrom.IsZero() {
+		args = append(args, filter.CreatedFrom)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !filter.CreatedTo.IsZero() {
+		args = append(args, filter.CreatedTo.AddDate(0, 0, 1))
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	total := 0
+	if err := r.Db.QueryRow("SELECT COUNT(*) FROM sm_users "+where, args...).Scan(&total); err != nil {
+		logger.LogError(err.Error())
+		return nil, 0, err
+	}
+
+	args = append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)
+	rows, err := r.Db.Query(fmt.Sprintf(`
+		SELECT id, COALESCE(email,''), COALESCE(name,''), COALESCE(user_name,''), COALESCE(phone,''),
+			disabled, locked_until, password_reset_required, email_verified, phone_verified, created_at
+		FROM sm_users
+		%s
+		ORDER BY id
+		LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*models.AdminUser{}
+	for rows.Next() {
+		user := &models.AdminUser{}
+		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.UserName, &user.Phone,
+			&user.Disabled, &user.LockedUntil, &user.PasswordResetRequired, &user.EmailVerified, &user.PhoneVerified, &user.CreatedAt); err != nil {
+			logger.LogError(err.Error())
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+func (r *UserRepository) FindAdminUser(userID int) (*models.AdminUser, error) {
+	user := &models.AdminUser{}
+	err := r.Db.QueryRow(`
+		SELECT id, COALESCE(email,''), COALESCE(name,''), COALESCE(user_name,''), COALESCE(phone,''),
+			disabled, locked_until, password_reset_required, email_verified, phone_verified, created_at
+		FROM sm_users
+		WHERE id = $1`, userID).Scan(&user.ID, &user.Email, &user.Name, &user.UserName, &user.Phone,
+		&user.Disabled, &user.LockedUntil, &user.PasswordResetRequired, &user.EmailVerified, &user.PhoneVerified, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) SetDisabled(userID int, disabled bool) error {
+	_, err := r.Db.Exec("UPDATE sm_users SET disabled = $1 WHERE id = $2", disabled, userID)
+	return err
+}
+
+func (r *UserRepository) SetLockedUntil(userID int, lockedUntil *time.Time) error {
+	_, err := r.Db.Exec("UPDATE sm_users SET locked_until = $1 WHERE id = $2", lockedUntil, userID)
+	return err
+}
+
+func (r *UserRepository) SetPasswordResetRequired(userID int, required bool) error {
+	_, err := r.Db.Exec("UPDATE sm_users SET password_reset_required = $1 WHERE id = $2", required, userID)
+	return err
+}
+
+func (r *UserRepository) SetEmailVerified(userID int, verified bool) error {
+	_, err := r.Db.Exec("UPDATE sm_users SET email_verified = $1 WHERE id = $2", verified, userID)
+	return err
+}
+
+// SetPhoneVerified stores the phone number as verified unless another
+// account verified it already, which is reported as false.
+func (r *UserRepository) SetPhoneVerified(userID int, phone string) (bool, error) {
+	result, err := r.Db.Exec(`
+		UPDATE sm_users SET phone = $1, phone_verified = TRUE
+		WHERE id = $2 AND NOT EXISTS (SELECT 1 FROM sm_users WHERE phone = $1 AND phone_verified AND id <> $2)`, phone, userID)
+	if err != nil {
+		logger.LogError(err.Error())
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// FindByVerifiedPhone returns the user who verified the phone number, or nil.
+func (r *UserRepository) FindByVerifiedPhone(phone string) (*models.User, error) {
+	userID := 0
+	err := r.Db.QueryRow("SELECT id FROM sm_users WHERE phone = $1 AND phone_verified", phone).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+
+	return r.FindByID(userID)
+}
+
+// UpdatePassword stores a new password hash, which also satisfies a forced
+// password reset. The replaced hash is moved to the password history.
+func (r *UserRepository) UpdatePassword(userID int, password string) error {
+	tx, err := r.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO password_history (user_id, password)
+		SELECT id, password FROM sm_users WHERE id = $1 AND COALESCE(password, '') <> ''`, userID)
+	if err != nil {
+		logger.LogError(err.Error())
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE sm_users SET password = $1, password_reset_required = FALSE WHERE id = $2", password, userID)
+	if err != nil {
+		logger.LogError(err.Error())
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplacePasswordHash swaps the hash of an unchanged password for a new hash
+// of the same password. It does nothing if the password was changed in the
+// meantime.
+func (r *UserRepository) ReplacePasswordHash(userID int, oldHash string, newHash string) error {
+	_, err := r.Db.Exec("UPDATE sm_users SET password = $1 WHERE id = $2 AND password = $3", newHash, userID, oldHash)
+	return err
+}
+
+// PasswordHistory returns the most recent previous password hashes of the
+// user, newest first.
+func (r *UserRepository) PasswordHistory(userID int, limit int) ([]string, error) {
+	rows, err := r.Db.Query("SELECT password FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2", userID, limit)
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, rows.Err()
+}
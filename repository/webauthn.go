@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type WebAuthnRepositoryInterface interface {
+	Create(credential *models.WebAuthnCredential) (int, error)
+	FindByCredentialID(credentialID string) (*models.WebAuthnCredential, error)
+	ListByUser(userID int) ([]*models.WebAuthnCredential, error)
+	CountByUser(userID int) (int, error)
+	UpdateSignCount(id int, oldCount uint32, newCount uint32) (bool, error)
+	Delete(userID int, id int) (bool, error)
+}
+
+type WebAuthnRepository struct {
+	Db     *sql.DB
+	logger logger.LoggerInterface
+}
+
+func NewWebAuthnRepository(Db *sql.DB, logger logger.LoggerInterface) WebAuthnRepositoryInterface {
+	return &WebAuthnRepository{Db: Db, logger: logger}
+}
+
+const webAuthnCredentialColumns = "id, user_id, credential_id, public_key, sign_count, transports, COALESCE(name, ''), created_at, last_used_at"
+
+func (r *WebAuthnRepository) Create(credential *models.WebAuthnCredential) (int, error) {
+	id := 0
+	err := r.Db.QueryRow(`
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, transports, name)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		credential.UserID, credential.CredentialID, credential.PublicKey, int64(credential.SignCount),
+		pq.Array(credential.Transports), credential.Name).Scan(&id, &credential.CreatedAt)
+	if err != nil {
+		logger.LogError(err.Error())
+		return 0, err
+	}
+
+	credential.ID = id
+	return id, nil
+}
+
+// FindByCredentialID returns the credential with the base64url encoded id,
+// or nil.
+func (r *WebAuthnRepository) FindByCredentialID(credentialID string) (*models.WebAuthnCredential, error) {
+	row := r.Db.QueryRow("SELECT "+webAuthnCredentialColumns+" FROM webauthn_credentials WHERE credential_id = $1", credentialID)
+	credential, err := scanWebAuthnCredential(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+func (r *WebAuthnRepository) ListByUser(userID int) ([]*models.WebAuthnCredential, error) {
+	rows, err := r.Db.Query("SELECT "+webAuthnCredentialColumns+" FROM webauthn_credentials WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		logger.LogError(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []*models.WebAuthnCredential{}
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			logger.LogError(err.Error())
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+func (r *WebAuthnRepository) CountByUser(userID int) (int, error) {
+	count := 0
+	err := r.Db.QueryRow("SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = $1", userID).Scan(&count)
+	return count, err
+}
+
+// UpdateSignCount stores the sign count of an assertion, but only if no
+// other assertion changed it in the meantime.
+func (r *WebAuthnRepository) UpdateSignCount(id int, oldCount uint32, newCount uint32) (bool, error) {
+	result, err := r.Db.Exec("UPDATE webauthn_credentials SET sign_count = $3, last_used_at = NOW() WHERE id = $1 AND sign_count = $2",
+		id, int64(oldCount), int64(newCount))
+	if err != nil {
+		logger.LogError(err.Error())
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Delete removes a passkey of the user, unless it is the last way the user
+// can log in (ErrLastLoginMethod).
+func (r *WebAuthnRepository) Delete(userID int, id int) (bool, error) {
+	return removeLoginMethod(r.Db, userID, func(tx *sql.Tx) (bool, error) {
+		result, err := tx.Exec("DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2", id, userID)
+		if err != nil {
+			logger.LogError(err.Error())
+			return false, err
+		}
+
+		rows, err := result.RowsAffected()
+		return rows > 0, err
+	})
+}
+
+type webAuthnScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebAuthnCredential(row webAuthnScanner) (*models.WebAuthnCredential, error) {
+	credential := &models.WebAuthnCredential{}
+	signCount := int64(0)
+	err := row.Scan(&credential.ID, &credential.UserID, &credential.CredentialID, &credential.PublicKey, &signCount,
+		pq.Array(&credential.Transports), &credential.Name, &credential.CreatedAt, &credential.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	credential.SignCount = uint32(signCount)
+	return credential, nil
+}
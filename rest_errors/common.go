@@ -1,6 +1,9 @@
 package rest_errors
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Authentication based
 
@@ -24,6 +27,14 @@ func Invalid(attribute string) string {
 	return fmt.Sprintf("invalid %v", attribute)
 }
 
+func PasswordLength(min int, max int) string {
+	return fmt.Sprintf("password must be %d to %d characters long", min, max)
+}
+
+func PasswordCharacterClasses(classes []string) string {
+	return fmt.Sprintf("password must contain at least one character of each: %v", strings.Join(classes, ", "))
+}
+
 // Resource based
 
 func Create(entity interface{}) string {
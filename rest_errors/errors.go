@@ -24,6 +24,52 @@ var (
 	ErrCreatingForgotPasswordOTP  = NewError("failed to create the OTP", http.StatusInternalServerError)
 	ErrUsingPrivateEmail          = NewError("you cannot use a hidden email to sign in.", http.StatusUnauthorized)
 	ErrFetchingEmail              = NewError("failed to fetch email from provider", http.StatusUnauthorized)
+	ErrInvalidRefreshToken        = NewError("invalid or expired refresh token", http.StatusUnauthorized)
+	ErrRefreshTokenReused         = NewError("refresh token has already been used", http.StatusUnauthorized)
+	ErrUnauthorized               = NewError("unauthorized user", http.StatusUnauthorized)
+	ErrSessionRevoked             = NewError("session has been revoked", http.StatusUnauthorized)
+	ErrSessionNotFound            = NewError(NotFound("session"), http.StatusNotFound)
+	ErrTokenRevoked               = NewError("token has been revoked", http.StatusUnauthorized)
+	ErrInsufficientScope          = NewError("token does not have the required scope", http.StatusForbidden)
+	ErrMissingPermission          = NewError("you do not have permission to do this", http.StatusForbidden)
+	ErrUserNotFound               = NewError(NotFound("user"), http.StatusNotFound)
+	ErrRoleNotFound               = NewError(NotFound("role"), http.StatusNotFound)
+	ErrPermissionNotFound         = NewError(NotFound("permission"), http.StatusNotFound)
+	ErrRoleAlreadyExists          = NewError("role already exists", http.StatusConflict)
+	ErrPermissionAlreadyExists    = NewError("permission already exists", http.StatusConflict)
+	ErrAccountDisabled            = NewError("the account has been disabled", http.StatusForbidden)
+	ErrAccountLocked              = NewError("the account is temporarily locked", http.StatusLocked)
+	ErrPasswordResetRequired      = NewError("the password has to be reset before signing in", http.StatusForbidden)
+	ErrDisablingOwnAccount        = NewError("you cannot disable your own account", http.StatusBadRequest)
+	ErrTooManyLoginAttempts       = NewError("too many failed login attempts, try again later", http.StatusTooManyRequests)
+	ErrRateLimited                = NewError("too many requests, try again later", http.StatusTooManyRequests)
+	ErrEmailNotVerified           = NewError("the email address has not been verified", http.StatusForbidden)
+	ErrInvalidVerificationToken   = NewError("invalid or expired verification token", http.StatusBadRequest)
+	ErrInvalidMagicLink           = NewError("invalid or expired login link", http.StatusUnauthorized)
+	ErrInvalidUnlockToken         = NewError("invalid or expired unlock link", http.StatusBadRequest)
+	ErrSendingMail                = NewError("failed to send the mail", http.StatusInternalServerError)
+	ErrInvalidOTP                 = NewError("invalid or expired OTP", http.StatusBadRequest)
+	ErrPhoneAlreadyRegistered     = NewError("the phone number belongs to another account", http.StatusConflict)
+	ErrSendingSMS                 = NewError("failed to send the text message", http.StatusInternalServerError)
+	ErrInvalidSocialLogInState    = NewError("invalid or expired login state, start again", http.StatusBadRequest)
+	ErrSocialLogIn                = NewError("the login with the provider failed", http.StatusUnauthorized)
+	ErrIdentityNotFound           = NewError(NotFound("identity"), http.StatusNotFound)
+	ErrIdentityLinkedElsewhere    = NewError("the identity is linked to another account", http.StatusConflict)
+	ErrLastLoginMethod            = NewError("the last way to log in cannot be removed, set a password or link another login first", http.StatusConflict)
+	ErrIncorrectPassword          = NewError("the current password is incorrect", http.StatusBadRequest)
+	ErrMFAAlreadyEnabled          = NewError("two-factor authentication is already enabled", http.StatusConflict)
+	ErrMFANotEnabled              = NewError("two-factor authentication is not enabled", http.StatusBadRequest)
+	ErrMFAEnrollmentNotFound      = NewError("no pending two-factor enrollment, start again", http.StatusBadRequest)
+	ErrInvalidMFACode             = NewError("invalid two-factor code", http.StatusUnauthorized)
+	ErrInvalidMFAToken            = NewError("invalid or expired MFA token, log in again", http.StatusUnauthorized)
+	ErrWebAuthnChallengeNotFound  = NewError("no pending passkey challenge, start again", http.StatusBadRequest)
+	ErrInvalidWebAuthnCredential  = NewError("the passkey could not be verified", http.StatusUnauthorized)
+	ErrWebAuthnCredentialExists   = NewError("the passkey is already registered", http.StatusConflict)
+	ErrWebAuthnCredentialNotFound = NewError(NotFound("passkey"), http.StatusNotFound)
+
+	ErrPasswordTooCommon            = NewError("the password is too common, choose another one", http.StatusBadRequest)
+	ErrPasswordContainsPersonalInfo = NewError("the password must not contain your email, user name or name", http.StatusBadRequest)
+	ErrPasswordBreached             = NewError("the password appeared in a data breach, choose another one", http.StatusBadRequest)
 
 	InvalidSigningMethod  = NewError("invalid signing method while parsing jwt", http.StatusUnauthorized)
 	InvalidPasswordFormat = NewError("minimum 8 characters with at least 1 uppercase letter(A-Z), 1 lowercase letter(a-z), 1 number(0-9) and 1 special character(.!@#~$%^&*()+|_<>)", http.StatusBadRequest)
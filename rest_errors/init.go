@@ -1,6 +1,9 @@
 package rest_errors
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+)
 
 // Map for errors with http code
 var ResponseCode = make(map[string]int, 0)
@@ -16,3 +19,16 @@ func NewError(message string, httpCode int) error {
 	}
 	return errors.New(message)
 }
+
+// StatusCode returns the http code of a StatusError or the one registered for
+// err, or 400 when the error was not created through NewError.
+func StatusCode(err error) int {
+	statusErr := &StatusError{}
+	if errors.As(err, &statusErr) {
+		return statusErr.HttpCode
+	}
+	if code, ok := ResponseCode[err.Error()]; ok {
+		return code
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,46 @@
+package rest_errors
+
+import "net/http"
+
+// OAuthError is an error of the OAuth2 endpoints. It is rendered as the
+// error response of RFC 6749 section 5.2.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	HttpCode    int    `json:"-"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func NewOAuthError(code string, description string, httpCode int) *OAuthError {
+	return &OAuthError{Code: code, Description: description, HttpCode: httpCode}
+}
+
+func InvalidRequest(description string) *OAuthError {
+	return NewOAuthError("invalid_request", description, http.StatusBadRequest)
+}
+
+func InvalidGrant(description string) *OAuthError {
+	return NewOAuthError("invalid_grant", description, http.StatusBadRequest)
+}
+
+func InvalidScope(description string) *OAuthError {
+	return NewOAuthError("invalid_scope", description, http.StatusBadRequest)
+}
+
+var (
+	ErrOAuthInvalidClient        = NewOAuthError("invalid_client", "client authentication failed", http.StatusUnauthorized)
+	ErrOAuthUnauthorizedClient   = NewOAuthError("unauthorized_client", "the client is not allowed to use this grant type", http.StatusBadRequest)
+	ErrOAuthUnsupportedGrantType = NewOAuthError("unsupported_grant_type", "", http.StatusBadRequest)
+	ErrOAuthUnsupportedResponse  = NewOAuthError("unsupported_response_type", "only the code response type is supported", http.StatusBadRequest)
+	ErrOAuthInvalidRedirectURI   = NewOAuthError("invalid_request", "unknown client or redirect_uri", http.StatusBadRequest)
+	ErrOAuthLoginRequired        = NewOAuthError("login_required", "", http.StatusUnauthorized)
+	ErrOAuthInvalidToken         = NewOAuthError("invalid_token", "", http.StatusUnauthorized)
+	ErrOAuthPublicIntrospection  = NewOAuthError("unauthorized_client", "public clients cannot introspect tokens", http.StatusBadRequest)
+	ErrOAuthTokenNotOwned        = NewOAuthError("unauthorized_client", "the token was not issued to this client", http.StatusBadRequest)
+)
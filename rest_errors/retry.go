@@ -0,0 +1,22 @@
+package rest_errors
+
+import "time"
+
+// RetryError is an error the client may retry once RetryAfter has passed.
+// It reports the message and http code of the wrapped error.
+type RetryError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+func RetryAfter(err error, after time.Duration) error {
+	return &RetryError{Err: err, RetryAfter: after}
+}
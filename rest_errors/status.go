@@ -0,0 +1,16 @@
+package rest_errors
+
+// StatusError carries its own http code. It is for messages built per
+// request, which must not be registered in ResponseCode through NewError.
+type StatusError struct {
+	Message  string
+	HttpCode int
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+func WithStatus(message string, httpCode int) error {
+	return &StatusError{Message: message, HttpCode: httpCode}
+}
@@ -2,6 +2,13 @@ package route
 
 import (
 	"auth/common/logger"
+	"auth/common/mailer"
+	"auth/common/password"
+	"auth/common/sms"
+	"auth/common/social"
+	"auth/common/utils"
+	"auth/config"
+	"auth/consts"
 	"auth/controller"
 	"auth/db"
 	"auth/middlewares"
@@ -23,17 +30,36 @@ func Setup() *gin.Engine {
 	gin.SetMode(viper.GetString("GIN_MODE"))
 
 	r := gin.New()
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		panic(err)
+	}
 	setupCors(r)
 
 	r.GET("/ping", func(c *gin.Context) {
 		c.String(http.StatusOK, "pong")
 	})
 
+	if err := utils.InitKeyRings(); err != nil {
+		panic(err)
+	}
+	go utils.WatchKeyRings(config.Config.TokenKeysReloadEvery)
+
+	if err := password.InitPolicy(); err != nil {
+		panic(err)
+	}
+
 	api := r.Group("/api")
 	fmt.Println("lkdjfdskfweiourwqio")
 
 	db := db.InitDB()
-	conn, err := grpc.Dial(viper.GetString("ATTACHMENTURL"), grpc.WithInsecure())
+	dialOptions := []grpc.DialOption{grpc.WithInsecure()}
+	var attachmentTokenSource *service.ClientTokenSource
+	if config.Config.AttachmentClientID != "" {
+		attachmentTokenSource = service.NewClientTokenSource(config.Config.AttachmentClientID, config.Config.AttachmentClientSecret, config.Config.AttachmentClientScope)
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(attachmentTokenSource))
+	}
+
+	conn, err := grpc.Dial(viper.GetString("ATTACHMENTURL"), dialOptions...)
 	if err != nil {
 		panic(err)
 	}
@@ -44,27 +70,176 @@ func Setup() *gin.Engine {
 	repo := repository.NewUserRepository(db, logger)
 	redisConn := redis.NewRedisDb()
 	redisRepo := repository.NewRedisRepository(redisConn, logger)
-	service := service.NewUserService(gRPCCLient, repo, redisRepo)
-	userController := controller.NewUserController(service)
+	roleRepo := repository.NewRoleRepository(db, logger)
+	userMailer, err := mailer.NewMailer()
+	if err != nil {
+		panic(err)
+	}
+	emailVerifier := service.NewEmailVerifier(repo, redisRepo, userMailer)
+	magicLink := service.NewMagicLink(repo, redisRepo, userMailer)
+	smsSender, err := sms.NewSMSSender()
+	if err != nil {
+		panic(err)
+	}
+	phoneService := service.NewPhoneService(repo, redisRepo, smsSender)
+	phoneController := controller.NewPhoneController(phoneService)
+	socialProviders, err := social.NewProviders()
+	if err != nil {
+		panic(err)
+	}
+	identityRepo := repository.NewIdentityRepository(db, logger)
+	socialLogIn := service.NewSocialLogIn(repo, identityRepo, redisRepo, socialProviders)
+	socialController := controller.NewSocialController(socialLogIn)
+	mfaRepo := repository.NewMFARepository(db, logger)
+	webAuthnRepo := repository.NewWebAuthnRepository(db, logger)
+	identityService := service.NewIdentityService(repo, identityRepo, webAuthnRepo, socialLogIn)
+	identityController := controller.NewIdentityController(identityService)
+	webAuthnService := service.NewWebAuthnService(webAuthnRepo, repo, mfaRepo, redisRepo)
+	mfaService := service.NewMFAService(mfaRepo, repo, redisRepo, webAuthnService)
+	mfaController := controller.NewMFAController(mfaService)
+	webAuthnController := controller.NewWebAuthnController(webAuthnService, mfaService)
+	userService := service.NewUserService(gRPCCLient, repo, redisRepo, roleRepo, emailVerifier, mfaService, webAuthnService, magicLink, phoneService, socialLogIn)
+	roleService := service.NewRoleService(roleRepo, repo)
+	roleController := controller.NewRoleController(roleService)
+	adminService := service.NewAdminService(repo, roleRepo, redisRepo, userService)
+	adminController := controller.NewAdminController(adminService)
+	passwordResetService := service.NewPasswordResetService(repo, redisRepo, userMailer, userService)
+	passwordController := controller.NewPasswordController(passwordResetService)
+	accountUnlock := service.NewAccountUnlock(repo, redisRepo, userMailer)
+	unlockController := controller.NewUnlockController(accountUnlock)
+	userController := controller.NewUserController(userService)
+	oauthClientRepo := repository.NewOAuthClientRepository(db, logger)
+	oauthService := service.NewOAuthService(oauthClientRepo, repo, redisRepo, userService)
+	oauthController := controller.NewOAuthController(oauthService, userService)
+	if attachmentTokenSource != nil {
+		attachmentTokenSource.OAuthService = oauthService
+	}
+	wellKnownController := controller.NewWellKnownController(oauthService)
+
+	authLimit := rateLimit(redisRepo, "auth", config.Config.RateLimitAuth, middlewares.KeyByIP)
+	registerLimit := rateLimit(redisRepo, "register", config.Config.RateLimitRegister, middlewares.KeyByIP)
+	userLimit := rateLimit(redisRepo, "user", config.Config.RateLimitUser, middlewares.KeyByUser)
+	friendRequestLimit := rateLimit(redisRepo, "friend_request", config.Config.RateLimitFriendRequest, middlewares.KeyByUser)
+	oauthLimit := rateLimit(redisRepo, "oauth", config.Config.RateLimitOAuth, middlewares.KeyByClient)
+	adminLimit := rateLimit(redisRepo, "admin", config.Config.RateLimitAdmin, middlewares.KeyByUser)
 
-	auth := api.Group("/auth")
+	r.GET("/.well-known/jwks.json", wellKnownController.JWKS)
+	r.GET("/.well-known/openid-configuration", wellKnownController.OpenIDConfiguration)
+
+	// The oauth limit runs after Auth where there is a token, so it can count
+	// per verified client.
+	oauth := r.Group("/oauth")
+	oauth.GET("/authorize", oauthLimit, oauthController.Authorize)
+	oauth.POST("/authorize", oauthLimit, oauthController.Authorize)
+	oauth.POST("/token", oauthLimit, oauthController.Token)
+	oauth.POST("/introspect", oauthLimit, oauthController.Introspect)
+	oauth.POST("/revoke", oauthLimit, oauthController.Revoke)
+	oauth.GET("/userinfo", middlewares.Auth(userService), oauthLimit, oauthController.UserInfo)
+	oauth.POST("/userinfo", middlewares.Auth(userService), oauthLimit, oauthController.UserInfo)
+
+	auth := api.Group("/auth").Use(authLimit)
 
 	auth.POST("/login", userController.LogIn)
-	auth.POST("/register", userController.Register)
+	auth.POST("/register", registerLimit, userController.Register)
+	auth.POST("/refresh", userController.RefreshToken)
+	auth.POST("/verify-email", userController.VerifyEmail)
+	auth.POST("/resend-verification", userController.ResendVerificationEmail)
+	auth.POST("/forgot-password", passwordController.ForgotPassword)
+	auth.POST("/forgot-password/resend", passwordController.ResendOTP)
+	auth.POST("/reset-password", passwordController.ResetPassword)
+	auth.POST("/unlock", unlockController.SendUnlockLink)
+	auth.POST("/unlock/confirm", unlockController.Unlock)
+	auth.POST("/magic-link", userController.SendMagicLink)
+	auth.GET("/magic-link/consume", userController.ConfirmMagicLink)
+	auth.POST("/magic-link/consume", userController.MagicLinkLogIn)
+	auth.POST("/phone/otp", phoneController.SendLogInCode)
+	auth.POST("/phone/login", userController.PhoneLogIn)
+	auth.GET("/social", socialController.Providers)
+	auth.GET("/social/:provider", socialController.Begin)
+	auth.GET("/social/:provider/callback", userController.SocialLogIn)
+	auth.POST("/social/:provider/callback", userController.SocialLogIn)
+	auth.POST("/mfa/verify", userController.VerifyMFA)
+	auth.POST("/mfa/webauthn", mfaController.BeginWebAuthnChallenge)
+	auth.POST("/webauthn/login/begin", userController.BeginWebAuthnLogIn)
+	auth.POST("/webauthn/login", userController.WebAuthnLogIn)
 
-	user := api.Group("/user").Use(middlewares.Auth())
-	user.POST("/update", userController.UpdateProfile)
-	user.GET("/view/:id", userController.ViewProfile)
-	user.GET("/my-profile", userController.MyProfile)
+	user := api.Group("/user").Use(middlewares.Auth(userService), userLimit)
+	user.POST("/update", middlewares.RequireScopes(consts.ScopeUserWrite), userController.UpdateProfile)
+	user.POST("/change-password", middlewares.RequireScopes(consts.ScopeUserWrite), userController.ChangePassword)
+	user.GET("/view/:id", middlewares.RequireScopes(consts.ScopeUserRead), userController.ViewProfile)
+	user.GET("/my-profile", middlewares.RequireScopes(consts.ScopeUserRead), userController.MyProfile)
 	user.POST("/logout", userController.LogOut)
-	user.POST("/sent-request/:id", userController.RequestSent)
-	user.POST("/accept-request/:id", userController.RequestAccept)
-	user.POST("/manage-friend/:id", userController.ManageConnection)
-	user.GET("/view-friends", userController.ViewFriends)
+	user.POST("/logout-all", middlewares.RequireScopes(consts.ScopeSessions), userController.LogOutAll)
+	user.POST("/sent-request/:id", middlewares.RequireScopes(consts.ScopeFriendsWrite), friendRequestLimit, userController.RequestSent)
+	user.POST("/accept-request/:id", middlewares.RequireScopes(consts.ScopeFriendsWrite), userController.RequestAccept)
+	user.POST("/manage-friend/:id", middlewares.RequireScopes(consts.ScopeFriendsWrite), userController.ManageConnection)
+	user.GET("/view-friends", middlewares.RequireScopes(consts.ScopeFriendsRead), userController.ViewFriends)
+	user.GET("/sessions", middlewares.RequireScopes(consts.ScopeSessions), userController.ListSessions)
+	user.DELETE("/sessions/:id", middlewares.RequireScopes(consts.ScopeSessions), userController.RevokeSession)
+	user.POST("/phone", middlewares.RequireScopes(consts.ScopeUserWrite), phoneController.StartVerification)
+	user.POST("/phone/verify", middlewares.RequireScopes(consts.ScopeUserWrite), phoneController.ConfirmVerification)
+	user.GET("/identities", middlewares.RequireScopes(consts.ScopeUserRead), identityController.List)
+	user.POST("/identities", middlewares.RequireScopes(consts.ScopeUserWrite), identityController.Link)
+	user.DELETE("/identities/:id", middlewares.RequireScopes(consts.ScopeUserWrite), identityController.Unlink)
+	user.GET("/mfa", middlewares.RequireScopes(consts.ScopeUserRead), mfaController.Status)
+	user.POST("/mfa/totp", middlewares.RequireScopes(consts.ScopeUserWrite), mfaController.EnrollTOTP)
+	user.POST("/mfa/totp/confirm", middlewares.RequireScopes(consts.ScopeUserWrite), mfaController.ConfirmTOTP)
+	user.POST("/mfa/totp/disable", middlewares.RequireScopes(consts.ScopeUserWrite), mfaController.DisableTOTP)
+	user.POST("/mfa/recovery-codes", middlewares.RequireScopes(consts.ScopeUserWrite), mfaController.RegenerateRecoveryCodes)
+	user.GET("/webauthn/credentials", middlewares.RequireScopes(consts.ScopeUserRead), webAuthnController.Credentials)
+	user.POST("/webauthn/register/begin", middlewares.RequireScopes(consts.ScopeUserWrite), webAuthnController.BeginRegistration)
+	user.POST("/webauthn/register", middlewares.RequireScopes(consts.ScopeUserWrite), webAuthnController.FinishRegistration)
+	user.POST("/webauthn/assertion", middlewares.RequireScopes(consts.ScopeUserWrite), webAuthnController.BeginAssertion)
+	user.POST("/webauthn/credentials/:id/remove", middlewares.RequireScopes(consts.ScopeUserWrite), webAuthnController.RemoveCredential)
+
+	admin := api.Group("/admin").Use(middlewares.Auth(userService), adminLimit)
+	manageRoles := middlewares.RequirePermission(roleService, consts.PermissionRolesManage)
+	admin.GET("/roles", manageRoles, roleController.ListRoles)
+	admin.POST("/roles", manageRoles, roleController.CreateRole)
+	admin.POST("/roles/:name/permissions", manageRoles, roleController.AddRolePermission)
+	admin.DELETE("/roles/:name/permissions/:permission", manageRoles, roleController.RemoveRolePermission)
+	admin.GET("/permissions", manageRoles, roleController.ListPermissions)
+	admin.POST("/permissions", manageRoles, roleController.CreatePermission)
+	admin.GET("/users/:id/roles", manageRoles, roleController.UserRoles)
+	admin.POST("/users/:id/roles", manageRoles, roleController.AssignRole)
+	admin.DELETE("/users/:id/roles/:role", manageRoles, roleController.UnassignRole)
+
+	readUsers := middlewares.RequirePermission(roleService, consts.PermissionUsersRead)
+	manageUsers := middlewares.RequirePermission(roleService, consts.PermissionUsersManage)
+	admin.GET("/users", readUsers, adminController.ListUsers)
+	admin.GET("/users/:id", readUsers, adminController.ViewUser)
+	admin.POST("/users/:id/disable", manageUsers, adminController.DisableUser)
+	admin.POST("/users/:id/enable", manageUsers, adminController.EnableUser)
+	admin.POST("/users/:id/unlock", manageUsers, adminController.UnlockUser)
+	admin.POST("/users/:id/logout", manageUsers, adminController.ForceLogOut)
+	admin.POST("/users/:id/password-reset", manageUsers, adminController.ForcePasswordReset)
 
 	return r
 }
 
+// rateLimit builds the limiter of a route group from its config spec and
+// refuses to start on an invalid one.
+func rateLimit(redisRepo repository.RedisRepositoryInterface, name string, spec string, key middlewares.RateLimitKeyFunc) gin.HandlerFunc {
+	policy, err := middlewares.NewRateLimitPolicy(name, spec, key)
+	if err != nil {
+		panic(err)
+	}
+	return middlewares.RateLimit(redisRepo, policy)
+}
+
+// trustedProxies lists the proxies from TRUSTED_PROXIES. Without any,
+// X-Forwarded-For is ignored so clients cannot pick the IP they are counted
+// under.
+func trustedProxies() []string {
+	proxies := []string{}
+	for _, proxy := range strings.Split(config.Config.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 func setupCors(r *gin.Engine) {
 	allowConf := viper.GetString("CORS_ALLOW_ORIGINS")
 	if allowConf == "" {
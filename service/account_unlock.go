@@ -0,0 +1,120 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/mailer"
+	"auth/config"
+	"auth/consts"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"net/url"
+	"time"
+)
+
+// unlockMailCooldown is the time a user has to wait before another unlock
+// link is sent to the same address.
+const unlockMailCooldown = time.Minute
+
+// AccountUnlockInterface lets users lift a login lockout of their account
+// through a single-use link mailed to their address, without waiting for the
+// lock to run out or for an operator.
+type AccountUnlockInterface interface {
+	Send(email string) error
+	Unlock(token string) error
+}
+
+type AccountUnlock struct {
+	userRepo   repository.UserRepositoryInterface
+	redisRepo  repository.RedisRepositoryInterface
+	mailer     mailer.Mailer
+	loginGuard LoginGuardInterface
+}
+
+func NewAccountUnlock(userRepo repository.UserRepositoryInterface, redisRepo repository.RedisRepositoryInterface, mailer mailer.Mailer) AccountUnlockInterface {
+	return &AccountUnlock{
+		userRepo:   userRepo,
+		redisRepo:  redisRepo,
+		mailer:     mailer,
+		loginGuard: NewLoginGuard(redisRepo, userRepo),
+	}
+}
+
+// Send mails an unlock link if the account is locked, unless the address was
+// mailed a moment ago. Unknown, disabled and unlocked accounts are ignored
+// silently so the endpoint does not tell which accounts exist.
+func (u *AccountUnlock) Send(email string) error {
+	email = normalizeEmail(email)
+	first, err := u.redisRepo.SetNX(context.Background(), consts.UnlockMailKey+email, "1", unlockMailCooldown)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return rest_errors.RetryAfter(rest_errors.ErrRateLimited, unlockMailCooldown)
+	}
+
+	user, err := u.userRepo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Disabled || user.LockedUntil == nil || !user.LockedUntil.After(time.Now()) {
+		return nil
+	}
+
+	token, err := issueActionToken(u.redisRepo, purposeAccountUnlock, user.ID, email, accountUnlockExpiresIn())
+	if err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrSendingMail
+	}
+
+	link, err := url.Parse(config.Config.AccountUnlockURL)
+	if err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrSendingMail
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = u.mailer.Send(context.Background(), mailer.Message{
+		To:      user.Email,
+		Subject: "Unlock your account",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"your account was locked after too many failed logins. Open the link below to unlock it.\n\n" +
+			link.String() + "\n\n" +
+			"The link works once and expires in " + accountUnlockExpiresIn().String() + ". If the failed logins were not yours, " +
+			"consider changing your password.\n",
+	})
+	if err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrSendingMail
+	}
+
+	return nil
+}
+
+// Unlock uses up the link and lifts the lockout. The link only counts for the
+// address it was sent to.
+func (u *AccountUnlock) Unlock(token string) error {
+	userID, email, err := consumeActionToken(u.redisRepo, purposeAccountUnlock, token)
+	if err != nil {
+		return rest_errors.ErrInvalidUnlockToken
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return rest_errors.ErrInvalidUnlockToken
+	}
+	if normalizeEmail(user.Email) != email {
+		return rest_errors.ErrInvalidUnlockToken
+	}
+
+	return u.loginGuard.Unlock(user.Email, user.ID)
+}
+
+func accountUnlockExpiresIn() time.Duration {
+	if config.Config.AccountUnlockExpiresIn > 0 {
+		return config.Config.AccountUnlockExpiresIn
+	}
+	return time.Hour
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/utils"
+	"auth/consts"
+	"auth/models"
+	"auth/repository"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	purposeEmailVerification = "email_verification"
+	purposeMFAChallenge      = "mfa_challenge"
+	purposeMagicLink         = "magic_link"
+	purposeAccountUnlock     = "account_unlock"
+)
+
+var errInvalidActionToken = errors.New("invalid action token")
+
+// issueActionToken signs a short lived token that lets the user do a single
+// thing, such as confirming the address of a verification mail. value is
+// kept in redis next to the token and handed back when it is consumed.
+func issueActionToken(redisRepo repository.RedisRepositoryInterface, purpose string, userID int, value string, ttl time.Duration) (string, error) {
+	claims := models.Claims{Subject: strconv.Itoa(userID), Purpose: purpose}
+	token, err := utils.CreateActionToken(ttl, claims)
+	if err != nil {
+		return "", err
+	}
+
+	parsed, err := utils.ValidateActionToken(token, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	err = redisRepo.SetValue(context.Background(), actionTokenKey(purpose, parsed.ID), value, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeActionToken checks a token issued for purpose and invalidates it.
+// It returns the user and the value the token was issued with.
+func consumeActionToken(redisRepo repository.RedisRepositoryInterface, purpose string, token string) (int, string, error) {
+	userID, key, err := parseActionToken(purpose, token)
+	if err != nil {
+		return 0, "", err
+	}
+
+	value, err := redisRepo.GetAndDelete(context.Background(), key)
+	if err != nil {
+		logger.LogError(err)
+		return 0, "", errInvalidActionToken
+	}
+
+	return userID, value, nil
+}
+
+// readActionToken checks a token issued for purpose without using it up, for
+// tokens that allow a few attempts. It returns the redis key of the token
+// next to the user and the value.
+func readActionToken(redisRepo repository.RedisRepositoryInterface, purpose string, token string) (int, string, string, error) {
+	userID, key, err := parseActionToken(purpose, token)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	value, err := redisRepo.Get(context.Background(), key)
+	if err != nil || value == "" {
+		return 0, "", "", errInvalidActionToken
+	}
+
+	return userID, key, value, nil
+}
+
+func parseActionToken(purpose string, token string) (int, string, error) {
+	claims, err := utils.ValidateActionToken(token, purpose)
+	if err != nil {
+		return 0, "", errInvalidActionToken
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, "", errInvalidActionToken
+	}
+
+	return userID, actionTokenKey(purpose, claims.ID), nil
+}
+
+func actionTokenKey(purpose string, tokenID string) string {
+	return consts.ActionTokenKey + purpose + ":" + tokenID
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/consts"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"strconv"
+)
+
+const (
+	defaultAdminPageSize = 20
+	maxAdminPageSize     = 100
+)
+
+type AdminServiceInterface interface {
+	ListUsers(filter models.AdminUserFilter) (*models.AdminUserList, error)
+	ViewUser(userID int) (*models.AdminUser, error)
+	DisableUser(adminID int, userID int) error
+	EnableUser(userID int) error
+	UnlockUser(userID int) error
+	ForceLogOut(userID int) error
+	ForcePasswordReset(userID int) error
+}
+
+type AdminService struct {
+	userRepo    repository.UserRepositoryInterface
+	roleRepo    repository.RoleRepositoryInterface
+	redisRepo   repository.RedisRepositoryInterface
+	userService UserServiceInterface
+	loginGuard  LoginGuardInterface
+}
+
+func NewAdminService(userRepo repository.UserRepositoryInterface, roleRepo repository.RoleRepositoryInterface, redisRepo repository.RedisRepositoryInterface, userService UserServiceInterface) AdminServiceInterface {
+	return &AdminService{
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		redisRepo:   redisRepo,
+		userService: userService,
+		loginGuard:  NewLoginGuard(redisRepo, userRepo),
+	}
+}
+
+func (service *AdminService) ListUsers(filter models.AdminUserFilter) (*models.AdminUserList, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = defaultAdminPageSize
+	}
+	if filter.PageSize > maxAdminPageSize {
+		filter.PageSize = maxAdminPageSize
+	}
+
+	users, total, err := service.userRepo.ListUsers(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AdminUserList{Users: users, Total: total, Page: filter.Page, PageSize: filter.PageSize}, nil
+}
+
+func (service *AdminService) ViewUser(userID int) (*models.AdminUser, error) {
+	user, err := service.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Roles, err = service.roleRepo.UserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// DisableUser blocks every way of signing in and ends all sessions. The redis
+// marker lets token validation refuse the account without a database lookup.
+func (service *AdminService) DisableUser(adminID int, userID int) error {
+	if adminID == userID {
+		return rest_errors.ErrDisablingOwnAccount
+	}
+	if _, err := service.findUser(userID); err != nil {
+		return err
+	}
+
+	if err := service.userRepo.SetDisabled(userID, true); err != nil {
+		logger.LogError(err)
+		return err
+	}
+	if err := service.redisRepo.SetValue(context.Background(), consts.DisabledUserKey+strconv.Itoa(userID), "1", 0); err != nil {
+		return err
+	}
+
+	return service.userService.LogOutAll(userID)
+}
+
+func (service *AdminService) EnableUser(userID int) error {
+	if _, err := service.findUser(userID); err != nil {
+		return err
+	}
+
+	if err := service.userRepo.SetDisabled(userID, false); err != nil {
+		logger.LogError(err)
+		return err
+	}
+
+	return service.redisRepo.Delete(context.Background(), consts.DisabledUserKey+strconv.Itoa(userID), nil)
+}
+
+// UnlockUser lifts a lockout caused by failed logins.
+func (service *AdminService) UnlockUser(userID int) error {
+	user, err := service.findUser(userID)
+	if err != nil {
+		return err
+	}
+
+	return service.loginGuard.Unlock(user.Email, userID)
+}
+
+func (service *AdminService) ForceLogOut(userID int) error {
+	if _, err := service.findUser(userID); err != nil {
+		return err
+	}
+
+	return service.userService.LogOutAll(userID)
+}
+
+// ForcePasswordReset ends all sessions and refuses password logins until the
+// user has set a new password.
+func (service *AdminService) ForcePasswordReset(userID int) error {
+	if _, err := service.findUser(userID); err != nil {
+		return err
+	}
+
+	if err := service.userRepo.SetPasswordResetRequired(userID, true); err != nil {
+		logger.LogError(err)
+		return err
+	}
+
+	return service.userService.LogOutAll(userID)
+}
+
+func (service *AdminService) findUser(userID int) (*models.AdminUser, error) {
+	user, err := service.userRepo.FindAdminUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, rest_errors.ErrUserNotFound
+	}
+	return user, nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/mailer"
+	"auth/config"
+	"auth/consts"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// verificationMailCooldown is the time a user has to wait before another
+// verification mail is sent to the same address.
+const verificationMailCooldown = time.Minute
+
+// EmailVerifierInterface confirms that users own the address they registered
+// with by mailing them a single-use link.
+type EmailVerifierInterface interface {
+	Send(user *models.User) error
+	Resend(email string) error
+	Verify(token string) error
+}
+
+type EmailVerifier struct {
+	userRepo  repository.UserRepositoryInterface
+	redisRepo repository.RedisRepositoryInterface
+	mailer    mailer.Mailer
+}
+
+func NewEmailVerifier(userRepo repository.UserRepositoryInterface, redisRepo repository.RedisRepositoryInterface, mailer mailer.Mailer) EmailVerifierInterface {
+	return &EmailVerifier{userRepo: userRepo, redisRepo: redisRepo, mailer: mailer}
+}
+
+// Send mails a verification link for the current address of the user.
+func (v *EmailVerifier) Send(user *models.User) error {
+	email := normalizeEmail(user.Email)
+	token, err := issueActionToken(v.redisRepo, purposeEmailVerification, user.ID, email, emailVerificationExpiresIn())
+	if err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrSendingMail
+	}
+
+	link, err := url.Parse(config.Config.EmailVerificationURL)
+	if err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrSendingMail
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = v.mailer.Send(context.Background(), mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"please confirm your email address by opening the link below.\n\n" +
+			link.String() + "\n\n" +
+			"The link expires in " + emailVerificationExpiresIn().String() + ". If you did not sign up you can ignore this mail.\n",
+	})
+	if err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrSendingMail
+	}
+
+	return nil
+}
+
+// Resend sends a new link unless the address was mailed a moment ago. Unknown
+// and already verified addresses are ignored silently so the endpoint does
+// not tell which accounts exist.
+func (v *EmailVerifier) Resend(email string) error {
+	email = normalizeEmail(email)
+	first, err := v.redisRepo.SetNX(context.Background(), consts.VerificationMailKey+email, "1", verificationMailCooldown)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return rest_errors.RetryAfter(rest_errors.ErrRateLimited, verificationMailCooldown)
+	}
+
+	user, err := v.userRepo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.EmailVerified || user.Disabled {
+		return nil
+	}
+
+	return v.Send(user)
+}
+
+// Verify marks the address as verified. The token only counts for the
+// address it was sent to.
+func (v *EmailVerifier) Verify(token string) error {
+	userID, email, err := consumeActionToken(v.redisRepo, purposeEmailVerification, token)
+	if err != nil {
+		return rest_errors.ErrInvalidVerificationToken
+	}
+
+	user, err := v.userRepo.FindByID(userID)
+	if err != nil {
+		return rest_errors.ErrInvalidVerificationToken
+	}
+	if normalizeEmail(user.Email) != email {
+		return rest_errors.ErrInvalidVerificationToken
+	}
+
+	return v.userRepo.SetEmailVerified(user.ID, true)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func emailVerificationExpiresIn() time.Duration {
+	if config.Config.EmailVerificationExpiresIn > 0 {
+		return config.Config.EmailVerificationExpiresIn
+	}
+	return 24 * time.Hour
+}
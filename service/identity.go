@@ -0,0 +1,124 @@
+package service
+
+import (
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+)
+
+// IdentityServiceInterface lets users see how they can log in and link or
+// unlink the identities of external providers.
+type IdentityServiceInterface interface {
+	LoginMethods(userID int) (*models.LoginMethods, error)
+	BeginLink(userID int, provider string) (string, error)
+	Link(request models.IdentityLinkRequest) (*models.Identity, bool, error)
+	Unlink(userID int, id int) error
+}
+
+type IdentityService struct {
+	userRepo     repository.UserRepositoryInterface
+	identityRepo repository.IdentityRepositoryInterface
+	webAuthnRepo repository.WebAuthnRepositoryInterface
+	social       SocialLogInInterface
+}
+
+func NewIdentityService(userRepo repository.UserRepositoryInterface, identityRepo repository.IdentityRepositoryInterface, webAuthnRepo repository.WebAuthnRepositoryInterface, social SocialLogInInterface) IdentityServiceInterface {
+	return &IdentityService{userRepo: userRepo, identityRepo: identityRepo, webAuthnRepo: webAuthnRepo, social: social}
+}
+
+// LoginMethods returns the password, verified phone, passkeys and provider
+// identities of the user. Magic links and password resets are not listed:
+// they only recover an account through its email.
+func (service *IdentityService) LoginMethods(userID int) (*models.LoginMethods, error) {
+	user, err := service.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := service.webAuthnRepo.CountByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := service.identityRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	methods := &models.LoginMethods{
+		Password:   user.Password != "",
+		Passkeys:   passkeys,
+		Identities: identities,
+	}
+	if user.PhoneVerified {
+		methods.Phone = user.Phone
+	}
+
+	return methods, nil
+}
+
+// BeginLink returns the authorization url of the provider for linking.
+func (service *IdentityService) BeginLink(userID int, provider string) (string, error) {
+	if provider == "" {
+		return "", rest_errors.ErrInvalidLoginProvider
+	}
+
+	return service.social.LinkURL(userID, provider)
+}
+
+// Link adds the identity the user logged in to at the provider. Linking an
+// identity twice is not an error, the second return value tells whether the
+// identity is new.
+func (service *IdentityService) Link(request models.IdentityLinkRequest) (*models.Identity, bool, error) {
+	identity, err := service.social.Identify(request.UserID, request)
+	if err != nil {
+		return nil, false, err
+	}
+
+	existing, err := service.identityRepo.FindByProviderSubject(identity.Provider, identity.Subject)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		if existing.UserID != request.UserID {
+			return nil, false, rest_errors.ErrIdentityLinkedElsewhere
+		}
+		return existing, false, nil
+	}
+
+	record := &models.Identity{
+		UserID:   request.UserID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    normalizeEmail(identity.Email),
+	}
+	if _, err := service.identityRepo.Create(record); err != nil {
+		// The identity may have been linked at the same moment.
+		existing, findErr := service.identityRepo.FindByProviderSubject(identity.Provider, identity.Subject)
+		if findErr != nil || existing == nil {
+			return nil, false, err
+		}
+		if existing.UserID != request.UserID {
+			return nil, false, rest_errors.ErrIdentityLinkedElsewhere
+		}
+		return existing, false, nil
+	}
+
+	return record, true, nil
+}
+
+// Unlink removes an identity unless it is the last way the user can log in.
+func (service *IdentityService) Unlink(userID int, id int) error {
+	deleted, err := service.identityRepo.Delete(userID, id)
+	if err == repository.ErrLastLoginMethod {
+		return rest_errors.ErrLastLoginMethod
+	}
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return rest_errors.ErrIdentityNotFound
+	}
+
+	return nil
+}
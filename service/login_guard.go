@@ -0,0 +1,195 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/config"
+	"auth/consts"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// loginFreeAttempts failures per account are allowed before backoff starts.
+	loginFreeAttempts = 3
+	loginBackoffBase  = time.Second
+	loginBackoffMax   = 5 * time.Minute
+)
+
+// LoginGuardInterface contains credential guessing. Failed attempts are
+// counted per account and per IP in redis; both back off exponentially and
+// an account is locked for a while once it failed too often.
+type LoginGuardInterface interface {
+	Check(account string, ip string) error
+	Failure(account string, ip string, userID int) error
+	Success(account string)
+	Unlock(account string, userID int) error
+}
+
+type LoginGuard struct {
+	redisRepo repository.RedisRepositoryInterface
+	userRepo  repository.UserRepositoryInterface
+}
+
+func NewLoginGuard(redisRepo repository.RedisRepositoryInterface, userRepo repository.UserRepositoryInterface) LoginGuardInterface {
+	return &LoginGuard{redisRepo: redisRepo, userRepo: userRepo}
+}
+
+// Check refuses an attempt while the account is locked (423) or the account
+// or the IP has to wait (429).
+func (g *LoginGuard) Check(account string, ip string) error {
+	if wait := g.remaining(consts.LoginLockKey + accountKey(account)); wait > 0 {
+		return rest_errors.RetryAfter(rest_errors.ErrAccountLocked, wait)
+	}
+
+	for _, key := range []string{accountKey(account), ipKey(ip)} {
+		if wait := g.remaining(consts.LoginBackoffKey + key); wait > 0 {
+			return rest_errors.RetryAfter(rest_errors.ErrTooManyLoginAttempts, wait)
+		}
+	}
+
+	return nil
+}
+
+// Failure records a failed attempt. Unknown accounts are counted as well so
+// they cannot be told apart from existing ones; userID is 0 for them. The
+// returned error is set when the attempt locked the account.
+func (g *LoginGuard) Failure(account string, ip string, userID int) error {
+	accountFailures := g.count(consts.LoginFailuresKey + accountKey(account))
+	ipFailures := g.count(consts.LoginFailuresKey + ipKey(ip))
+
+	if accountFailures >= int64(loginMaxAttempts()) {
+		lockout := loginLockoutDuration()
+		g.set(consts.LoginLockKey+accountKey(account), lockout)
+		g.redisRepo.Delete(context.Background(), consts.LoginFailuresKey+accountKey(account), nil)
+
+		if userID != 0 {
+			lockedUntil := time.Now().Add(lockout)
+			if err := g.userRepo.SetLockedUntil(userID, &lockedUntil); err != nil {
+				logger.LogError(err)
+			}
+		}
+
+		logger.LogInfo("account locked after too many failed logins: ", account)
+		return rest_errors.RetryAfter(rest_errors.ErrAccountLocked, lockout)
+	}
+
+	if accountFailures > loginFreeAttempts {
+		g.set(consts.LoginBackoffKey+accountKey(account), backoff(accountFailures-loginFreeAttempts))
+	}
+	if ipMax := int64(loginIPMaxAttempts()); ipFailures >= ipMax {
+		g.set(consts.LoginBackoffKey+ipKey(ip), backoff(ipFailures-ipMax+1))
+	}
+
+	return nil
+}
+
+// Success forgets the failures of the account. Failures of the IP are kept,
+// a single valid account must not reset a credential-stuffing IP.
+func (g *LoginGuard) Success(account string) {
+	err := g.redisRepo.Delete(context.Background(), consts.LoginFailuresKey+accountKey(account), nil)
+	if err == nil {
+		err = g.redisRepo.Delete(context.Background(), consts.LoginBackoffKey+accountKey(account), nil)
+	}
+	if err != nil {
+		logger.LogError(err)
+	}
+}
+
+// Unlock lifts a lockout and forgets the failures of the account.
+func (g *LoginGuard) Unlock(account string, userID int) error {
+	for _, prefix := range []string{consts.LoginLockKey, consts.LoginFailuresKey, consts.LoginBackoffKey} {
+		if err := g.redisRepo.Delete(context.Background(), prefix+accountKey(account), nil); err != nil {
+			return err
+		}
+	}
+
+	return g.userRepo.SetLockedUntil(userID, nil)
+}
+
+func (g *LoginGuard) count(key string) int64 {
+	count, err := g.redisRepo.Incr(context.Background(), key)
+	if err != nil {
+		logger.LogError(err)
+		return 0
+	}
+	if count == 1 {
+		if err := g.redisRepo.SetExpire(context.Background(), key, loginFailureWindow()); err != nil {
+			logger.LogError(err)
+		}
+	}
+	return count
+}
+
+// set stores the time a wait ends, so its remaining part can be reported.
+func (g *LoginGuard) set(key string, wait time.Duration) {
+	until := strconv.FormatInt(time.Now().Add(wait).UnixNano(), 10)
+	if err := g.redisRepo.SetValue(context.Background(), key, until, wait); err != nil {
+		logger.LogError(err)
+	}
+}
+
+func (g *LoginGuard) remaining(key string) time.Duration {
+	data, err := g.redisRepo.Get(context.Background(), key)
+	if err != nil || data == "" {
+		return 0
+	}
+
+	until, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Until(time.Unix(0, until))
+}
+
+// backoff doubles the wait with every step, starting at one second.
+func backoff(step int64) time.Duration {
+	if step > 20 {
+		return loginBackoffMax
+	}
+
+	wait := loginBackoffBase << uint(step-1)
+	if wait > loginBackoffMax {
+		return loginBackoffMax
+	}
+	return wait
+}
+
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func loginMaxAttempts() int {
+	if config.Config.LoginMaxAttempts > 0 {
+		return config.Config.LoginMaxAttempts
+	}
+	return 10
+}
+
+func loginIPMaxAttempts() int {
+	if config.Config.LoginIPMaxAttempts > 0 {
+		return config.Config.LoginIPMaxAttempts
+	}
+	return 50
+}
+
+func loginLockoutDuration() time.Duration {
+	if config.Config.LoginLockoutDuration > 0 {
+		return config.Config.LoginLockoutDuration
+	}
+	return 15 * time.Minute
+}
+
+func loginFailureWindow() time.Duration {
+	if config.Config.LoginFailureWindow > 0 {
+		return config.Config.LoginFailureWindow
+	}
+	return time.Hour
+}
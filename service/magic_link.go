@@ -0,0 +1,113 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/mailer"
+	"auth/config"
+	"auth/consts"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"net/url"
+	"time"
+)
+
+// magicLinkMailCooldown is the time a user has to wait before another login
+// link is sent to the same address.
+const magicLinkMailCooldown = time.Minute
+
+// MagicLinkInterface signs users in through a single-use link mailed to their
+// address.
+type MagicLinkInterface interface {
+	Send(email string) error
+	Consume(token string) (*models.User, error)
+}
+
+type MagicLink struct {
+	userRepo  repository.UserRepositoryInterface
+	redisRepo repository.RedisRepositoryInterface
+	mailer    mailer.Mailer
+}
+
+func NewMagicLink(userRepo repository.UserRepositoryInterface, redisRepo repository.RedisRepositoryInterface, mailer mailer.Mailer) MagicLinkInterface {
+	return &MagicLink{userRepo: userRepo, redisRepo: redisRepo, mailer: mailer}
+}
+
+// Send mails a login link unless the address was mailed a moment ago.
+// Unknown and disabled accounts are ignored silently so the endpoint does not
+// tell which accounts exist.
+func (m *MagicLink) Send(email string) error {
+	email = normalizeEmail(email)
+	first, err := m.redisRepo.SetNX(context.Background(), consts.MagicLinkMailKey+email, "1", magicLinkMailCooldown)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return rest_errors.RetryAfter(rest_errors.ErrRateLimited, magicLinkMailCooldown)
+	}
+
+	user, err := m.userRepo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Disabled {
+		return nil
+	}
+
+	token, err := issueActionToken(m.redisRepo, purposeMagicLink, user.ID, email, magicLinkExpiresIn())
+	if err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrSendingMail
+	}
+
+	link, err := url.Parse(config.Config.MagicLinkURL)
+	if err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrSendingMail
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = m.mailer.Send(context.Background(), mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"open the link below to log in.\n\n" +
+			link.String() + "\n\n" +
+			"The link works once and expires in " + magicLinkExpiresIn().String() + ". If you did not ask for it you can ignore this mail.\n",
+	})
+	if err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrSendingMail
+	}
+
+	return nil
+}
+
+// Consume uses up the link and returns its user. The link only counts for
+// the address it was sent to.
+func (m *MagicLink) Consume(token string) (*models.User, error) {
+	userID, email, err := consumeActionToken(m.redisRepo, purposeMagicLink, token)
+	if err != nil {
+		return nil, rest_errors.ErrInvalidMagicLink
+	}
+
+	user, err := m.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, rest_errors.ErrInvalidMagicLink
+	}
+	if normalizeEmail(user.Email) != email {
+		return nil, rest_errors.ErrInvalidMagicLink
+	}
+
+	return user, nil
+}
+
+func magicLinkExpiresIn() time.Duration {
+	if config.Config.MagicLinkExpiresIn > 0 {
+		return config.Config.MagicLinkExpiresIn
+	}
+	return 15 * time.Minute
+}
@@ -0,0 +1,462 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/totp"
+	"auth/common/utils"
+	"auth/config"
+	"auth/consts"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount = 10
+	// totpEnrollmentExpiresIn is the time a new secret waits for its first code.
+	totpEnrollmentExpiresIn = 10 * time.Minute
+	// mfaMaxAttempts wrong codes use up an MFA challenge.
+	mfaMaxAttempts = 5
+)
+
+// MFAServiceInterface manages the second factor of users and the challenge a
+// login has to pass when one is enabled.
+type MFAServiceInterface interface {
+	Enabled(userID int) (bool, error)
+	Status(userID int) (*models.MFAStatus, error)
+	EnrollTOTP(userID int) (*models.TOTPEnrollment, error)
+	ConfirmTOTP(userID int, code string) (*models.RecoveryCodes, error)
+	DisableTOTP(request models.MFAReauthRequest) error
+	RemoveWebAuthnCredential(request models.MFAReauthRequest, id int) error
+	RegenerateRecoveryCodes(request models.MFAReauthRequest) (*models.RecoveryCodes, error)
+	Challenge(user *models.User, signInInfo models.SignInData) (*models.JWTTokenResponse, error)
+	BeginWebAuthnChallenge(request models.WebAuthnChallengeRequest) (*models.WebAuthnRequestOptions, error)
+	VerifyChallenge(request models.MFAVerifyRequest) (*models.User, models.SignInData, error)
+}
+
+type MFAService struct {
+	mfaRepo    repository.MFARepositoryInterface
+	userRepo   repository.UserRepositoryInterface
+	redisRepo  repository.RedisRepositoryInterface
+	webAuthn   WebAuthnServiceInterface
+	loginGuard LoginGuardInterface
+}
+
+// mfaChallenge is the pending login kept next to an MFA token.
+type mfaChallenge struct {
+	DeviceName string `json:"device_name"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	ClientID   string `json:"client_id,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+}
+
+func NewMFAService(mfaRepo repository.MFARepositoryInterface, userRepo repository.UserRepositoryInterface, redisRepo repository.RedisRepositoryInterface, webAuthn WebAuthnServiceInterface) MFAServiceInterface {
+	return &MFAService{
+		mfaRepo:    mfaRepo,
+		userRepo:   userRepo,
+		redisRepo:  redisRepo,
+		webAuthn:   webAuthn,
+		loginGuard: NewLoginGuard(redisRepo, userRepo),
+	}
+}
+
+// Enabled reports whether the user has a second factor, TOTP or a passkey.
+func (service *MFAService) Enabled(userID int) (bool, error) {
+	methods, err := service.methods(userID)
+	return len(methods) > 0, err
+}
+
+func (service *MFAService) Status(userID int) (*models.MFAStatus, error) {
+	secret, err := service.mfaRepo.FindTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := service.webAuthn.Credentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.MFAStatus{WebAuthnCredentials: len(credentials)}
+	if secret != nil {
+		status.TOTPEnabled = true
+		status.TOTPEnabledAt = &secret.EnabledAt
+	}
+	if secret != nil || len(credentials) > 0 {
+		status.RecoveryCodesLeft, err = service.mfaRepo.CountRecoveryCodes(userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+// EnrollTOTP creates a secret for an authenticator app. It only takes effect
+// once ConfirmTOTP saw a code generated from it.
+func (service *MFAService) EnrollTOTP(userID int) (*models.TOTPEnrollment, error) {
+	if secret, err := service.mfaRepo.FindTOTP(userID); err != nil {
+		return nil, err
+	} else if secret != nil {
+		return nil, rest_errors.ErrMFAAlreadyEnabled
+	}
+
+	user, err := service.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.redisRepo.SetValue(context.Background(), consts.TOTPEnrollmentKey+strconv.Itoa(userID), secret, totpEnrollmentExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TOTPEnrollment{
+		Secret:    secret,
+		URI:       totp.URI(mfaIssuer(), user.Email, secret),
+		ExpiresIn: int64(totpEnrollmentExpiresIn.Seconds()),
+	}, nil
+}
+
+// ConfirmTOTP enables the pending secret if the code matches and returns the
+// recovery codes, which are never shown again.
+func (service *MFAService) ConfirmTOTP(userID int, code string) (*models.RecoveryCodes, error) {
+	enrollmentKey := consts.TOTPEnrollmentKey + strconv.Itoa(userID)
+	secret, err := service.redisRepo.Get(context.Background(), enrollmentKey)
+	if err != nil || secret == "" {
+		return nil, rest_errors.ErrMFAEnrollmentNotFound
+	}
+
+	if !service.validTOTP(userID, secret, code) {
+		return nil, rest_errors.ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := service.mfaRepo.EnableTOTP(userID, secret, hashes); err != nil {
+		return nil, err
+	}
+	if err := service.redisRepo.Delete(context.Background(), enrollmentKey, nil); err != nil {
+		logger.LogError(err)
+	}
+
+	return &models.RecoveryCodes{Codes: codes}, nil
+}
+
+// DisableTOTP removes the authenticator app. Recovery codes stay while the
+// user still has a passkey.
+func (service *MFAService) DisableTOTP(request models.MFAReauthRequest) error {
+	if _, err := service.reauthenticate(request); err != nil {
+		return err
+	}
+
+	secret, err := service.mfaRepo.FindTOTP(request.UserID)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return rest_errors.ErrMFANotEnabled
+	}
+
+	hasPasskeys, err := service.webAuthn.HasCredentials(request.UserID)
+	if err != nil {
+		return err
+	}
+	return service.mfaRepo.DisableTOTP(request.UserID, hasPasskeys)
+}
+
+// RemoveWebAuthnCredential deletes a passkey. Removing the last second factor
+// also removes the recovery codes.
+func (service *MFAService) RemoveWebAuthnCredential(request models.MFAReauthRequest, id int) error {
+	if _, err := service.reauthenticate(request); err != nil {
+		return err
+	}
+
+	if err := service.webAuthn.RemoveCredential(request.UserID, id); err != nil {
+		return err
+	}
+
+	if enabled, err := service.Enabled(request.UserID); err != nil || enabled {
+		return err
+	}
+	return service.mfaRepo.ReplaceRecoveryCodes(request.UserID, nil)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, used or not.
+func (service *MFAService) RegenerateRecoveryCodes(request models.MFAReauthRequest) (*models.RecoveryCodes, error) {
+	if _, err := service.reauthenticate(request); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := service.mfaRepo.ReplaceRecoveryCodes(request.UserID, hashes); err != nil {
+		return nil, err
+	}
+
+	return &models.RecoveryCodes{Codes: codes}, nil
+}
+
+// Challenge parks a login whose first factor passed and returns the MFA
+// token to finish it with.
+func (service *MFAService) Challenge(user *models.User, signInInfo models.SignInData) (*models.JWTTokenResponse, error) {
+	data, _ := json.Marshal(mfaChallenge{
+		DeviceName: signInInfo.DeviceName,
+		UserAgent:  signInInfo.UserAgent,
+		IP:         signInInfo.IP,
+		ClientID:   signInInfo.ClientID,
+		Scope:      signInInfo.Scope,
+	})
+
+	methods, err := service.methods(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := issueActionToken(service.redisRepo, purposeMFAChallenge, user.ID, string(data), mfaChallengeExpiresIn())
+	if err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+
+	return &models.JWTTokenResponse{
+		Email:       user.Email,
+		MFARequired: true,
+		MFAToken:    token,
+		MFAMethods:  append(methods, models.MFAMethodRecoveryCode),
+		ExpiredAt:   time.Now().Add(mfaChallengeExpiresIn()).Unix(),
+	}, nil
+}
+
+// BeginWebAuthnChallenge returns the options for answering the MFA challenge
+// with a passkey.
+func (service *MFAService) BeginWebAuthnChallenge(request models.WebAuthnChallengeRequest) (*models.WebAuthnRequestOptions, error) {
+	userID, _, _, err := readActionToken(service.redisRepo, purposeMFAChallenge, request.MFAToken)
+	if err != nil {
+		return nil, rest_errors.ErrInvalidMFAToken
+	}
+
+	return service.webAuthn.BeginAssertion(userID, request.IP)
+}
+
+// VerifyChallenge checks the second factor of a parked login and returns the
+// user and the sign-in data to open the session with. Wrong codes count as
+// failed logins of the account.
+func (service *MFAService) VerifyChallenge(request models.MFAVerifyRequest) (*models.User, models.SignInData, error) {
+	userID, key, data, err := readActionToken(service.redisRepo, purposeMFAChallenge, request.MFAToken)
+	if err != nil {
+		return nil, models.SignInData{}, rest_errors.ErrInvalidMFAToken
+	}
+
+	challenge := mfaChallenge{}
+	if err := json.Unmarshal([]byte(data), &challenge); err != nil {
+		logger.LogError(err)
+		return nil, models.SignInData{}, rest_errors.ErrInvalidMFAToken
+	}
+
+	user, err := service.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, models.SignInData{}, err
+	}
+
+	if err := service.loginGuard.Check(user.Email, request.IP); err != nil {
+		return nil, models.SignInData{}, err
+	}
+
+	attempts, err := service.redisRepo.Incr(context.Background(), consts.MFAAttemptsKey+key)
+	if err != nil {
+		return nil, models.SignInData{}, err
+	}
+	if attempts == 1 {
+		service.redisRepo.SetExpire(context.Background(), consts.MFAAttemptsKey+key, mfaChallengeExpiresIn())
+	}
+	if attempts > mfaMaxAttempts {
+		service.redisRepo.Delete(context.Background(), key, nil)
+		return nil, models.SignInData{}, rest_errors.ErrInvalidMFAToken
+	}
+
+	if err := service.verifySecondFactor(user.ID, request.Code, request.WebAuthn, request.RecoveryCode); err != nil {
+		if err := service.loginGuard.Failure(user.Email, request.IP, user.ID); err != nil {
+			return nil, models.SignInData{}, err
+		}
+		return nil, models.SignInData{}, err
+	}
+
+	// The challenge is used up with the first correct code.
+	if data, err := service.redisRepo.GetAndDelete(context.Background(), key); err != nil || data == "" {
+		return nil, models.SignInData{}, rest_errors.ErrInvalidMFAToken
+	}
+	service.loginGuard.Success(user.Email)
+
+	return user, models.SignInData{
+		Email:      user.Email,
+		DeviceName: challenge.DeviceName,
+		UserAgent:  challenge.UserAgent,
+		IP:         challenge.IP,
+		ClientID:   challenge.ClientID,
+		Scope:      challenge.Scope,
+	}, nil
+}
+
+// reauthenticate checks the password and the second factor before the
+// second factor itself is changed. Users who signed up without a password,
+// e.g. through a social login, prove themselves with the second factor alone.
+func (service *MFAService) reauthenticate(request models.MFAReauthRequest) (*models.User, error) {
+	user, err := service.userRepo.FindByID(request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.loginGuard.Check(user.Email, request.IP); err != nil {
+		return nil, err
+	}
+	if user.Password != "" {
+		if err := utils.ComparePassword(user.Password, request.Password); err != nil {
+			if err := service.loginGuard.Failure(user.Email, request.IP, user.ID); err != nil {
+				return nil, err
+			}
+			return nil, rest_errors.ErrIncorrectPassword
+		}
+	}
+
+	if err := service.verifySecondFactor(user.ID, request.Code, request.WebAuthn, request.RecoveryCode); err != nil {
+		if err := service.loginGuard.Failure(user.Email, request.IP, user.ID); err != nil {
+			return nil, err
+		}
+		return nil, err
+	}
+	service.loginGuard.Success(user.Email)
+
+	return user, nil
+}
+
+// verifySecondFactor accepts a TOTP code, a passkey assertion or, failing
+// those, an unused recovery code, which is used up.
+func (service *MFAService) verifySecondFactor(userID int, code string, assertion *models.WebAuthnAssertion, recoveryCode string) error {
+	secret, err := service.mfaRepo.FindTOTP(userID)
+	if err != nil {
+		return err
+	}
+	hasPasskeys, err := service.webAuthn.HasCredentials(userID)
+	if err != nil {
+		return err
+	}
+	if secret == nil && !hasPasskeys {
+		return rest_errors.ErrMFANotEnabled
+	}
+
+	if secret != nil && code != "" && service.validTOTP(userID, secret.Secret, code) {
+		return nil
+	}
+
+	if hasPasskeys && assertion != nil {
+		err := service.webAuthn.VerifyAssertion(userID, assertion)
+		if err == nil {
+			return nil
+		}
+		if err != rest_errors.ErrInvalidWebAuthnCredential && err != rest_errors.ErrWebAuthnChallengeNotFound {
+			return err
+		}
+	}
+
+	if recoveryCode != "" {
+		used, err := service.mfaRepo.UseRecoveryCode(userID, hashOTP(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return err
+		}
+		if used {
+			return nil
+		}
+	}
+
+	return rest_errors.ErrInvalidMFACode
+}
+
+// methods lists the second factors the user set up.
+func (service *MFAService) methods(userID int) ([]string, error) {
+	methods := []string{}
+
+	secret, err := service.mfaRepo.FindTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if secret != nil {
+		methods = append(methods, models.MFAMethodTOTP)
+	}
+
+	hasPasskeys, err := service.webAuthn.HasCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+	if hasPasskeys {
+		methods = append(methods, models.MFAMethodWebAuthn)
+	}
+
+	return methods, nil
+}
+
+// validTOTP checks the code and refuses a step that was already accepted, so
+// an observed code cannot be replayed.
+func (service *MFAService) validTOTP(userID int, secret string, code string) bool {
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false
+	}
+
+	key := consts.TOTPUsedStepKey + strconv.Itoa(userID) + ":" + strconv.FormatInt(step, 10)
+	first, err := service.redisRepo.SetNX(context.Background(), key, "1", 3*totp.Period)
+	if err != nil {
+		logger.LogError(err)
+		return false
+	}
+	return first
+}
+
+// generateRecoveryCodes returns new codes and the hashes to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		random, err := utils.GenerateRandomString(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := random[:5] + "-" + random[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashOTP(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func mfaIssuer() string {
+	if config.Config.MFAIssuer != "" {
+		return config.Config.MFAIssuer
+	}
+	return "auth"
+}
+
+func mfaChallengeExpiresIn() time.Duration {
+	if config.Config.MFAChallengeExpiresIn > 0 {
+		return config.Config.MFAChallengeExpiresIn
+	}
+	return 5 * time.Minute
+}
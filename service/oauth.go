@@ -0,0 +1,592 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/utils"
+	"auth/config"
+	"auth/consts"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type OAuthServiceInterface interface {
+	RegisterClient(client models.OAuthClient, public bool) (*models.OAuthClient, string, error)
+	FindAuthorizeClient(request *models.AuthorizeRequest) (*models.OAuthClient, error)
+	Authorize(userID int, sessionScope string, client *models.OAuthClient, request models.AuthorizeRequest) (string, error)
+	Token(request models.TokenRequest) (*models.TokenResponse, error)
+	Introspect(request models.IntrospectionRequest) (*models.IntrospectionResponse, error)
+	Revoke(request models.RevocationRequest) error
+	UserInfo(userID int) (*models.UserInfo, error)
+	Discovery() models.OpenIDConfiguration
+}
+
+var supportedGrantTypes = []string{consts.GrantTypeAuthorizationCode, consts.GrantTypeRefreshToken, consts.GrantTypeClientCredentials}
+
+type OAuthService struct {
+	clientRepo  repository.OAuthClientRepositoryInterface
+	userRepo    repository.UserRepositoryInterface
+	redisRepo   repository.RedisRepositoryInterface
+	userService UserServiceInterface
+}
+
+func NewOAuthService(clientRepo repository.OAuthClientRepositoryInterface, userRepo repository.UserRepositoryInterface, redisRepo repository.RedisRepositoryInterface, userService UserServiceInterface) OAuthServiceInterface {
+	return &OAuthService{clientRepo: clientRepo, userRepo: userRepo, redisRepo: redisRepo, userService: userService}
+}
+
+// RegisterClient stores a new client and returns it together with its plain
+// text secret. The secret is only known at this point, the database keeps a
+// hash. Public clients get no secret.
+func (service *OAuthService) RegisterClient(client models.OAuthClient, public bool) (*models.OAuthClient, string, error) {
+	clientID, err := utils.GenerateRandomString(12)
+	if err != nil {
+		return nil, "", err
+	}
+	client.ClientID = clientID
+
+	secret := ""
+	client.ClientSecret = ""
+	if !public {
+		secret, err = utils.GenerateRandomString(32)
+		if err != nil {
+			return nil, "", err
+		}
+		client.ClientSecret = utils.HashClientSecret(secret)
+	}
+
+	id, err := service.clientRepo.Create(client)
+	if err != nil {
+		return nil, "", err
+	}
+	client.ID = id
+
+	return &client, secret, nil
+}
+
+// FindAuthorizeClient resolves the client and redirect uri of an authorization
+// request. Errors returned here must not be sent to the redirect uri.
+func (service *OAuthService) FindAuthorizeClient(request *models.AuthorizeRequest) (*models.OAuthClient, error) {
+	client, err := service.clientRepo.FindByClientID(request.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, rest_errors.ErrOAuthInvalidRedirectURI
+	}
+
+	if request.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		request.RedirectURI = client.RedirectURIs[0]
+		request.DefaultRedirectURI = true
+	}
+	if !contains(client.RedirectURIs, request.RedirectURI) {
+		return nil, rest_errors.ErrOAuthInvalidRedirectURI
+	}
+
+	return client, nil
+}
+
+// Authorize issues a single use authorization code for the logged-in user.
+func (service *OAuthService) Authorize(userID int, sessionScope string, client *models.OAuthClient, request models.AuthorizeRequest) (string, error) {
+	if request.ResponseType != "code" {
+		return "", rest_errors.ErrOAuthUnsupportedResponse
+	}
+	if !contains(client.GrantTypes, consts.GrantTypeAuthorizationCode) {
+		return "", rest_errors.ErrOAuthUnauthorizedClient
+	}
+	if request.CodeChallenge == "" {
+		return "", rest_errors.InvalidRequest("code_challenge is required")
+	}
+	if request.CodeChallengeMethod != "S256" {
+		return "", rest_errors.InvalidRequest("code_challenge_method must be S256")
+	}
+
+	scope, err := grantedScope(client, request.Scope)
+	if err != nil {
+		return "", err
+	}
+	scope, err = capScope(scope, sessionScope)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(models.AuthorizationCode{
+		ClientID:            client.ClientID,
+		RedirectURI:         request.RedirectURI,
+		DefaultRedirectURI:  request.DefaultRedirectURI,
+		UserID:              userID,
+		Scope:               scope,
+		Nonce:               request.Nonce,
+		CodeChallenge:       request.CodeChallenge,
+		CodeChallengeMethod: request.CodeChallengeMethod,
+		AuthTime:            time.Now().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = service.redisRepo.SetValue(context.Background(), consts.AuthorizationCodeKey+code, string(data), authorizationCodeTTL())
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+func (service *OAuthService) Token(request models.TokenRequest) (*models.TokenResponse, error) {
+	client, err := service.authenticateClient(request.ClientID, request.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !contains(client.GrantTypes, request.GrantType) {
+		if !contains(supportedGrantTypes, request.GrantType) {
+			return nil, rest_errors.ErrOAuthUnsupportedGrantType
+		}
+		return nil, rest_errors.ErrOAuthUnauthorizedClient
+	}
+
+	switch request.GrantType {
+	case consts.GrantTypeAuthorizationCode:
+		return service.exchangeAuthorizationCode(client, request)
+	case consts.GrantTypeRefreshToken:
+		return service.exchangeRefreshToken(client, request)
+	case consts.GrantTypeClientCredentials:
+		return service.clientCredentials(client, request)
+	}
+
+	return nil, rest_errors.ErrOAuthUnsupportedGrantType
+}
+
+// Introspect reports whether a token is currently usable. Only confidential
+// clients may introspect; anything that is not an active token simply comes
+// back as inactive.
+func (service *OAuthService) Introspect(request models.IntrospectionRequest) (*models.IntrospectionResponse, error) {
+	client, err := service.authenticateClient(request.ClientID, request.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsPublic() {
+		return nil, rest_errors.ErrOAuthPublicIntrospection
+	}
+
+	if request.TokenTypeHint != consts.TokenTypeHintRefreshToken {
+		if resp := service.introspectAccessToken(request.Token); resp != nil {
+			return resp, nil
+		}
+	}
+	if resp := service.introspectRefreshToken(request.Token); resp != nil {
+		return resp, nil
+	}
+	if request.TokenTypeHint == consts.TokenTypeHintRefreshToken {
+		if resp := service.introspectAccessToken(request.Token); resp != nil {
+			return resp, nil
+		}
+	}
+
+	return &models.IntrospectionResponse{Active: false}, nil
+}
+
+// Revoke invalidates an access or refresh token issued to the calling client.
+// Revoking a refresh token ends the whole session. Unknown tokens are not an
+// error, as required by RFC 7009.
+func (service *OAuthService) Revoke(request models.RevocationRequest) error {
+	client, err := service.authenticateClient(request.ClientID, request.ClientSecret)
+	if err != nil {
+		return err
+	}
+
+	if request.TokenTypeHint != consts.TokenTypeHintAccessToken {
+		if tokenData, err := service.userService.ValidateRefreshToken(request.Token); err == nil {
+			if !service.issuedTo(client, tokenData.UserID, tokenData.SessionID) {
+				return rest_errors.ErrOAuthTokenNotOwned
+			}
+			return service.userService.RevokeSession(tokenData.UserID, tokenData.SessionID)
+		}
+	}
+
+	tokenData, err := service.userService.ValidateAccessToken(request.Token)
+	if err != nil {
+		return nil
+	}
+	if tokenData.UserID == 0 && tokenData.ClientID != client.ClientID {
+		return rest_errors.ErrOAuthTokenNotOwned
+	}
+	if tokenData.UserID != 0 && !service.issuedTo(client, tokenData.UserID, tokenData.SessionID) {
+		return rest_errors.ErrOAuthTokenNotOwned
+	}
+
+	return service.userService.RevokeAccessToken(request.Token)
+}
+
+func (service *OAuthService) introspectAccessToken(token string) *models.IntrospectionResponse {
+	tokenData, err := service.userService.ValidateAccessToken(token)
+	if err != nil {
+		return nil
+	}
+
+	return introspectionResponse(tokenData.Claims, consts.TokenTypeHintAccessToken)
+}
+
+func (service *OAuthService) introspectRefreshToken(token string) *models.IntrospectionResponse {
+	tokenData, err := service.userService.ValidateRefreshToken(token)
+	if err != nil {
+		return nil
+	}
+	if service.redisRepo.Exists(context.Background(), consts.RefreshTokenUsedKey+token, "") {
+		return nil
+	}
+
+	return introspectionResponse(tokenData.Claims, consts.TokenTypeHintRefreshToken)
+}
+
+// issuedTo tells whether a user session was started through the given
+// client.
+func (service *OAuthService) issuedTo(client *models.OAuthClient, userID int, sessionID string) bool {
+	session, err := service.session(userID, sessionID)
+	if err != nil {
+		return false
+	}
+
+	return session.ClientID == client.ClientID
+}
+
+func (service *OAuthService) UserInfo(userID int) (*models.UserInfo, error) {
+	user, err := service.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserInfo{
+		Subject:           strconv.Itoa(user.ID),
+		Email:             user.Email,
+		Name:              user.Name,
+		PreferredUsername: user.UserName,
+		Gender:            user.Gender,
+		PhoneNumber:       user.Phone,
+	}, nil
+}
+
+func (service *OAuthService) Discovery() models.OpenIDConfiguration {
+	issuer := strings.TrimSuffix(config.Config.Issuer, "/")
+
+	return models.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/oauth/userinfo",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		JwksURI:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               supportedGrantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  utils.AccessTokenKeys.Algorithms(),
+		ScopesSupported:                   append([]string{consts.ScopeOpenID, consts.ScopeProfile, consts.ScopeEmail, consts.ScopePhone}, consts.APIScopes...),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "jti", "auth_time", "nonce", "email", "name", "preferred_username", "gender", "phone_number"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	}
+}
+
+func (service *OAuthService) authenticateClient(clientID string, clientSecret string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, rest_errors.ErrOAuthInvalidClient
+	}
+
+	client, err := service.clientRepo.FindByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, rest_errors.ErrOAuthInvalidClient
+	}
+
+	if client.IsPublic() {
+		if clientSecret != "" {
+			return nil, rest_errors.ErrOAuthInvalidClient
+		}
+		return client, nil
+	}
+
+	if err := utils.CompareClientSecret(client.ClientSecret, clientSecret); err != nil {
+		return nil, rest_errors.ErrOAuthInvalidClient
+	}
+
+	return client, nil
+}
+
+func (service *OAuthService) exchangeAuthorizationCode(client *models.OAuthClient, request models.TokenRequest) (*models.TokenResponse, error) {
+	data, err := service.redisRepo.GetAndDelete(context.Background(), consts.AuthorizationCodeKey+request.Code)
+	if err != nil || data == "" {
+		return nil, rest_errors.InvalidGrant("invalid or expired authorization code")
+	}
+
+	code := models.AuthorizationCode{}
+	if err := json.Unmarshal([]byte(data), &code); err != nil {
+		logger.LogError(err)
+		return nil, rest_errors.InvalidGrant("invalid or expired authorization code")
+	}
+
+	// RFC 6749 section 4.1.3: the redirect_uri has to be repeated only if the
+	// authorization request had one.
+	redirectURIMatches := code.RedirectURI == request.RedirectURI || (code.DefaultRedirectURI && request.RedirectURI == "")
+	if code.ClientID != client.ClientID || !redirectURIMatches {
+		return nil, rest_errors.InvalidGrant("authorization code was issued to another client or redirect_uri")
+	}
+
+	if !verifyCodeChallenge(code.CodeChallenge, request.CodeVerifier) {
+		return nil, rest_errors.InvalidGrant("code_verifier does not match the code_challenge")
+	}
+
+	user, err := service.userRepo.FindByID(code.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := service.userService.StartSession(user, models.SignInData{
+		DeviceName: client.Name,
+		UserAgent:  request.UserAgent,
+		IP:         request.IP,
+		ClientID:   client.ClientID,
+		Scope:      code.Scope,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := tokenResponse(tokens)
+	if hasScope(code.Scope, consts.ScopeOpenID) {
+		response.IDToken, err = service.createIDToken(user, client, code)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+func (service *OAuthService) exchangeRefreshToken(client *models.OAuthClient, request models.TokenRequest) (*models.TokenResponse, error) {
+	session, err := service.refreshTokenSession(request.RefreshToken)
+	if err != nil || session.ClientID != client.ClientID {
+		return nil, rest_errors.InvalidGrant("invalid refresh token")
+	}
+
+	tokens, err := service.userService.RefreshToken(request.RefreshToken)
+	if err != nil {
+		return nil, rest_errors.InvalidGrant(err.Error())
+	}
+
+	return tokenResponse(tokens), nil
+}
+
+// clientCredentials issues a short-lived access token identifying the client
+// itself. No refresh token is issued, the client simply asks again.
+func (service *OAuthService) clientCredentials(client *models.OAuthClient, request models.TokenRequest) (*models.TokenResponse, error) {
+	if client.IsPublic() {
+		return nil, rest_errors.ErrOAuthUnauthorizedClient
+	}
+
+	scope, err := grantedScope(client, request.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := config.Config.ClientTokenExpiresIn
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+
+	accessToken, err := utils.CreateToken(ttl, models.Claims{
+		Subject:  client.ClientID,
+		ClientID: client.ClientID,
+		Scope:    scope,
+	}, utils.AccessTokenKeys)
+	if err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+
+	data, err := json.Marshal(models.AccessTokenData{ClientID: client.ClientID, Scope: scope})
+	if err != nil {
+		return nil, err
+	}
+	err = service.redisRepo.SetValue(context.Background(), consts.AccessTokenKey+accessToken, string(data), ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// refreshTokenSession returns the session a refresh token was issued for.
+func (service *OAuthService) refreshTokenSession(refreshToken string) (*models.Session, error) {
+	data, err := service.redisRepo.Get(context.Background(), consts.RefreshTokenKey+refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenData := models.RefreshTokenData{}
+	if err := json.Unmarshal([]byte(data), &tokenData); err != nil {
+		return nil, err
+	}
+
+	return service.session(tokenData.UserID, tokenData.SessionID)
+}
+
+func (service *OAuthService) session(userID int, sessionID string) (*models.Session, error) {
+	sessionData, err := service.redisRepo.GetSingleData(context.Background(), consts.UserSessionsKey+strconv.Itoa(userID), sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session := models.Session{}
+	if err := json.Unmarshal([]byte(sessionData), &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (service *OAuthService) createIDToken(user *models.User, client *models.OAuthClient, code models.AuthorizationCode) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":       strings.TrimSuffix(config.Config.Issuer, "/"),
+		"sub":       strconv.Itoa(user.ID),
+		"aud":       client.ClientID,
+		"auth_time": code.AuthTime,
+	}
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+
+	if hasScope(code.Scope, consts.ScopeEmail) {
+		claims["email"] = user.Email
+	}
+	if hasScope(code.Scope, consts.ScopeProfile) {
+		claims["name"] = user.Name
+		claims["preferred_username"] = user.UserName
+		claims["gender"] = user.Gender
+	}
+	if hasScope(code.Scope, consts.ScopePhone) && user.Phone != "" {
+		claims["phone_number"] = user.Phone
+	}
+
+	ttl := config.Config.IDTokenExpiresIn
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	return utils.CreateTokenWithClaims(ttl, claims, utils.AccessTokenKeys)
+}
+
+func tokenResponse(tokens *models.JWTTokenResponse) *models.TokenResponse {
+	return &models.TokenResponse{
+		AccessToken:  tokens.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(config.Config.AccessTokenExpiresIn.Seconds()),
+		RefreshToken: tokens.Refresh,
+		Scope:        tokens.Scope,
+	}
+}
+
+func introspectionResponse(claims *models.Claims, tokenType string) *models.IntrospectionResponse {
+	return &models.IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Subject:   claims.Subject,
+		TokenType: tokenType,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+	}
+}
+
+// grantedScope checks the requested scope against the scopes the client may
+// ask for. An empty request grants every scope of the client.
+func grantedScope(client *models.OAuthClient, requested string) (string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return strings.Join(client.Scopes, " "), nil
+	}
+
+	for _, scope := range strings.Fields(requested) {
+		if !contains(client.Scopes, scope) {
+			return "", rest_errors.InvalidScope("scope " + scope + " is not allowed for this client")
+		}
+	}
+
+	return strings.Join(strings.Fields(requested), " "), nil
+}
+
+// capScope drops the API scopes the login session of the user does not hold.
+// There is no consent step, so a client never gets more than the session it
+// was authorized with.
+func capScope(scope string, sessionScope string) (string, error) {
+	granted := []string{}
+	for _, s := range strings.Fields(scope) {
+		if isIdentityScope(s) || hasScope(sessionScope, s) {
+			granted = append(granted, s)
+		}
+	}
+	if len(granted) == 0 {
+		return "", rest_errors.InvalidScope("none of the requested scopes can be granted")
+	}
+
+	return strings.Join(granted, " "), nil
+}
+
+func isIdentityScope(scope string) bool {
+	switch scope {
+	case consts.ScopeOpenID, consts.ScopeProfile, consts.ScopeEmail, consts.ScopePhone:
+		return true
+	}
+	return false
+}
+
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func authorizationCodeTTL() time.Duration {
+	if config.Config.AuthorizationCodeExpiresIn <= 0 {
+		return time.Minute
+	}
+	return config.Config.AuthorizationCodeExpiresIn
+}
+
+func hasScope(scope string, want string) bool {
+	return contains(strings.Fields(scope), want)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
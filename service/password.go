@@ -0,0 +1,45 @@
+package service
+
+import (
+	passwordpolicy "auth/common/password"
+	"auth/common/utils"
+	"auth/config"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+)
+
+// validatePassword checks a new password against the password policy.
+func validatePassword(password string, user *models.User) error {
+	return passwordpolicy.DefaultPolicy.Validate(password, passwordpolicy.PersonalInfo{Email: user.Email, UserName: user.UserName, Name: user.Name})
+}
+
+// checkPasswordReuse rejects the current password of the user and the ones
+// used before it, PASSWORD_HISTORY_SIZE passwords in total.
+func checkPasswordReuse(userRepo repository.UserRepositoryInterface, user *models.User, password string) error {
+	if user.Password != "" && utils.ComparePassword(user.Password, password) == nil {
+		return rest_errors.ErrSamePassword
+	}
+
+	if passwordHistorySize() < 2 {
+		return nil
+	}
+	history, err := userRepo.PasswordHistory(user.ID, passwordHistorySize()-1)
+	if err != nil {
+		return err
+	}
+	for _, hash := range history {
+		if utils.ComparePassword(hash, password) == nil {
+			return rest_errors.ErrSamePassword
+		}
+	}
+
+	return nil
+}
+
+func passwordHistorySize() int {
+	if config.Config.PasswordHistorySize > 0 {
+		return config.Config.PasswordHistorySize
+	}
+	return 5
+}
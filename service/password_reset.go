@@ -0,0 +1,282 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/mailer"
+	"auth/common/utils"
+	"auth/config"
+	"auth/consts"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	passwordResetOTPDigits = 6
+	// passwordResetMaxTries wrong OTPs invalidate the pending reset.
+	passwordResetMaxTries = 5
+	// passwordResetMailCooldown is the wait between two mails to an address,
+	// at most passwordResetMaxMails are sent per passwordResetMailWindow.
+	passwordResetMailCooldown = time.Minute
+	passwordResetMaxMails     = 5
+	passwordResetMailWindow   = time.Hour
+)
+
+// PasswordResetServiceInterface lets users who forgot their password set a
+// new one with an OTP mailed to their address.
+type PasswordResetServiceInterface interface {
+	ForgotPassword(email string) error
+	ResendOTP(email string) error
+	ResetPassword(request models.ResetPasswordRequest) error
+}
+
+type PasswordResetService struct {
+	userRepo    repository.UserRepositoryInterface
+	redisRepo   repository.RedisRepositoryInterface
+	mailer      mailer.Mailer
+	userService UserServiceInterface
+	loginGuard  LoginGuardInterface
+}
+
+// passwordReset is the pending reset stored in redis. Only the hash of the
+// OTP is kept.
+type passwordReset struct {
+	UserID  int    `json:"user_id"`
+	OTPHash string `json:"otp_hash"`
+}
+
+func NewPasswordResetService(userRepo repository.UserRepositoryInterface, redisRepo repository.RedisRepositoryInterface, mailer mailer.Mailer, userService UserServiceInterface) PasswordResetServiceInterface {
+	return &PasswordResetService{
+		userRepo:    userRepo,
+		redisRepo:   redisRepo,
+		mailer:      mailer,
+		userService: userService,
+		loginGuard:  NewLoginGuard(redisRepo, userRepo),
+	}
+}
+
+// ForgotPassword mails a new OTP, replacing a pending one. Unknown addresses
+// get the same answer as known ones.
+func (service *PasswordResetService) ForgotPassword(email string) error {
+	email = normalizeEmail(email)
+	if err := service.throttle(email); err != nil {
+		return err
+	}
+
+	user, err := service.userRepo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Disabled {
+		return nil
+	}
+
+	if err := service.sendOTP(email, user); err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrCreatingForgotPasswordOTP
+	}
+	return nil
+}
+
+// ResendOTP mails a fresh OTP while a reset is pending; the previous OTP
+// stops working.
+func (service *PasswordResetService) ResendOTP(email string) error {
+	email = normalizeEmail(email)
+	if err := service.throttle(email); err != nil {
+		return err
+	}
+
+	reset, err := service.pending(email)
+	if err != nil || reset == nil {
+		return err
+	}
+
+	user, err := service.userRepo.FindByID(reset.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := service.sendOTP(email, user); err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrResendingForgotPasswordOTP
+	}
+	return nil
+}
+
+// ResetPassword sets the new password if the OTP matches, then lifts a
+// lockout and signs the user out everywhere.
+func (service *PasswordResetService) ResetPassword(request models.ResetPasswordRequest) error {
+	email := normalizeEmail(request.Email)
+	reset, err := service.pending(email)
+	if err != nil {
+		return err
+	}
+	if reset == nil {
+		return rest_errors.ErrInvalidOTP
+	}
+
+	user, err := service.userRepo.FindByID(reset.UserID)
+	if err != nil {
+		return err
+	}
+	if err := validatePassword(request.Password, user); err != nil {
+		return err
+	}
+
+	tries, err := service.redisRepo.Incr(context.Background(), consts.PasswordResetTryKey+email)
+	if err != nil {
+		return err
+	}
+	if tries == 1 {
+		service.redisRepo.SetExpire(context.Background(), consts.PasswordResetTryKey+email, passwordResetOTPExpiresIn())
+	}
+	if tries > passwordResetMaxTries {
+		service.discard(email)
+		return rest_errors.ErrInvalidOTP
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashOTP(request.OTP)), []byte(reset.OTPHash)) != 1 {
+		return rest_errors.ErrInvalidOTP
+	}
+	if err := checkPasswordReuse(service.userRepo, user, request.Password); err != nil {
+		return err
+	}
+
+	// Taking the reset out of redis makes sure concurrent requests cannot use
+	// the same OTP twice.
+	if data, err := service.redisRepo.GetAndDelete(context.Background(), consts.PasswordResetOTPKey+email); err != nil || data == "" {
+		return rest_errors.ErrInvalidOTP
+	}
+	service.discard(email)
+
+	hash, err := utils.HashPassword(request.Password)
+	if err != nil {
+		logger.LogError(err)
+		return err
+	}
+	if err := service.userRepo.UpdatePassword(user.ID, hash); err != nil {
+		logger.LogError(err)
+		return err
+	}
+	if err := service.loginGuard.Unlock(user.Email, user.ID); err != nil {
+		logger.LogError(err)
+	}
+
+	return service.userService.LogOutAll(user.ID)
+}
+
+// throttle allows one mail per cooldown and a few per window and address.
+func (service *PasswordResetService) throttle(email string) error {
+	first, err := service.redisRepo.SetNX(context.Background(), consts.PasswordResetMailKey+email, "1", passwordResetMailCooldown)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return rest_errors.RetryAfter(rest_errors.ErrRateLimited, passwordResetMailCooldown)
+	}
+
+	sent, err := service.redisRepo.Incr(context.Background(), consts.PasswordResetSentKey+email)
+	if err != nil {
+		return err
+	}
+	if sent == 1 {
+		service.redisRepo.SetExpire(context.Background(), consts.PasswordResetSentKey+email, passwordResetMailWindow)
+	}
+	if sent > passwordResetMaxMails {
+		return rest_errors.RetryAfter(rest_errors.ErrRateLimited, passwordResetMailWindow)
+	}
+
+	return nil
+}
+
+func (service *PasswordResetService) sendOTP(email string, user *models.User) error {
+	otp, err := generateOTP(passwordResetOTPDigits)
+	if err != nil {
+		return err
+	}
+
+	data, _ := json.Marshal(passwordReset{UserID: user.ID, OTPHash: hashOTP(otp)})
+	err = service.redisRepo.SetValue(context.Background(), consts.PasswordResetOTPKey+email, string(data), passwordResetOTPExpiresIn())
+	if err != nil {
+		return err
+	}
+	service.redisRepo.Delete(context.Background(), consts.PasswordResetTryKey+email, nil)
+
+	err = service.mailer.Send(context.Background(), mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"use the code below to set a new password.\n\n" +
+			otp + "\n\n" +
+			"The code expires in " + passwordResetOTPExpiresIn().String() + ". If you did not ask for it you can ignore this mail.\n",
+	})
+	if err != nil {
+		service.discard(email)
+		return err
+	}
+
+	return nil
+}
+
+// pending returns the reset waiting for an OTP, or nil.
+func (service *PasswordResetService) pending(email string) (*passwordReset, error) {
+	if !service.redisRepo.Exists(context.Background(), consts.PasswordResetOTPKey+email, "") {
+		return nil, nil
+	}
+
+	data, err := service.redisRepo.Get(context.Background(), consts.PasswordResetOTPKey+email)
+	if err != nil {
+		return nil, nil
+	}
+
+	reset := &passwordReset{}
+	if err := json.Unmarshal([]byte(data), reset); err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+	return reset, nil
+}
+
+func (service *PasswordResetService) discard(email string) {
+	for _, prefix := range []string{consts.PasswordResetOTPKey, consts.PasswordResetTryKey} {
+		if err := service.redisRepo.Delete(context.Background(), prefix+email, nil); err != nil {
+			logger.LogError(err)
+		}
+	}
+}
+
+// generateOTP returns a random numeric code.
+func generateOTP(digits int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// hashOTP hashes one-time codes and recovery codes with a key derived from
+// APP_KEY. The codes are short, an unkeyed hash of them is reversed by trying
+// every code.
+func hashOTP(otp string) string {
+	mac := hmac.New(sha256.New, utils.AppKey("otp"))
+	mac.Write([]byte(otp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func passwordResetOTPExpiresIn() time.Duration {
+	if config.Config.PasswordResetOTPExpiresIn > 0 {
+		return config.Config.PasswordResetOTPExpiresIn
+	}
+	return 15 * time.Minute
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/phone"
+	"auth/common/sms"
+	"auth/config"
+	"auth/consts"
+	"auth/errors"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	phoneOTPDigits = 6
+	// phoneOTPMaxTries wrong codes discard the pending OTP.
+	phoneOTPMaxTries = 5
+	// phoneSMSCooldown is the wait between two messages to a number, at most
+	// phoneMaxSMS are sent per phoneSMSWindow.
+	phoneSMSCooldown = time.Minute
+	phoneMaxSMS      = 5
+	phoneSMSWindow   = time.Hour
+)
+
+// PhoneServiceInterface verifies the phone numbers of users and lets them log
+// in with a code sent to a verified number.
+type PhoneServiceInterface interface {
+	StartVerification(request models.PhoneRequest) error
+	ConfirmVerification(request models.PhoneVerifyRequest) error
+	SendLogInCode(request models.PhoneRequest) error
+	VerifyLogInCode(request models.PhoneLogInRequest) (*models.User, error)
+}
+
+type PhoneService struct {
+	userRepo   repository.UserRepositoryInterface
+	redisRepo  repository.RedisRepositoryInterface
+	sender     sms.SMSSender
+	loginGuard LoginGuardInterface
+}
+
+// phoneOTP is a pending code stored in redis. Only the hash of the code is
+// kept.
+type phoneOTP struct {
+	UserID  int    `json:"user_id"`
+	Phone   string `json:"phone"`
+	OTPHash string `json:"otp_hash"`
+}
+
+func NewPhoneService(userRepo repository.UserRepositoryInterface, redisRepo repository.RedisRepositoryInterface, sender sms.SMSSender) PhoneServiceInterface {
+	return &PhoneService{
+		userRepo:   userRepo,
+		redisRepo:  redisRepo,
+		sender:     sender,
+		loginGuard: NewLoginGuard(redisRepo, userRepo),
+	}
+}
+
+// StartVerification sends a code to the number the user wants to verify.
+func (service *PhoneService) StartVerification(request models.PhoneRequest) error {
+	number, err := normalizePhone(request.Phone)
+	if err != nil {
+		return err
+	}
+
+	owner, err := service.userRepo.FindByVerifiedPhone(number)
+	if err != nil {
+		return err
+	}
+	if owner != nil && owner.ID != request.UserID {
+		return rest_errors.ErrPhoneAlreadyRegistered
+	}
+
+	if err := service.throttle(number); err != nil {
+		return err
+	}
+
+	return service.sendOTP(phoneVerificationKey(request.UserID), phoneOTP{UserID: request.UserID, Phone: number}, "verification")
+}
+
+// ConfirmVerification stores the number as verified if the code matches. It
+// replaces the phone of the profile.
+func (service *PhoneService) ConfirmVerification(request models.PhoneVerifyRequest) error {
+	key := phoneVerificationKey(request.UserID)
+	pending, err := service.pending(key)
+	if err != nil {
+		return err
+	}
+	if pending == nil {
+		return rest_errors.ErrInvalidOTP
+	}
+
+	if err := service.checkCode(key, pending, request.Code); err != nil {
+		return err
+	}
+
+	verified, err := service.userRepo.SetPhoneVerified(request.UserID, pending.Phone)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return rest_errors.ErrPhoneAlreadyRegistered
+	}
+	return nil
+}
+
+// SendLogInCode sends a login code to a verified number. Unknown numbers get
+// the same answer so the endpoint does not tell which numbers are
+// registered; locked accounts get no code.
+func (service *PhoneService) SendLogInCode(request models.PhoneRequest) error {
+	number, err := normalizePhone(request.Phone)
+	if err != nil {
+		return err
+	}
+
+	if err := service.throttle(number); err != nil {
+		return err
+	}
+
+	user, err := service.userRepo.FindByVerifiedPhone(number)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Disabled {
+		return nil
+	}
+	if err := service.loginGuard.Check(user.Email, request.IP); err != nil {
+		return err
+	}
+
+	return service.sendOTP(phoneLogInKey(number), phoneOTP{UserID: user.ID, Phone: number}, "login")
+}
+
+// VerifyLogInCode checks a login code and returns its user. Wrong codes count
+// as failed logins of the account, like wrong passwords.
+func (service *PhoneService) VerifyLogInCode(request models.PhoneLogInRequest) (*models.User, error) {
+	number, err := normalizePhone(request.Phone)
+	if err != nil {
+		return nil, err
+	}
+
+	key := phoneLogInKey(number)
+	pending, err := service.pending(key)
+	if err != nil {
+		return nil, err
+	}
+	if pending == nil {
+		return nil, rest_errors.ErrInvalidOTP
+	}
+
+	user, err := service.userRepo.FindByID(pending.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.loginGuard.Check(user.Email, request.IP); err != nil {
+		return nil, err
+	}
+	if err := accountLocked(user); err != nil {
+		return nil, err
+	}
+
+	if err := service.checkCode(key, pending, request.Code); err != nil {
+		if err := service.loginGuard.Failure(user.Email, request.IP, user.ID); err != nil {
+			return nil, err
+		}
+		return nil, err
+	}
+	// The number may have been changed since the code was sent.
+	if !user.PhoneVerified || user.Phone != pending.Phone {
+		return nil, rest_errors.ErrInvalidOTP
+	}
+	service.loginGuard.Success(user.Email)
+
+	return user, nil
+}
+
+// checkCode compares the code with the pending OTP under key and uses the OTP
+// up if it matches.
+func (service *PhoneService) checkCode(key string, pending *phoneOTP, code string) error {
+	tries, err := service.redisRepo.Incr(context.Background(), consts.PhoneOTPTryKey+key)
+	if err != nil {
+		return err
+	}
+	if tries == 1 {
+		service.redisRepo.SetExpire(context.Background(), consts.PhoneOTPTryKey+key, phoneOTPExpiresIn())
+	}
+	if tries > phoneOTPMaxTries {
+		service.discard(key)
+		return rest_errors.ErrInvalidOTP
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashOTP(code)), []byte(pending.OTPHash)) != 1 {
+		return rest_errors.ErrInvalidOTP
+	}
+
+	// Taking the OTP out of redis makes sure concurrent requests cannot use
+	// the same code twice.
+	if data, err := service.redisRepo.GetAndDelete(context.Background(), consts.PhoneOTPKey+key); err != nil || data == "" {
+		return rest_errors.ErrInvalidOTP
+	}
+	service.discard(key)
+	return nil
+}
+
+// throttle allows one message per cooldown and a few per window and number.
+func (service *PhoneService) throttle(number string) error {
+	first, err := service.redisRepo.SetNX(context.Background(), consts.PhoneOTPSMSKey+number, "1", phoneSMSCooldown)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return rest_errors.RetryAfter(rest_errors.ErrRateLimited, phoneSMSCooldown)
+	}
+
+	sent, err := service.redisRepo.Incr(context.Background(), consts.PhoneOTPSentKey+number)
+	if err != nil {
+		return err
+	}
+	if sent == 1 {
+		service.redisRepo.SetExpire(context.Background(), consts.PhoneOTPSentKey+number, phoneSMSWindow)
+	}
+	if sent > phoneMaxSMS {
+		return rest_errors.RetryAfter(rest_errors.ErrRateLimited, phoneSMSWindow)
+	}
+
+	return nil
+}
+
+func (service *PhoneService) sendOTP(key string, pending phoneOTP, purpose string) error {
+	otp, err := generateOTP(phoneOTPDigits)
+	if err != nil {
+		return err
+	}
+
+	pending.OTPHash = hashOTP(otp)
+	data, _ := json.Marshal(pending)
+	err = service.redisRepo.SetValue(context.Background(), consts.PhoneOTPKey+key, string(data), phoneOTPExpiresIn())
+	if err != nil {
+		return err
+	}
+	service.redisRepo.Delete(context.Background(), consts.PhoneOTPTryKey+key, nil)
+
+	err = service.sender.Send(context.Background(), sms.Message{
+		To:   pending.Phone,
+		Body: "Your " + purpose + " code is " + otp + ". It expires in " + phoneOTPExpiresIn().String() + ".",
+	})
+	if err != nil {
+		logger.LogError(err)
+		service.discard(key)
+		return rest_errors.ErrSendingSMS
+	}
+
+	return nil
+}
+
+// pending returns the OTP waiting under key, or nil.
+func (service *PhoneService) pending(key string) (*phoneOTP, error) {
+	data, err := service.redisRepo.Get(context.Background(), consts.PhoneOTPKey+key)
+	if err != nil || data == "" {
+		return nil, nil
+	}
+
+	pending := &phoneOTP{}
+	if err := json.Unmarshal([]byte(data), pending); err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+	return pending, nil
+}
+
+func (service *PhoneService) discard(key string) {
+	for _, prefix := range []string{consts.PhoneOTPKey, consts.PhoneOTPTryKey} {
+		if err := service.redisRepo.Delete(context.Background(), prefix+key, nil); err != nil {
+			logger.LogError(err)
+		}
+	}
+}
+
+// normalizePhone answers a number that cannot be normalized with the
+// application error matching the reason.
+func normalizePhone(number string) (string, error) {
+	normalized, err := phone.Normalize(number, config.Config.PhoneDefaultCountryCode)
+	switch err {
+	case nil:
+		return normalized, nil
+	case phone.ErrInvalidCountryCode:
+		return "", phoneError(errors.InvaidCountryCode, "invalid country code, use the international format such as +4915112345678")
+	case phone.ErrInvalidSubscriber:
+		return "", phoneError(errors.InvaidMobile, "invalid mobile number, it is too short or too long")
+	default:
+		return "", phoneError(errors.InvaidPhone, "invalid phone number, use the international format such as +4915112345678")
+	}
+}
+
+func phoneError(errorType errors.ErrorType, message string) errors.ApplicationError {
+	return errors.ApplicationError{
+		ErrorType:         errorType,
+		TranslationKey:    message,
+		TranslationParams: map[string]interface{}{"field": "phone"},
+		HttpCode:          http.StatusBadRequest,
+	}
+}
+
+func phoneVerificationKey(userID int) string {
+	return "verify:" + strconv.Itoa(userID)
+}
+
+func phoneLogInKey(number string) string {
+	return "login:" + number
+}
+
+func phoneOTPExpiresIn() time.Duration {
+	if config.Config.PhoneOTPExpiresIn > 0 {
+		return config.Config.PhoneOTPExpiresIn
+	}
+	return 5 * time.Minute
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+	"strings"
+)
+
+type RoleServiceInterface interface {
+	CreateRole(role models.Role) (*models.Role, error)
+	ListRoles() ([]*models.Role, error)
+	CreatePermission(permission models.Permission) (*models.Permission, error)
+	ListPermissions() ([]*models.Permission, error)
+	AddRolePermission(roleName string, permissionName string) (*models.Role, error)
+	RemoveRolePermission(roleName string, permissionName string) (*models.Role, error)
+	UserRoles(userID int) ([]string, error)
+	AssignRole(userID int, roleName string) ([]string, error)
+	UnassignRole(userID int, roleName string) ([]string, error)
+	HasPermissions(roles []string, permissions ...string) (bool, error)
+}
+
+type RoleService struct {
+	repository repository.RoleRepositoryInterface
+	userRepo   repository.UserRepositoryInterface
+}
+
+func NewRoleService(repository repository.RoleRepositoryInterface, userRepo repository.UserRepositoryInterface) RoleServiceInterface {
+	return &RoleService{repository: repository, userRepo: userRepo}
+}
+
+// CreateRole creates a role together with the permissions listed in it.
+func (service *RoleService) CreateRole(role models.Role) (*models.Role, error) {
+	role.Name = strings.TrimSpace(role.Name)
+	if err := role.Validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := service.repository.FindRoleByName(role.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, rest_errors.ErrRoleAlreadyExists
+	}
+
+	permissions := []*models.Permission{}
+	for _, name := range role.Permissions {
+		permission, err := service.findPermission(name)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	roleID, err := service.repository.CreateRole(role)
+	if err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+
+	for _, permission := range permissions {
+		if err := service.repository.AddRolePermission(roleID, permission.ID); err != nil {
+			logger.LogError(err)
+			return nil, err
+		}
+	}
+
+	return service.repository.FindRoleByName(role.Name)
+}
+
+func (service *RoleService) ListRoles() ([]*models.Role, error) {
+	return service.repository.ListRoles()
+}
+
+func (service *RoleService) CreatePermission(permission models.Permission) (*models.Permission, error) {
+	permission.Name = strings.TrimSpace(permission.Name)
+	if err := permission.Validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := service.repository.FindPermissionByName(permission.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, rest_errors.ErrPermissionAlreadyExists
+	}
+
+	permission.ID, err = service.repository.CreatePermission(permission)
+	if err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+
+	return &permission, nil
+}
+
+func (service *RoleService) ListPermissions() ([]*models.Permission, error) {
+	return service.repository.ListPermissions()
+}
+
+func (service *RoleService) AddRolePermission(roleName string, permissionName string) (*models.Role, error) {
+	role, err := service.findRole(roleName)
+	if err != nil {
+		return nil, err
+	}
+	permission, err := service.findPermission(permissionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.repository.AddRolePermission(role.ID, permission.ID); err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+
+	return service.repository.FindRoleByName(role.Name)
+}
+
+func (service *RoleService) RemoveRolePermission(roleName string, permissionName string) (*models.Role, error) {
+	role, err := service.findRole(roleName)
+	if err != nil {
+		return nil, err
+	}
+	permission, err := service.findPermission(permissionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.repository.RemoveRolePermission(role.ID, permission.ID); err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+
+	return service.repository.FindRoleByName(role.Name)
+}
+
+func (service *RoleService) UserRoles(userID int) ([]string, error) {
+	if _, err := service.userRepo.FindByID(userID); err != nil {
+		return nil, err
+	}
+
+	return service.repository.UserRoles(userID)
+}
+
+// AssignRole gives the user a role. Like every role change it shows up in the
+// user's tokens from their next login or token refresh on.
+func (service *RoleService) AssignRole(userID int, roleName string) ([]string, error) {
+	if _, err := service.userRepo.FindByID(userID); err != nil {
+		return nil, err
+	}
+	role, err := service.findRole(roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.repository.AssignRole(userID, role.ID); err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+
+	return service.repository.UserRoles(userID)
+}
+
+func (service *RoleService) UnassignRole(userID int, roleName string) ([]string, error) {
+	if _, err := service.userRepo.FindByID(userID); err != nil {
+		return nil, err
+	}
+	role, err := service.findRole(roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.repository.UnassignRole(userID, role.ID); err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+
+	return service.repository.UserRoles(userID)
+}
+
+// HasPermissions tells whether the roles together grant every permission.
+func (service *RoleService) HasPermissions(roles []string, permissions ...string) (bool, error) {
+	if len(roles) == 0 {
+		return len(permissions) == 0, nil
+	}
+
+	granted, err := service.repository.RolePermissions(roles)
+	if err != nil {
+		return false, err
+	}
+
+	for _, permission := range permissions {
+		if !contains(granted, permission) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (service *RoleService) findRole(name string) (*models.Role, error) {
+	role, err := service.repository.FindRoleByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, rest_errors.ErrRoleNotFound
+	}
+	return role, nil
+}
+
+func (service *RoleService) findPermission(name string) (*models.Permission, error) {
+	permission, err := service.repository.FindPermissionByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if permission == nil {
+		return nil, rest_errors.ErrPermissionNotFound
+	}
+	return permission, nil
+}
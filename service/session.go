@@ -0,0 +1,279 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/utils"
+	"auth/consts"
+	"auth/models"
+	"auth/rest_errors"
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// sessionTouchInterval limits how often the last-seen time of a session is
+// written back to redis.
+const sessionTouchInterval = time.Minute
+
+// Authenticate validates the access token of a user request and returns the
+// data stored for it.
+func (service *UserService) Authenticate(accessToken string) (*models.AccessTokenData, error) {
+	tokenData, err := service.ValidateAccessToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if tokenData.UserID == 0 {
+		return nil, rest_errors.ErrUnauthorized
+	}
+
+	if tokenData.SessionID != "" {
+		service.touchSession(tokenData.UserID, tokenData.SessionID)
+	}
+
+	return tokenData, nil
+}
+
+// ValidateAccessToken checks the signature of an access token and that it is
+// still present in the token store. User tokens are also rejected once their
+// session was revoked or the user logged out everywhere.
+func (service *UserService) ValidateAccessToken(accessToken string) (*models.AccessTokenData, error) {
+	claims, err := utils.ValidateToken(accessToken, utils.AccessTokenKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := service.redisRepo.Get(context.Background(), consts.AccessTokenKey+accessToken)
+	if err != nil || data == "" {
+		return nil, rest_errors.ErrUnauthorized
+	}
+
+	tokenData := models.AccessTokenData{}
+	if err := json.Unmarshal([]byte(data), &tokenData); err != nil {
+		logger.LogError(err)
+		return nil, rest_errors.ErrUnauthorized
+	}
+	tokenData.Claims = claims
+	if tokenData.UserID == 0 {
+		return &tokenData, nil
+	}
+
+	if service.redisRepo.Exists(context.Background(), consts.DisabledUserKey+strconv.Itoa(tokenData.UserID), "") {
+		return nil, rest_errors.ErrAccountDisabled
+	}
+
+	generation, err := service.tokenGeneration(tokenData.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if tokenData.Generation != generation {
+		return nil, rest_errors.ErrTokenRevoked
+	}
+
+	if tokenData.SessionID != "" {
+		sessionsKey := consts.UserSessionsKey + strconv.Itoa(tokenData.UserID)
+		if !service.redisRepo.Exists(context.Background(), sessionsKey, tokenData.SessionID) {
+			return nil, rest_errors.ErrSessionRevoked
+		}
+	}
+
+	return &tokenData, nil
+}
+
+// ValidateRefreshToken checks the signature of a refresh token and that its
+// session and token generation are still valid. Whether the token was already
+// used is only decided when it is exchanged.
+func (service *UserService) ValidateRefreshToken(refreshToken string) (*models.RefreshTokenData, error) {
+	claims, err := utils.ValidateToken(refreshToken, utils.RefreshTokenKeys)
+	if err != nil {
+		logger.LogError(err)
+		return nil, rest_errors.ErrInvalidRefreshToken
+	}
+
+	data, err := service.redisRepo.Get(context.Background(), consts.RefreshTokenKey+refreshToken)
+	if err != nil || data == "" {
+		return nil, rest_errors.ErrInvalidRefreshToken
+	}
+
+	tokenData := models.RefreshTokenData{}
+	if err := json.Unmarshal([]byte(data), &tokenData); err != nil {
+		logger.LogError(err)
+		return nil, rest_errors.ErrInvalidRefreshToken
+	}
+	tokenData.Claims = claims
+
+	if !service.redisRepo.Exists(context.Background(), consts.TokenFamilyKey+tokenData.SessionID, "") {
+		return nil, rest_errors.ErrInvalidRefreshToken
+	}
+
+	generation, err := service.tokenGeneration(tokenData.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if tokenData.Generation != generation {
+		return nil, rest_errors.ErrTokenRevoked
+	}
+
+	return &tokenData, nil
+}
+
+// RevokeAccessToken removes a single access token from the token store.
+func (service *UserService) RevokeAccessToken(accessToken string) error {
+	return service.redisRepo.Delete(context.Background(), consts.AccessTokenKey+accessToken, nil)
+}
+
+func (service *UserService) ListSessions(userID int, currentSessionID string) ([]*models.Session, error) {
+	sessionsKey := consts.UserSessionsKey + strconv.Itoa(userID)
+	data, err := service.redisRepo.GetAll(context.Background(), sessionsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []*models.Session{}
+	expired := []string{}
+	for sessionID, value := range data {
+		if !service.redisRepo.Exists(context.Background(), consts.TokenFamilyKey+sessionID, "") {
+			expired = append(expired, sessionID)
+			continue
+		}
+
+		session := models.Session{}
+		if err := json.Unmarshal([]byte(value), &session); err != nil {
+			logger.LogError(err)
+			continue
+		}
+		session.Current = session.ID == currentSessionID
+		sessions = append(sessions, &session)
+	}
+
+	if len(expired) > 0 {
+		if err := service.redisRepo.Delete(context.Background(), sessionsKey, expired); err != nil {
+			logger.LogError(err)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+func (service *UserService) RevokeSession(userID int, sessionID string) error {
+	sessionsKey := consts.UserSessionsKey + strconv.Itoa(userID)
+	if !service.redisRepo.Exists(context.Background(), sessionsKey, sessionID) {
+		return rest_errors.ErrSessionNotFound
+	}
+
+	return service.revokeSession(userID, sessionID)
+}
+
+// LogOutAll invalidates every access and refresh token of the user by bumping
+// the user's token generation, then drops all of the user's sessions.
+func (service *UserService) LogOutAll(userID int) error {
+	_, err := service.redisRepo.Incr(context.Background(), consts.TokenGenerationKey+strconv.Itoa(userID))
+	if err != nil {
+		return err
+	}
+
+	sessionsKey := consts.UserSessionsKey + strconv.Itoa(userID)
+	sessions, err := service.redisRepo.GetAll(context.Background(), sessionsKey)
+	if err != nil {
+		logger.LogError(err)
+		return nil
+	}
+
+	for sessionID := range sessions {
+		if err := service.revokeTokenFamily(sessionID); err != nil {
+			logger.LogError(err)
+		}
+	}
+
+	if err := service.redisRepo.Delete(context.Background(), sessionsKey, nil); err != nil {
+		logger.LogError(err)
+	}
+
+	return nil
+}
+
+// tokenGeneration returns the current token generation of the user. Tokens
+// minted under an older generation are no longer accepted.
+func (service *UserService) tokenGeneration(userID int) (int64, error) {
+	data, err := service.redisRepo.Get(context.Background(), consts.TokenGenerationKey+strconv.Itoa(userID))
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		logger.LogError(err)
+		return 0, err
+	}
+
+	return strconv.ParseInt(data, 10, 64)
+}
+
+func (service *UserService) createSession(userID int, signInInfo models.SignInData) (*models.Session, error) {
+	sessionID, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	session := &models.Session{
+		ID:         sessionID,
+		DeviceName: signInInfo.DeviceName,
+		UserAgent:  signInInfo.UserAgent,
+		IP:         signInInfo.IP,
+		ClientID:   signInInfo.ClientID,
+		Scope:      signInInfo.Scope,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+
+	return session, service.saveSession(userID, session)
+}
+
+func (service *UserService) saveSession(userID int, session *models.Session) error {
+	byteData, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	value := map[string]interface{}{session.ID: byteData}
+	return service.redisRepo.Set(context.Background(), consts.UserSessionsKey+strconv.Itoa(userID), value)
+}
+
+// touchSession refreshes the last-seen time of a session. Failures are only
+// logged since they must never block an authenticated request.
+func (service *UserService) touchSession(userID int, sessionID string) {
+	data, err := service.redisRepo.GetSingleData(context.Background(), consts.UserSessionsKey+strconv.Itoa(userID), sessionID)
+	if err != nil || data == "" {
+		return
+	}
+
+	session := models.Session{}
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		logger.LogError(err)
+		return
+	}
+
+	if time.Since(session.LastSeenAt) < sessionTouchInterval {
+		return
+	}
+
+	session.LastSeenAt = time.Now().UTC()
+	if err := service.saveSession(userID, &session); err != nil {
+		logger.LogError(err)
+	}
+}
+
+// revokeSession kills the token family of the session and forgets the session.
+func (service *UserService) revokeSession(userID int, sessionID string) error {
+	if err := service.revokeTokenFamily(sessionID); err != nil {
+		return err
+	}
+
+	return service.redisRepo.Delete(context.Background(), consts.UserSessionsKey+strconv.Itoa(userID), []string{sessionID})
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/social"
+	"auth/common/utils"
+	"auth/config"
+	"auth/consts"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// socialLogInStateTTL is how long a user may take at the provider.
+const socialLogInStateTTL = 10 * time.Minute
+
+// SocialLogInInterface signs users in through external OAuth 2.0 and OpenID
+// Connect providers. Users are matched by the identity at the provider, or
+// by a verified email for their first login with it.
+type SocialLogInInterface interface {
+	Providers() []string
+	AuthCodeURL(provider string, deviceName string) (string, error)
+	Authenticate(request models.SocialLogInRequest) (*models.User, *models.SocialLogInState, error)
+	LinkedProviders(userID int) ([]string, error)
+	LinkURL(userID int, provider string) (string, error)
+	Identify(userID int, request models.IdentityLinkRequest) (*social.Identity, error)
+}
+
+type SocialLogIn struct {
+	userRepo     repository.UserRepositoryInterface
+	identityRepo repository.IdentityRepositoryInterface
+	redisRepo    repository.RedisRepositoryInterface
+	providers    map[string]social.Provider
+}
+
+func NewSocialLogIn(userRepo repository.UserRepositoryInterface, identityRepo repository.IdentityRepositoryInterface, redisRepo repository.RedisRepositoryInterface, providers map[string]social.Provider) SocialLogInInterface {
+	return &SocialLogIn{userRepo: userRepo, identityRepo: identityRepo, redisRepo: redisRepo, providers: providers}
+}
+
+// Providers returns the names of the configured providers.
+func (s *SocialLogIn) Providers() []string {
+	names := []string{}
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AuthCodeURL starts a login and returns the authorization url of the
+// provider to send the browser to.
+func (s *SocialLogIn) AuthCodeURL(provider string, deviceName string) (string, error) {
+	return s.begin(models.SocialLogInState{
+		Provider:    provider,
+		RedirectURI: socialCallbackURL(provider),
+		DeviceName:  deviceName,
+	})
+}
+
+// LinkURL starts adding an identity at the provider to the account of a
+// logged-in user. The provider redirects to SOCIAL_LINK_URL, from where the
+// code goes to Identify on behalf of the same user.
+func (s *SocialLogIn) LinkURL(userID int, provider string) (string, error) {
+	return s.begin(models.SocialLogInState{
+		Provider:    provider,
+		RedirectURI: socialLinkURL(),
+		UserID:      userID,
+	})
+}
+
+func (s *SocialLogIn) begin(pending models.SocialLogInState) (string, error) {
+	p, ok := s.providers[pending.Provider]
+	if !ok {
+		return "", rest_errors.ErrInvalidLoginProvider
+	}
+
+	state, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	pending.Nonce = nonce
+	pending.CodeVerifier = verifier
+	data, _ := json.Marshal(pending)
+	err = s.redisRepo.SetValue(context.Background(), consts.SocialLogInKey+state, string(data), socialLogInStateTTL)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	link, err := p.AuthCodeURL(context.Background(), social.AuthRequest{
+		RedirectURI:   pending.RedirectURI,
+		State:         state,
+		Nonce:         nonce,
+		CodeChallenge: base64.RawURLEncoding.EncodeToString(challenge[:]),
+	})
+	if err != nil {
+		logger.LogError(err)
+		return "", rest_errors.ErrSocialLogIn
+	}
+
+	return link, nil
+}
+
+// Authenticate finishes a login at the provider and returns the user, who is
+// registered without a password on the first login. The state is used up
+// whatever the outcome.
+func (s *SocialLogIn) Authenticate(request models.SocialLogInRequest) (*models.User, *models.SocialLogInState, error) {
+	pending, err := s.consumeState(request.Provider, request.State)
+	if err != nil {
+		return nil, nil, err
+	}
+	// A state for linking must not log anybody in.
+	if pending.UserID != 0 {
+		return nil, nil, rest_errors.ErrInvalidSocialLogInState
+	}
+	if request.Error != "" {
+		logger.LogError(request.Provider, " refused the login: ", request.Error, " ", request.ErrorDescription)
+		return nil, nil, rest_errors.ErrSocialLogIn
+	}
+
+	identity, err := s.exchange(pending, request.State, request.Code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.findOrCreateUser(identity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, pending, nil
+}
+
+// Identify finishes a LinkURL and returns the identity at the provider. The
+// state has to be one the same user started, so nobody can get their
+// identity linked to the account of someone else.
+func (s *SocialLogIn) Identify(userID int, request models.IdentityLinkRequest) (*social.Identity, error) {
+	pending, err := s.consumeState(request.Provider, request.State)
+	if err != nil {
+		return nil, err
+	}
+	if pending.UserID == 0 || pending.UserID != userID {
+		return nil, rest_errors.ErrInvalidSocialLogInState
+	}
+
+	return s.exchange(pending, request.State, request.Code)
+}
+
+func (s *SocialLogIn) exchange(pending *models.SocialLogInState, state string, code string) (*social.Identity, error) {
+	identity, err := s.providers[pending.Provider].Exchange(context.Background(), code, social.AuthRequest{
+		RedirectURI:  pending.RedirectURI,
+		State:        state,
+		Nonce:        pending.Nonce,
+		CodeVerifier: pending.CodeVerifier,
+	})
+	if err != nil {
+		logger.LogError(err)
+		return nil, rest_errors.ErrSocialLogIn
+	}
+
+	return identity, nil
+}
+
+// LinkedProviders returns the providers the user has an identity at.
+func (s *SocialLogIn) LinkedProviders(userID int) ([]string, error) {
+	identities, err := s.identityRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := []string{}
+	for _, identity := range identities {
+		providers = append(providers, identity.Provider)
+	}
+	return providers, nil
+}
+
+func (s *SocialLogIn) consumeState(provider string, state string) (*models.SocialLogInState, error) {
+	if state == "" {
+		return nil, rest_errors.ErrInvalidSocialLogInState
+	}
+
+	data, err := s.redisRepo.GetAndDelete(context.Background(), consts.SocialLogInKey+state)
+	if err != nil || data == "" {
+		return nil, rest_errors.ErrInvalidSocialLogInState
+	}
+
+	pending := &models.SocialLogInState{}
+	if err := json.Unmarshal([]byte(data), pending); err != nil {
+		logger.LogError(err)
+		return nil, rest_errors.ErrInvalidSocialLogInState
+	}
+	if provider != "" && pending.Provider != provider {
+		return nil, rest_errors.ErrInvalidSocialLogInState
+	}
+	if _, ok := s.providers[pending.Provider]; !ok {
+		return nil, rest_errors.ErrInvalidLoginProvider
+	}
+
+	return pending, nil
+}
+
+// findOrCreateUser returns the user the identity belongs to. An identity seen
+// for the first time is added to the account with the same email, but only
+// if both sides verified the address: otherwise whoever registered the
+// address first could take over the other account.
+func (s *SocialLogIn) findOrCreateUser(identity *social.Identity) (*models.User, error) {
+	existing, err := s.identityRepo.FindByProviderSubject(identity.Provider, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if err := s.identityRepo.UpdateLastUsed(existing.ID, normalizeEmail(identity.Email)); err != nil {
+			return nil, err
+		}
+		return s.userRepo.FindByID(existing.UserID)
+	}
+
+	if identity.Email == "" {
+		return nil, rest_errors.ErrFetchingEmail
+	}
+	if identity.PrivateEmail {
+		return nil, rest_errors.ErrUsingPrivateEmail
+	}
+
+	email := normalizeEmail(identity.Email)
+	record := &models.Identity{Provider: identity.Provider, Subject: identity.Subject, Email: email}
+
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		if !identity.EmailVerified || !user.EmailVerified {
+			return nil, rest_errors.ErrEmailAlreadyRegistered
+		}
+		record.UserID = user.ID
+		if _, err := s.identityRepo.Create(record); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	userID, err := s.identityRepo.CreateWithUser(models.User{
+		Name:          identity.Name,
+		Email:         email,
+		EmailVerified: identity.EmailVerified,
+	}, record)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userRepo.FindByID(userID)
+}
+
+func socialCallbackURL(provider string) string {
+	base := config.Config.SocialCallbackURL
+	if base == "" {
+		base = strings.TrimSuffix(config.Config.Issuer, "/") + "/api/auth/social"
+	}
+	return strings.TrimSuffix(base, "/") + "/" + provider + "/callback"
+}
+
+func socialLinkURL() string {
+	if config.Config.SocialLinkURL != "" {
+		return config.Config.SocialLinkURL
+	}
+	return strings.TrimSuffix(config.Config.Issuer, "/") + "/link-identity"
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/social"
+	"auth/common/social/socialtest"
+	"auth/config"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	logger.NewLogger(nil)
+	os.Exit(m.Run())
+}
+
+// memoryRedis keeps the values the social login stores in redis.
+type memoryRedis struct {
+	repository.RedisRepositoryInterface
+	values map[string]string
+}
+
+func (r *memoryRedis) SetValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	r.values[key] = value
+	return nil
+}
+
+func (r *memoryRedis) GetAndDelete(ctx context.Context, key string) (string, error) {
+	value := r.values[key]
+	delete(r.values, key)
+	return value, nil
+}
+
+// memoryUsers and memoryIdentities stand in for the tables.
+type memoryUsers struct {
+	repository.UserRepositoryInterface
+	users map[int]*models.User
+}
+
+func (r *memoryUsers) FindByID(id int) (*models.User, error) {
+	return r.users[id], nil
+}
+
+func (r *memoryUsers) FindByEmail(email string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.Email == normalizeEmail(email) {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+type memoryIdentities struct {
+	repository.IdentityRepositoryInterface
+	users      *memoryUsers
+	identities []*models.Identity
+}
+
+func (r *memoryIdentities) Create(identity *models.Identity) (int, error) {
+	identity.ID = len(r.identities) + 1
+	r.identities = append(r.identities, identity)
+	return identity.ID, nil
+}
+
+func (r *memoryIdentities) CreateWithUser(user models.User, identity *models.Identity) (int, error) {
+	user.ID = len(r.users.users) + 1
+	r.users.users[user.ID] = &user
+	identity.UserID = user.ID
+	_, err := r.Create(identity)
+	return user.ID, err
+}
+
+func (r *memoryIdentities) FindByProviderSubject(provider string, subject string) (*models.Identity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryIdentities) UpdateLastUsed(id int, email string) error {
+	return nil
+}
+
+// socialLogIn runs a whole login through the mock issuer and returns the
+// user it ended with.
+func socialLogIn(t *testing.T, service SocialLogInInterface, issuer *socialtest.Issuer, claims func(nonce string) map[string]interface{}) (*models.User, error) {
+	t.Helper()
+
+	link, err := service.AuthCodeURL("test", "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+
+	idToken := issuer.Claims("", query.Get("nonce"))
+	for key, value := range claims(query.Get("nonce")) {
+		idToken[key] = value
+	}
+	issuer.SetIDToken(issuer.Sign(t, idToken))
+
+	user, pending, err := service.Authenticate(models.SocialLogInRequest{Provider: "test", State: query.Get("state"), Code: "code"})
+	if err == nil && pending.DeviceName != "laptop" {
+		t.Fatalf("device name %q got lost", pending.DeviceName)
+	}
+	return user, err
+}
+
+func TestSocialLogInCreatesAndMatchesUsers(t *testing.T) {
+	config.Config.Issuer = "https://auth.example.com"
+	issuer := socialtest.NewIssuer(t)
+	provider := social.NewOIDCProvider("test", issuer.URL, socialtest.ClientID, "secret", nil)
+
+	users := &memoryUsers{users: map[int]*models.User{
+		1: {ID: 1, Email: "bob@example.com", EmailVerified: true},
+		2: {ID: 2, Email: "carol@example.com"},
+	}}
+	identities := &memoryIdentities{users: users}
+	service := NewSocialLogIn(users, identities, &memoryRedis{values: map[string]string{}}, map[string]social.Provider{"test": provider})
+
+	identity := func(subject string, email string, verified bool) func(string) map[string]interface{} {
+		return func(nonce string) map[string]interface{} {
+			return map[string]interface{}{"sub": subject, "email": email, "email_verified": verified, "name": subject}
+		}
+	}
+
+	// A new identity with an unknown email registers a user without password.
+	alice, err := socialLogIn(t, service, issuer, identity("alice-at-test", "Alice@Example.com", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Email != "alice@example.com" || !alice.EmailVerified || alice.Password != "" {
+		t.Fatalf("registered user = %+v", alice)
+	}
+
+	// The second login finds the identity, even with a changed email.
+	again, err := socialLogIn(t, service, issuer, identity("alice-at-test", "alice@new.example.com", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != alice.ID {
+		t.Fatalf("second login ended as user %d, want %d", again.ID, alice.ID)
+	}
+
+	// A verified email joins the account with the same verified email.
+	bob, err := socialLogIn(t, service, issuer, identity("bob-at-test", "BOB@example.com", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.ID != 1 {
+		t.Fatalf("login ended as user %d, want 1", bob.ID)
+	}
+
+	// Without verification on both sides the accounts stay apart.
+	if _, err := socialLogIn(t, service, issuer, identity("mallory-at-test", "bob@example.com", false)); err != rest_errors.ErrEmailAlreadyRegistered {
+		t.Fatalf("unverified provider email: got %v", err)
+	}
+	if _, err := socialLogIn(t, service, issuer, identity("carol-at-test", "carol@example.com", true)); err != rest_errors.ErrEmailAlreadyRegistered {
+		t.Fatalf("unverified account email: got %v", err)
+	}
+
+	if len(identities.identities) != 2 || len(users.users) != 3 {
+		t.Fatalf("%d identities and %d users stored, want 2 and 3", len(identities.identities), len(users.users))
+	}
+}
+
+func TestSocialLogInRefusesForeignTokens(t *testing.T) {
+	config.Config.Issuer = "https://auth.example.com"
+	issuer := socialtest.NewIssuer(t)
+	provider := social.NewOIDCProvider("test", issuer.URL, socialtest.ClientID, "secret", nil)
+	users := &memoryUsers{users: map[int]*models.User{}}
+	service := NewSocialLogIn(users, &memoryIdentities{users: users}, &memoryRedis{values: map[string]string{}}, map[string]social.Provider{"test": provider})
+
+	// An ID token minted for another login, with its own nonce, is refused.
+	_, err := socialLogIn(t, service, issuer, func(nonce string) map[string]interface{} {
+		return map[string]interface{}{"sub": "alice", "email": "alice@example.com", "email_verified": true, "nonce": "replayed"}
+	})
+	if err != rest_errors.ErrSocialLogIn {
+		t.Fatalf("got %v, want ErrSocialLogIn", err)
+	}
+	if len(users.users) != 0 {
+		t.Fatal("user registered from a refused token")
+	}
+}
@@ -4,39 +4,83 @@ import (
 	"auth/common/logger"
 	"auth/common/utils"
 	"auth/config"
+	"auth/consts"
 	"auth/models"
 	"auth/pb"
 	"auth/repository"
+	"auth/rest_errors"
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type UserServiceInterface interface {
 	Register(user models.User) (int, error)
 	LogIn(signInInfo models.SignInData) (*models.JWTTokenResponse, error)
+	StartSession(user *models.User, signInInfo models.SignInData) (*models.JWTTokenResponse, error)
+	RefreshToken(refreshToken string) (*models.JWTTokenResponse, error)
+	Authenticate(accessToken string) (*models.AccessTokenData, error)
+	ValidateAccessToken(accessToken string) (*models.AccessTokenData, error)
+	ValidateRefreshToken(refreshToken string) (*models.RefreshTokenData, error)
+	RevokeAccessToken(accessToken string) error
+	LogOutAll(userID int) error
+	ListSessions(userID int, currentSessionID string) ([]*models.Session, error)
+	RevokeSession(userID int, sessionID string) error
 	UpdateProfile(user *models.User) error
+	ChangePassword(request models.ChangePasswordRequest) error
 	ViewProfile(userID int) (*models.User, error)
 	LogOut(accessToken string) error
 	RequestSent(userID int, requestedID int) error
 	RequestAccept(userID int, requestedID int) error
 	ManageConnection(userID int, friendID int) error
 	ViewFriends(userID int) ([]*models.User, error)
+	VerifyEmail(token string) error
+	ResendVerificationEmail(email string) error
+	VerifyMFA(request models.MFAVerifyRequest) (*models.JWTTokenResponse, error)
+	BeginWebAuthnLogIn(email string) (*models.WebAuthnLogInOptions, error)
+	WebAuthnLogIn(request models.WebAuthnLogInRequest) (*models.JWTTokenResponse, error)
+	SendMagicLink(request models.MagicLinkRequest) error
+	MagicLinkLogIn(request models.MagicLinkLogInRequest) (*models.JWTTokenResponse, error)
+	PhoneLogIn(request models.PhoneLogInRequest) (*models.JWTTokenResponse, error)
+	SocialLogIn(request models.SocialLogInRequest) (*models.JWTTokenResponse, error)
 }
 
 type UserService struct {
 	repository repository.UserRepositoryInterface
 	gRPCClient pb.AttachmentServiceClient
 	redisRepo  repository.RedisRepositoryInterface
+	roleRepo   repository.RoleRepositoryInterface
+	loginGuard LoginGuardInterface
+	verifier   EmailVerifierInterface
+	mfa        MFAServiceInterface
+	webAuthn   WebAuthnServiceInterface
+	magicLink  MagicLinkInterface
+	phone      PhoneServiceInterface
+	social     SocialLogInInterface
 }
 
-func NewUserService(gRPCClient pb.AttachmentServiceClient, repository repository.UserRepositoryInterface, redisRepo repository.RedisRepositoryInterface) UserServiceInterface {
-	return &UserService{gRPCClient: gRPCClient, repository: repository, redisRepo: redisRepo}
+func NewUserService(gRPCClient pb.AttachmentServiceClient, repository repository.UserRepositoryInterface, redisRepo repository.RedisRepositoryInterface, roleRepo repository.RoleRepositoryInterface, verifier EmailVerifierInterface, mfa MFAServiceInterface, webAuthn WebAuthnServiceInterface, magicLink MagicLinkInterface, phone PhoneServiceInterface, social SocialLogInInterface) UserServiceInterface {
+	return &UserService{
+		gRPCClient: gRPCClient,
+		repository: repository,
+		redisRepo:  redisRepo,
+		roleRepo:   roleRepo,
+		loginGuard: NewLoginGuard(redisRepo, repository),
+		verifier:   verifier,
+		mfa:        mfa,
+		webAuthn:   webAuthn,
+		magicLink:  magicLink,
+		phone:      phone,
+		social:     social,
+	}
 }
 
 func (service *UserService) Register(user models.User) (int, error) {
+	user.Email = normalizeEmail(user.Email)
 	err := user.Validate()
 	if err != nil {
 		return 0, err
@@ -49,9 +93,28 @@ func (service *UserService) Register(user models.User) (int, error) {
 	} else if respUser != nil {
 		return 0, errors.New("already registered user")
 	}
+	if err := validatePassword(user.Password, &user); err != nil {
+		return 0, err
+	}
 
-	user.Password = utils.HashPassword(user.Password)
-	return service.repository.Register(user)
+	user.Password, err = utils.HashPassword(user.Password)
+	if err != nil {
+		logger.LogError(err)
+		return 0, err
+	}
+	id, err := service.repository.Register(user)
+	if err != nil {
+		return 0, err
+	}
+
+	// A lost mail must not fail the registration, the user can ask for
+	// another one.
+	user.ID = id
+	if err := service.verifier.Send(&user); err != nil {
+		logger.LogError(err)
+	}
+
+	return id, nil
 }
 
 func (service *UserService) LogIn(signInInfo models.SignInData) (*models.JWTTokenResponse, error) {
@@ -60,28 +123,346 @@ func (service *UserService) LogIn(signInInfo models.SignInData) (*models.JWTToke
 	if err != nil {
 		return nil, err
 	}
+	signInInfo.Email = normalizeEmail(signInInfo.Email)
+
+	if err := service.loginGuard.Check(signInInfo.Email, signInInfo.IP); err != nil {
+		return nil, err
+	}
 
 	respUser, err := service.repository.FindByEmail(signInInfo.Email)
-	logger.LogError(respUser, " ", err)
 	if err != nil {
 		return nil, err
 	} else if respUser == nil {
-		return nil, errors.New("user not found")
+		if err := service.loginGuard.Failure(signInInfo.Email, signInInfo.IP, 0); err != nil {
+			return nil, err
+		}
+		return nil, rest_errors.ErrLogin
+	}
+
+	if err := accountLocked(respUser); err != nil {
+		return nil, err
+	}
+	if respUser.Password == "" {
+		return nil, service.providerOnly(respUser)
 	}
 
 	err = utils.ComparePassword(respUser.Password, signInInfo.Password)
 	if err != nil {
 		logger.LogError(err)
+		if err := service.loginGuard.Failure(signInInfo.Email, signInInfo.IP, respUser.ID); err != nil {
+			return nil, err
+		}
+		return nil, rest_errors.ErrLogin
+	}
+	service.loginGuard.Success(signInInfo.Email)
+	service.rehashPassword(respUser, signInInfo.Password)
+
+	if err := accountUsable(respUser); err != nil {
 		return nil, err
 	}
 
-	accessToken, err := utils.CreateToken(config.Config.AccessTokenExpiresIn, respUser.ID, config.Config.AccessTokenPrivateKey)
+	signInInfo.Scope = strings.Join(consts.APIScopes, " ")
+	return service.finishLogIn(respUser, signInInfo)
+}
+
+// finishLogIn opens the session of a user whose first factor passed, or
+// returns an MFA challenge when the user has a second factor.
+func (service *UserService) finishLogIn(user *models.User, signInInfo models.SignInData) (*models.JWTTokenResponse, error) {
+	if user.Disabled {
+		return nil, rest_errors.ErrAccountDisabled
+	}
+
+	enabled, err := service.mfa.Enabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return service.mfa.Challenge(user, signInInfo)
+	}
+
+	return service.StartSession(user, signInInfo)
+}
+
+// VerifyMFA finishes a login that returned an MFA challenge.
+func (service *UserService) VerifyMFA(request models.MFAVerifyRequest) (*models.JWTTokenResponse, error) {
+	user, signInInfo, err := service.mfa.VerifyChallenge(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.StartSession(user, signInInfo)
+}
+
+// BeginWebAuthnLogIn returns the options for a passwordless login.
+func (service *UserService) BeginWebAuthnLogIn(email string) (*models.WebAuthnLogInOptions, error) {
+	return service.webAuthn.BeginLogIn(email)
+}
+
+// WebAuthnLogIn opens a session for a verified passkey. The passkey already
+// combines possession with the user verification of the authenticator, so
+// no MFA challenge follows.
+func (service *UserService) WebAuthnLogIn(request models.WebAuthnLogInRequest) (*models.JWTTokenResponse, error) {
+	user, err := service.webAuthn.FinishLogIn(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := accountLocked(user); err != nil {
+		return nil, err
+	}
+	if err := accountUsable(user); err != nil {
+		return nil, err
+	}
+
+	return service.StartSession(user, models.SignInData{
+		Email:      user.Email,
+		DeviceName: request.DeviceName,
+		UserAgent:  request.UserAgent,
+		IP:         request.IP,
+		Scope:      strings.Join(consts.APIScopes, " "),
+	})
+}
+
+// SendMagicLink mails a login link. Accounts that are locked or backing off
+// after failed logins do not get one either.
+func (service *UserService) SendMagicLink(request models.MagicLinkRequest) error {
+	if err := service.loginGuard.Check(request.Email, request.IP); err != nil {
+		return err
+	}
+
+	return service.magicLink.Send(request.Email)
+}
+
+// MagicLinkLogIn exchanges a login link for the same response as LogIn,
+// including the MFA challenge when the user has a second factor. Following
+// the link proves the address, so it is marked verified.
+func (service *UserService) MagicLinkLogIn(request models.MagicLinkLogInRequest) (*models.JWTTokenResponse, error) {
+	user, err := service.magicLink.Consume(request.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.loginGuard.Check(user.Email, request.IP); err != nil {
+		return nil, err
+	}
+	if err := accountLocked(user); err != nil {
+		return nil, err
+	}
+	service.loginGuard.Success(user.Email)
+
+	if !user.EmailVerified {
+		if err := service.repository.SetEmailVerified(user.ID, true); err != nil {
+			return nil, err
+		}
+		user.EmailVerified = true
+	}
+	if err := accountUsable(user); err != nil {
+		return nil, err
+	}
+
+	return service.finishLogIn(user, models.SignInData{
+		Email:      user.Email,
+		DeviceName: request.DeviceName,
+		UserAgent:  request.UserAgent,
+		IP:         request.IP,
+		Scope:      strings.Join(consts.APIScopes, " "),
+	})
+}
+
+// PhoneLogIn exchanges a code sent to a verified number for the same
+// response as LogIn, including the MFA challenge.
+func (service *UserService) PhoneLogIn(request models.PhoneLogInRequest) (*models.JWTTokenResponse, error) {
+	user, err := service.phone.VerifyLogInCode(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := accountUsable(user); err != nil {
+		return nil, err
+	}
+
+	return service.finishLogIn(user, models.SignInData{
+		Email:      user.Email,
+		DeviceName: request.DeviceName,
+		UserAgent:  request.UserAgent,
+		IP:         request.IP,
+		Scope:      strings.Join(consts.APIScopes, " "),
+	})
+}
+
+// SocialLogIn finishes a login at an external provider with the same
+// response as LogIn, including the MFA challenge.
+func (service *UserService) SocialLogIn(request models.SocialLogInRequest) (*models.JWTTokenResponse, error) {
+	user, state, err := service.social.Authenticate(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.loginGuard.Check(user.Email, request.IP); err != nil {
+		return nil, err
+	}
+	if err := accountLocked(user); err != nil {
+		return nil, err
+	}
+	service.loginGuard.Success(user.Email)
+
+	if err := accountUsable(user); err != nil {
+		return nil, err
+	}
+
+	return service.finishLogIn(user, models.SignInData{
+		Email:      user.Email,
+		DeviceName: state.DeviceName,
+		UserAgent:  request.UserAgent,
+		IP:         request.IP,
+		Scope:      strings.Join(consts.APIScopes, " "),
+	})
+}
+
+// providerOnly is the error for a password login to an account that was
+// registered through a provider and never got a password.
+func (service *UserService) providerOnly(user *models.User) error {
+	providers, err := service.social.LinkedProviders(user.ID)
+	if err != nil {
+		return err
+	}
+	if len(providers) == 0 {
+		return rest_errors.ErrLogin
+	}
+
+	return rest_errors.WithStatus(rest_errors.InvalidLoginAttempt(strings.Join(providers, ", ")), http.StatusUnauthorized)
+}
+
+// accountLocked refuses logins into an account an admin or the login guard
+// locked.
+func accountLocked(user *models.User) error {
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return rest_errors.RetryAfter(rest_errors.ErrAccountLocked, time.Until(*user.LockedUntil))
+	}
+	return nil
+}
+
+// accountUsable refuses logins into accounts that first have to reset their
+// password or verify their email.
+func accountUsable(user *models.User) error {
+	if user.PasswordResetRequired {
+		return rest_errors.ErrPasswordResetRequired
+	}
+	if config.Config.EmailVerificationRequired && !user.EmailVerified {
+		return rest_errors.ErrEmailNotVerified
+	}
+	return nil
+}
+
+// rehashPassword replaces a hash made with an older scheme or weaker
+// parameters while the plain password is at hand. Failing to do so only
+// postpones the upgrade to the next login.
+func (service *UserService) rehashPassword(user *models.User, password string) {
+	if !utils.PasswordNeedsRehash(user.Password) {
+		return
+	}
+
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		logger.LogError(err)
+		return
+	}
+	if err := service.repository.ReplacePasswordHash(user.ID, user.Password, hash); err != nil {
+		logger.LogError(err)
+		return
+	}
+	user.Password = hash
+}
+
+// VerifyEmail confirms the address of the token's user.
+func (service *UserService) VerifyEmail(token string) error {
+	return service.verifier.Verify(token)
+}
+
+// ResendVerificationEmail mails a new verification link to the address.
+func (service *UserService) ResendVerificationEmail(email string) error {
+	return service.verifier.Resend(email)
+}
+
+// StartSession opens a new session for an already authenticated user and
+// issues its first access/refresh pair.
+func (service *UserService) StartSession(user *models.User, signInInfo models.SignInData) (*models.JWTTokenResponse, error) {
+	if user.Disabled {
+		return nil, rest_errors.ErrAccountDisabled
+	}
+
+	session, err := service.createSession(user.ID, signInInfo)
+	if err != nil {
+		logger.LogError(err)
+		return nil, err
+	}
+
+	return service.generateTokens(user, session)
+}
+
+// RefreshToken exchanges a refresh token for a new access/refresh pair. Every
+// refresh token can be used once; presenting an already used one revokes the
+// session it belongs to.
+func (service *UserService) RefreshToken(refreshToken string) (*models.JWTTokenResponse, error) {
+	tokenData, err := service.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	firstUse, err := service.redisRepo.SetNX(context.Background(), consts.RefreshTokenUsedKey+refreshToken, "1", config.Config.RefreshTokenExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+	if !firstUse {
+		logger.LogError("refresh token reused, revoking session ", tokenData.SessionID)
+		if err := service.revokeSession(tokenData.UserID, tokenData.SessionID); err != nil {
+			logger.LogError(err)
+		}
+		return nil, rest_errors.ErrRefreshTokenReused
+	}
+
+	user, err := service.repository.FindByID(tokenData.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, rest_errors.ErrAccountDisabled
+	}
+
+	service.touchSession(user.ID, tokenData.SessionID)
+
+	return service.generateTokens(user, &models.Session{ID: tokenData.SessionID, ClientID: tokenData.ClientID, Scope: tokenData.Scope})
+}
+
+// generateTokens issues a new access/refresh pair for the user and registers
+// both of them in the token family of the given session.
+func (service *UserService) generateTokens(user *models.User, session *models.Session) (*models.JWTTokenResponse, error) {
+	sessionID := session.ID
+	generation, err := service.tokenGeneration(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := service.roleRepo.UserRoles(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := models.Claims{
+		Subject:   strconv.Itoa(user.ID),
+		ClientID:  session.ClientID,
+		SessionID: sessionID,
+		Scope:     session.Scope,
+		Roles:     roles,
+	}
+
+	accessToken, err := utils.CreateToken(config.Config.AccessTokenExpiresIn, claims, utils.AccessTokenKeys)
 	if err != nil {
 		logger.LogError(err)
 		return nil, errors.New(err.Error())
 	}
 
-	refreshToken, err := utils.CreateToken(config.Config.RefreshTokenExpiresIn, respUser.ID, config.Config.RefreshTokenPrivateKey)
+	refreshToken, err := utils.CreateToken(config.Config.RefreshTokenExpiresIn, claims, utils.RefreshTokenKeys)
 	if err != nil {
 		logger.LogError(err)
 		return nil, errors.New(err.Error())
@@ -93,32 +474,75 @@ func (service *UserService) LogIn(signInInfo models.SignInData) (*models.JWTToke
 		Token:     accessToken,
 		Refresh:   refreshToken,
 		ExpiredAt: expirationTime.Unix(),
-		Email:     signInInfo.Email,
+		Email:     user.Email,
+		Scope:     session.Scope,
+	}
+
+	accessData, _ := json.Marshal(models.AccessTokenData{UserID: user.ID, SessionID: sessionID, Generation: generation, ClientID: session.ClientID, Scope: session.Scope})
+	err = service.redisRepo.SetValue(context.Background(), consts.AccessTokenKey+accessToken, string(accessData), config.Config.AccessTokenExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshData, _ := json.Marshal(models.RefreshTokenData{UserID: user.ID, SessionID: sessionID, Generation: generation, ClientID: session.ClientID, Scope: session.Scope})
+	err = service.redisRepo.SetValue(context.Background(), consts.RefreshTokenKey+refreshToken, string(refreshData), config.Config.RefreshTokenExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+
+	familyKey := consts.TokenFamilyKey + sessionID
+	err = service.redisRepo.Set(context.Background(), familyKey, map[string]interface{}{accessToken: time.Now().Unix()})
+	if err != nil {
+		return nil, err
+	}
+	err = service.redisRepo.SetExpire(context.Background(), familyKey, config.Config.RefreshTokenExpiresIn)
+	if err != nil {
+		logger.LogError(err)
 	}
-	marshalJson, _ := json.Marshal(resp)
-	_ = service.redisRepo.SetValue(context.Background(), "access_token:"+accessToken, string(marshalJson), config.Config.AccessTokenExpiresIn)
 
 	return &resp, nil
 }
 
+// revokeTokenFamily drops every access token issued in the family. Refresh
+// tokens of the family are rejected once the family key is gone.
+func (service *UserService) revokeTokenFamily(familyID string) error {
+	familyKey := consts.TokenFamilyKey + familyID
+	accessTokens, err := service.redisRepo.GetAll(context.Background(), familyKey)
+	if err != nil {
+		return err
+	}
+
+	for accessToken := range accessTokens {
+		err := service.redisRepo.Delete(context.Background(), consts.AccessTokenKey+accessToken, nil)
+		if err != nil {
+			logger.LogError(err)
+		}
+	}
+
+	return service.redisRepo.Delete(context.Background(), familyKey, nil)
+}
+
 func (service *UserService) UpdateProfile(user *models.User) error {
 	field := strconv.Itoa(user.ID)
 
+	user.Email = normalizeEmail(user.Email)
 	err := user.Validate()
 	if err != nil {
 		return err
 	}
+	if user.Password != "" {
+		return rest_errors.ErrPasswordUpdateNotAllowed
+	}
 	_, err = service.ViewProfile(user.ID)
 	if err != nil {
 		return err
 	}
 
-	if user.Password != "" {
-		user.Password = utils.HashPassword(user.Password)
-	}
-
 	requestAttachments := &pb.RequestAttachments{}
 	err = service.repository.UpdateProfile(user)
+	if err == repository.ErrLastLoginMethod {
+		return rest_errors.ErrLastLoginMethod
+	}
 	if err != nil {
 		return err
 	}
@@ -155,6 +579,46 @@ func (service *UserService) UpdateProfile(user *models.User) error {
 	return nil
 }
 
+// ChangePassword replaces the password after checking the current one and
+// signs the user out of every session. Wrong current passwords count as
+// failed logins, so a stolen session cannot be used to guess the password.
+func (service *UserService) ChangePassword(request models.ChangePasswordRequest) error {
+	user, err := service.repository.FindByID(request.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := service.loginGuard.Check(user.Email, request.IP); err != nil {
+		return err
+	}
+	if err := utils.ComparePassword(user.Password, request.CurrentPassword); err != nil {
+		if err := service.loginGuard.Failure(user.Email, request.IP, user.ID); err != nil {
+			return err
+		}
+		return rest_errors.ErrIncorrectPassword
+	}
+	service.loginGuard.Success(user.Email)
+
+	if err := validatePassword(request.NewPassword, user); err != nil {
+		return err
+	}
+	if err := checkPasswordReuse(service.repository, user, request.NewPassword); err != nil {
+		return err
+	}
+
+	hash, err := utils.HashPassword(request.NewPassword)
+	if err != nil {
+		logger.LogError(err)
+		return err
+	}
+	if err := service.repository.UpdatePassword(user.ID, hash); err != nil {
+		logger.LogError(err)
+		return err
+	}
+
+	return service.LogOutAll(user.ID)
+}
+
 func (service *UserService) ViewProfile(userID int) (*models.User, error) {
 
 	field := strconv.Itoa(userID)
@@ -235,7 +699,17 @@ func (service *UserService) ViewProfile(userID int) (*models.User, error) {
 }
 
 func (service *UserService) LogOut(accessToken string) error {
-	return service.redisRepo.Delete(context.Background(), "access_token:"+accessToken, nil)
+	data, err := service.redisRepo.Get(context.Background(), consts.AccessTokenKey+accessToken)
+	if err != nil {
+		logger.LogError(err)
+	}
+
+	tokenData := models.AccessTokenData{}
+	if data != "" && json.Unmarshal([]byte(data), &tokenData) == nil && tokenData.SessionID != "" {
+		return service.revokeSession(tokenData.UserID, tokenData.SessionID)
+	}
+
+	return service.redisRepo.Delete(context.Background(), consts.AccessTokenKey+accessToken, nil)
 }
 
 func (r *UserService) RequestSent(userID int, requestedID int) error {
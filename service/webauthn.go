@@ -0,0 +1,468 @@
+package service
+
+import (
+	"auth/common/logger"
+	"auth/common/utils"
+	"auth/common/webauthn"
+	"auth/config"
+	"auth/consts"
+	"auth/models"
+	"auth/repository"
+	"auth/rest_errors"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webAuthnTimeout is how long the browser prompt may take and how long its
+// challenge is kept.
+const webAuthnTimeout = 5 * time.Minute
+
+// WebAuthnServiceInterface runs the passkey ceremonies. Passkeys serve both as
+// second factor after a password and as passwordless login.
+type WebAuthnServiceInterface interface {
+	BeginRegistration(userID int) (*models.WebAuthnCreationOptions, error)
+	FinishRegistration(request models.WebAuthnRegistrationRequest) (*models.WebAuthnRegistration, error)
+	Credentials(userID int) ([]*models.WebAuthnCredential, error)
+	HasCredentials(userID int) (bool, error)
+	RemoveCredential(userID int, id int) error
+	BeginAssertion(userID int, ip string) (*models.WebAuthnRequestOptions, error)
+	VerifyAssertion(userID int, assertion *models.WebAuthnAssertion) error
+	BeginLogIn(email string) (*models.WebAuthnLogInOptions, error)
+	FinishLogIn(request models.WebAuthnLogInRequest) (*models.User, error)
+}
+
+type WebAuthnService struct {
+	webAuthnRepo repository.WebAuthnRepositoryInterface
+	userRepo     repository.UserRepositoryInterface
+	mfaRepo      repository.MFARepositoryInterface
+	redisRepo    repository.RedisRepositoryInterface
+	loginGuard   LoginGuardInterface
+}
+
+// webAuthnLogIn is the pending passwordless login kept under its session id.
+// UserID is set when the login started with an email.
+type webAuthnLogIn struct {
+	Challenge string `json:"challenge"`
+	UserID    int    `json:"user_id,omitempty"`
+}
+
+func NewWebAuthnService(webAuthnRepo repository.WebAuthnRepositoryInterface, userRepo repository.UserRepositoryInterface, mfaRepo repository.MFARepositoryInterface, redisRepo repository.RedisRepositoryInterface) WebAuthnServiceInterface {
+	return &WebAuthnService{
+		webAuthnRepo: webAuthnRepo,
+		userRepo:     userRepo,
+		mfaRepo:      mfaRepo,
+		redisRepo:    redisRepo,
+		loginGuard:   NewLoginGuard(redisRepo, userRepo),
+	}
+}
+
+func (service *WebAuthnService) BeginRegistration(userID int) (*models.WebAuthnCreationOptions, error) {
+	user, err := service.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := service.newChallenge(consts.WebAuthnRegisterKey + strconv.Itoa(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := service.descriptors(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := user.Name
+	if displayName == "" {
+		displayName = user.Email
+	}
+
+	rp := relyingParty()
+	params := make([]models.WebAuthnCredentialParameter, 0, len(webauthn.SupportedAlgorithms))
+	for _, alg := range webauthn.SupportedAlgorithms {
+		params = append(params, models.WebAuthnCredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	return &models.WebAuthnCreationOptions{
+		Challenge: challenge,
+		RP:        models.WebAuthnRelyingParty{ID: rp.ID, Name: rp.Name},
+		User: models.WebAuthnUser{
+			ID:          webauthn.Encode([]byte(strconv.Itoa(user.ID))),
+			Name:        user.Email,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams:   params,
+		Timeout:            webAuthnTimeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: models.WebAuthnAuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// FinishRegistration stores the credential created for the pending
+// challenge. The first second factor of a user comes with recovery codes,
+// which are never shown again.
+func (service *WebAuthnService) FinishRegistration(request models.WebAuthnRegistrationRequest) (*models.WebAuthnRegistration, error) {
+	challenge, err := service.takeChallenge(consts.WebAuthnRegisterKey + strconv.Itoa(request.UserID))
+	if err != nil {
+		return nil, err
+	}
+
+	clientData, err := webauthn.Decode(request.Credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, rest_errors.ErrInvalidWebAuthnCredential
+	}
+	attestation, err := webauthn.Decode(request.Credential.Response.AttestationObject)
+	if err != nil {
+		return nil, rest_errors.ErrInvalidWebAuthnCredential
+	}
+
+	rp := relyingParty()
+	created, err := rp.VerifyRegistration(challenge, clientData, attestation, false)
+	if err != nil {
+		logger.LogError(err)
+		return nil, rest_errors.ErrInvalidWebAuthnCredential
+	}
+
+	credentialID := webauthn.Encode(created.ID)
+	if existing, err := service.webAuthnRepo.FindByCredentialID(credentialID); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, rest_errors.ErrWebAuthnCredentialExists
+	}
+
+	hadSecondFactor, err := service.hasSecondFactor(request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	credential := &models.WebAuthnCredential{
+		UserID:       request.UserID,
+		CredentialID: credentialID,
+		PublicKey:    created.PublicKey,
+		SignCount:    created.SignCount,
+		Transports:   request.Credential.Response.Transports,
+		Name:         name,
+	}
+	if credential.Transports == nil {
+		credential.Transports = []string{}
+	}
+	if _, err := service.webAuthnRepo.Create(credential); err != nil {
+		return nil, err
+	}
+
+	registration := &models.WebAuthnRegistration{Credential: credential}
+	if !hadSecondFactor {
+		codes, hashes, err := generateRecoveryCodes()
+		if err != nil {
+			return nil, err
+		}
+		if err := service.mfaRepo.ReplaceRecoveryCodes(request.UserID, hashes); err != nil {
+			return nil, err
+		}
+		registration.RecoveryCodes = codes
+	}
+
+	return registration, nil
+}
+
+func (service *WebAuthnService) Credentials(userID int) ([]*models.WebAuthnCredential, error) {
+	return service.webAuthnRepo.ListByUser(userID)
+}
+
+func (service *WebAuthnService) HasCredentials(userID int) (bool, error) {
+	count, err := service.webAuthnRepo.CountByUser(userID)
+	return count > 0, err
+}
+
+// RemoveCredential deletes a credential of the user, unless it is the last
+// way the user can log in. Callers check that the user is present first, see
+// MFAService.RemoveWebAuthnCredential.
+func (service *WebAuthnService) RemoveCredential(userID int, id int) error {
+	deleted, err := service.webAuthnRepo.Delete(userID, id)
+	if err == repository.ErrLastLoginMethod {
+		return rest_errors.ErrLastLoginMethod
+	}
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return rest_errors.ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// BeginAssertion issues the challenge for using a passkey as second factor.
+// Accounts that are locked or backing off get none, like for a TOTP code.
+func (service *WebAuthnService) BeginAssertion(userID int, ip string) (*models.WebAuthnRequestOptions, error) {
+	user, err := service.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.loginGuard.Check(user.Email, ip); err != nil {
+		return nil, err
+	}
+
+	allow, err := service.descriptors(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(allow) == 0 {
+		return nil, rest_errors.ErrWebAuthnCredentialNotFound
+	}
+
+	challenge, err := service.newChallenge(consts.WebAuthnAssertionKey + strconv.Itoa(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebAuthnRequestOptions{
+		Challenge:        challenge,
+		Timeout:          webAuthnTimeout.Milliseconds(),
+		RPID:             relyingParty().ID,
+		AllowCredentials: allow,
+		UserVerification: "discouraged",
+	}, nil
+}
+
+// VerifyAssertion checks a passkey used as second factor against the
+// challenge of BeginAssertion. The challenge is used up either way. Callers
+// count a failed assertion towards the login lockout.
+func (service *WebAuthnService) VerifyAssertion(userID int, assertion *models.WebAuthnAssertion) error {
+	challenge, err := service.takeChallenge(consts.WebAuthnAssertionKey + strconv.Itoa(userID))
+	if err != nil {
+		return err
+	}
+
+	credential, err := service.webAuthnRepo.FindByCredentialID(assertion.ID)
+	if err != nil {
+		return err
+	}
+	if credential == nil || credential.UserID != userID {
+		return rest_errors.ErrInvalidWebAuthnCredential
+	}
+
+	return service.verify(challenge, credential, assertion, false)
+}
+
+// BeginLogIn starts a passwordless login. With an email the browser is
+// pointed at the passkeys of that account; an unknown email gets the same
+// answer as one without passkeys, so accounts cannot be probed.
+func (service *WebAuthnService) BeginLogIn(email string) (*models.WebAuthnLogInOptions, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	pending := webAuthnLogIn{Challenge: webauthn.Encode(challenge)}
+
+	allow := []models.WebAuthnCredentialDescriptor{}
+	if email = strings.TrimSpace(email); email != "" {
+		user, err := service.userRepo.FindByEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			pending.UserID = user.ID
+			if allow, err = service.descriptors(user.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sessionID, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(pending)
+	if err := service.redisRepo.SetValue(context.Background(), consts.WebAuthnLogInKey+sessionID, string(data), webAuthnTimeout); err != nil {
+		return nil, err
+	}
+
+	return &models.WebAuthnLogInOptions{
+		SessionID: sessionID,
+		PublicKey: models.WebAuthnRequestOptions{
+			Challenge:        pending.Challenge,
+			Timeout:          webAuthnTimeout.Milliseconds(),
+			RPID:             relyingParty().ID,
+			AllowCredentials: allow,
+			UserVerification: "required",
+		},
+	}, nil
+}
+
+// FinishLogIn verifies the assertion of a passwordless login and returns its
+// user. The authenticator has to verify the user, so the passkey stands in
+// for both factors. Failed assertions count as failed logins of the account.
+func (service *WebAuthnService) FinishLogIn(request models.WebAuthnLogInRequest) (*models.User, error) {
+	data, err := service.redisRepo.GetAndDelete(context.Background(), consts.WebAuthnLogInKey+request.SessionID)
+	if err != nil || data == "" {
+		return nil, rest_errors.ErrWebAuthnChallengeNotFound
+	}
+	pending := webAuthnLogIn{}
+	if err := json.Unmarshal([]byte(data), &pending); err != nil {
+		logger.LogError(err)
+		return nil, rest_errors.ErrWebAuthnChallengeNotFound
+	}
+	challenge, err := webauthn.Decode(pending.Challenge)
+	if err != nil {
+		return nil, rest_errors.ErrWebAuthnChallengeNotFound
+	}
+
+	credential, err := service.webAuthnRepo.FindByCredentialID(request.Credential.ID)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil || (pending.UserID != 0 && credential.UserID != pending.UserID) {
+		return nil, rest_errors.ErrInvalidWebAuthnCredential
+	}
+	if handle := request.Credential.Response.UserHandle; handle != "" {
+		userHandle, err := webauthn.Decode(handle)
+		if err != nil || string(userHandle) != strconv.Itoa(credential.UserID) {
+			return nil, rest_errors.ErrInvalidWebAuthnCredential
+		}
+	}
+
+	user, err := service.userRepo.FindByID(credential.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.loginGuard.Check(user.Email, request.IP); err != nil {
+		return nil, err
+	}
+	if err := service.verify(challenge, credential, &request.Credential, true); err != nil {
+		if err := service.loginGuard.Failure(user.Email, request.IP, user.ID); err != nil {
+			return nil, err
+		}
+		return nil, err
+	}
+	service.loginGuard.Success(user.Email)
+
+	return user, nil
+}
+
+// verify checks the assertion and stores the new sign count. A sign count
+// that went backwards points at a cloned authenticator and is refused.
+func (service *WebAuthnService) verify(challenge []byte, credential *models.WebAuthnCredential, assertion *models.WebAuthnAssertion, requireUserVerification bool) error {
+	clientData, err := webauthn.Decode(assertion.Response.ClientDataJSON)
+	if err != nil {
+		return rest_errors.ErrInvalidWebAuthnCredential
+	}
+	authData, err := webauthn.Decode(assertion.Response.AuthenticatorData)
+	if err != nil {
+		return rest_errors.ErrInvalidWebAuthnCredential
+	}
+	signature, err := webauthn.Decode(assertion.Response.Signature)
+	if err != nil {
+		return rest_errors.ErrInvalidWebAuthnCredential
+	}
+
+	rp := relyingParty()
+	signCount, err := rp.VerifyAssertion(challenge, webauthn.Credential{
+		PublicKey: credential.PublicKey,
+		SignCount: credential.SignCount,
+	}, clientData, authData, signature, requireUserVerification)
+	if errors.Is(err, webauthn.ErrSignCount) {
+		logger.LogError("webauthn credential ", credential.ID, " of user ", credential.UserID, " may be cloned: ", err)
+		return rest_errors.ErrInvalidWebAuthnCredential
+	}
+	if err != nil {
+		logger.LogError(err)
+		return rest_errors.ErrInvalidWebAuthnCredential
+	}
+
+	updated, err := service.webAuthnRepo.UpdateSignCount(credential.ID, credential.SignCount, signCount)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		// Another assertion with this credential got in first.
+		return rest_errors.ErrInvalidWebAuthnCredential
+	}
+
+	return nil
+}
+
+// hasSecondFactor reports whether the user already has TOTP or a passkey,
+// and with it recovery codes.
+func (service *WebAuthnService) hasSecondFactor(userID int) (bool, error) {
+	secret, err := service.mfaRepo.FindTOTP(userID)
+	if err != nil || secret != nil {
+		return secret != nil, err
+	}
+	return service.HasCredentials(userID)
+}
+
+func (service *WebAuthnService) descriptors(userID int) ([]models.WebAuthnCredentialDescriptor, error) {
+	credentials, err := service.webAuthnRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors := make([]models.WebAuthnCredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptors = append(descriptors, models.WebAuthnCredentialDescriptor{
+			Type:       "public-key",
+			ID:         credential.CredentialID,
+			Transports: credential.Transports,
+		})
+	}
+	return descriptors, nil
+}
+
+// newChallenge stores a fresh challenge under key, replacing a pending one,
+// and returns it encoded for the browser.
+func (service *WebAuthnService) newChallenge(key string) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	encoded := webauthn.Encode(challenge)
+	if err := service.redisRepo.SetValue(context.Background(), key, encoded, webAuthnTimeout); err != nil {
+		return "", err
+	}
+	return encoded, nil
+}
+
+// takeChallenge consumes the challenge stored under key.
+func (service *WebAuthnService) takeChallenge(key string) ([]byte, error) {
+	encoded, err := service.redisRepo.GetAndDelete(context.Background(), key)
+	if err != nil || encoded == "" {
+		return nil, rest_errors.ErrWebAuthnChallengeNotFound
+	}
+	return webauthn.Decode(encoded)
+}
+
+func relyingParty() *webauthn.RelyingParty {
+	rp := &webauthn.RelyingParty{
+		ID:   config.Config.WebAuthnRPID,
+		Name: config.Config.WebAuthnRPName,
+	}
+	if rp.ID == "" {
+		rp.ID = "localhost"
+	}
+	if rp.Name == "" {
+		rp.Name = mfaIssuer()
+	}
+	for _, origin := range strings.Split(config.Config.WebAuthnOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			rp.Origins = append(rp.Origins, origin)
+		}
+	}
+	if len(rp.Origins) == 0 {
+		rp.Origins = []string{"https://" + rp.ID}
+	}
+	return rp
+}